@@ -0,0 +1,215 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxCharRefLen bounds the length of a character reference ("&#x1F600;") a
+// Filter recognises.
+const maxCharRefLen = 16
+
+// Filter corrects what SMS Backup & Restore writes that encoding/xml rejects
+// or misreads, before it reaches the decoder:
+//
+//   - Characters outside the Basic Multilingual Plane, such as emoji, are
+//     written as a character reference per UTF-16 surrogate
+//     ("&#55357;&#56832;"). A pair becomes one reference to the code point it
+//     encodes, zero-padded to the pair's length ("&#0000000128512;"); a
+//     surrogate without its partner becomes U+FFFD.
+//   - Each byte that is not part of valid UTF-8 becomes '?'.
+//
+// Every replacement has the length of what it replaces, so decoder offsets
+// are offsets in the original input.
+type Filter struct {
+	r        io.Reader
+	sanitise bool
+	err      error
+	// work holds the bytes read from r: out is its filtered part not yet
+	// returned, and pending a tail that may end in the middle of a
+	// character reference, surrogate pair or UTF-8 sequence, filtered once
+	// the rest has been read.
+	work    []byte
+	out     []byte
+	pending []byte
+	// Fixed counts the characters replaced.
+	Fixed int
+}
+
+// NewFilter returns a Filter reading from r.
+func NewFilter(r io.Reader) *Filter {
+	return &Filter{r: r, work: make([]byte, 0, 32<<10+2*maxCharRefLen)}
+}
+
+// NewSanitiser returns a Filter that also replaces the characters XML 1.0
+// does not allow - control characters other than tab, newline and carriage
+// return, raw or as character references, and U+FFFE and U+FFFF - with
+// spaces, for reading damaged backups.
+func NewSanitiser(r io.Reader) *Filter {
+	f := NewFilter(r)
+	f.sanitise = true
+	return f
+}
+
+func (f *Filter) Read(p []byte) (int, error) {
+	for len(f.out) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		f.work = append(f.work[:0], f.pending...)
+		n, err := f.r.Read(f.work[len(f.work):cap(f.work)])
+		f.work = f.work[:len(f.work)+n]
+		f.err = err
+		keep := 0
+		if err == nil {
+			keep = unfinished(f.work)
+		}
+		f.pending = append(f.pending[:0], f.work[len(f.work)-keep:]...)
+		f.out = f.work[:len(f.work)-keep]
+		f.Fixed += f.filter(f.out)
+	}
+	n := copy(p, f.out)
+	f.out = f.out[n:]
+	return n, nil
+}
+
+// unfinished returns the length of the tail of b that the next read may
+// complete: a character reference that is cut short or ends b, together with
+// a high surrogate reference just before it (the first half of a pair whose
+// second half may follow), or an incomplete UTF-8 sequence.
+func unfinished(b []byte) int {
+	keep := 0
+	if amp := lastRef(b, len(b)); amp >= 0 {
+		if n, _, ok := charRef(b[amp:]); !ok || amp+n == len(b) {
+			keep = len(b) - amp
+			if prev := lastRef(b, amp); prev >= 0 {
+				if n, r, ok := charRef(b[prev:amp]); ok && prev+n == amp && r >= 0xD800 && r < 0xDC00 {
+					keep = len(b) - prev
+				}
+			}
+		}
+	}
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) && len(b)-i > keep {
+				keep = len(b) - i
+			}
+			break
+		}
+	}
+	return keep
+}
+
+// lastRef returns the index of the last '&' in the maxCharRefLen bytes of b
+// before end, where a character reference ending at or after end would
+// start, or -1.
+func lastRef(b []byte, end int) int {
+	start := max(end-maxCharRefLen, 0)
+	if amp := bytes.LastIndexByte(b[start:end], '&'); amp >= 0 {
+		return start + amp
+	}
+	return -1
+}
+
+// filter corrects b in place and returns how many characters it replaced.
+func (f *Filter) filter(b []byte) int {
+	fixed := 0
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == '&':
+			n, r, ok := charRef(b[i:])
+			if !ok {
+				i++
+				continue
+			}
+			switch {
+			case utf16.IsSurrogate(r):
+				if n2, r2, ok := charRef(b[i+n:]); ok && r < 0xDC00 && r2 >= 0xDC00 && r2 <= 0xDFFF {
+					n += n2
+					r = utf16.DecodeRune(r, r2)
+				} else {
+					r = utf8.RuneError
+				}
+				writeCharRef(b[i:i+n], r)
+				fixed++
+			case f.sanitise && !isXMLChar(r):
+				blank(b[i : i+n])
+				fixed++
+			}
+			i += n
+		case c < utf8.RuneSelf:
+			if f.sanitise && !isXMLChar(rune(c)) {
+				b[i] = ' '
+				fixed++
+			}
+			i++
+		default:
+			r, size := utf8.DecodeRune(b[i:])
+			switch {
+			case r == utf8.RuneError && size == 1:
+				b[i] = '?'
+				fixed++
+			case f.sanitise && !isXMLChar(r):
+				blank(b[i : i+size])
+				fixed++
+			}
+			i += size
+		}
+	}
+	return fixed
+}
+
+// charRef parses the character reference ("&#65;" or "&#x41;") at the start
+// of b, returning its length and the code point it refers to.
+func charRef(b []byte) (n int, r rune, ok bool) {
+	if len(b) < 4 || b[0] != '&' || b[1] != '#' {
+		return 0, 0, false
+	}
+	if len(b) > maxCharRefLen {
+		b = b[:maxCharRefLen]
+	}
+	end := bytes.IndexByte(b, ';')
+	if end < 3 {
+		return 0, 0, false
+	}
+	digits, base := b[2:end], 10
+	if digits[0] == 'x' {
+		digits, base = digits[1:], 16
+	}
+	v, err := strconv.ParseUint(string(digits), base, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	return end + 1, rune(v), true
+}
+
+// writeCharRef overwrites dst with a decimal reference to r, zero-padded to
+// fill it. dst is at least as long as "&#65533;".
+func writeCharRef(dst []byte, r rune) {
+	digits := strconv.Itoa(int(r))
+	dst[0], dst[1] = '&', '#'
+	pad := len(dst) - 3 - len(digits)
+	for i := range pad {
+		dst[2+i] = '0'
+	}
+	copy(dst[2+pad:], digits)
+	dst[len(dst)-1] = ';'
+}
+
+func blank(b []byte) {
+	for i := range b {
+		b[i] = ' '
+	}
+}
+
+// isXMLChar reports whether r may appear in an XML 1.0 document.
+func isXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
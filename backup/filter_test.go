@@ -0,0 +1,108 @@
+package backup
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func filterAll(t *testing.T, in string, sanitise bool) (string, int) {
+	t.Helper()
+	var out string
+	fixed := -1
+	for name, r := range map[string]io.Reader{
+		"whole":    strings.NewReader(in),
+		"one byte": iotest.OneByteReader(strings.NewReader(in)),
+	} {
+		f := NewFilter(r)
+		if sanitise {
+			f = NewSanitiser(r)
+		}
+		got, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(in) {
+			t.Errorf("%s: filtered %d bytes into %d", name, len(in), len(got))
+		}
+		if fixed >= 0 && (string(got) != out || f.Fixed != fixed) {
+			t.Errorf("%s: %q (%d fixed) differs from %q (%d fixed)", name, got, f.Fixed, out, fixed)
+		}
+		out, fixed = string(got), f.Fixed
+	}
+	return out, fixed
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		in, want string
+		fixed    int
+	}{
+		{"&#55357;&#56832;", "&#0000000128512;", 1},
+		{"&#xD83D;&#xDE00; ok", "&#0000000128512; ok", 1},
+		{"a&#55357;b", "a&#65533;b", 1},
+		{"&#56832;&#55357;", "&#65533;&#65533;", 2},
+		{"&#65;&#x1F600;&amp;&#;&#x;&", "&#65;&#x1F600;&amp;&#;&#x;&", 0},
+		{"caf\xe9 \xf0\x9f\x98\x80", "caf? \xf0\x9f\x98\x80", 1},
+		{"\x01&#1;", "\x01&#1;", 0},
+	}
+	for _, tt := range tests {
+		got, fixed := filterAll(t, tt.in, false)
+		if got != tt.want || fixed != tt.fixed {
+			t.Errorf("filter(%q) = %q (%d fixed), want %q (%d fixed)", tt.in, got, fixed, tt.want, tt.fixed)
+		}
+	}
+}
+
+func TestSanitiser(t *testing.T) {
+	in := "<sms body=\"a\x01b&#1;c&#x1F;d&#65;&#x1F600;\t\r\n&amp;\xef\xbf\xbe&#55357;&#56832;\"/>"
+	want := "<sms body=\"a b    c      d&#65;&#x1F600;\t\r\n&amp;   &#0000000128512;\"/>"
+	got, fixed := filterAll(t, in, true)
+	if got != want || fixed != 5 {
+		t.Errorf("sanitised\n%q (%d fixed), want\n%q (5 fixed)", got, fixed, want)
+	}
+}
+
+func TestScanner_Emoji(t *testing.T) {
+	doc := `<smses><sms address="+1" date="1" body="hi &#55357;&#56832;" contact_name="Zo&#235; &#55357;"/></smses>`
+	s := NewScanner(strings.NewReader(doc))
+	if !s.Scan() {
+		t.Fatalf("Scan = false, err %v", s.Err())
+	}
+	if rec := s.Record(); rec.SMS.Body != "hi 😀" || rec.SMS.ContactName != "Zoë �" {
+		t.Errorf("body %q, contact name %q", rec.SMS.Body, rec.SMS.ContactName)
+	}
+}
+
+// chunkReader returns at most size bytes a read, as a file read in blocks.
+type chunkReader struct {
+	r    io.Reader
+	size int
+}
+
+func (c chunkReader) Read(p []byte) (int, error) {
+	return c.r.Read(p[:min(len(p), c.size)])
+}
+
+// TestFilter_PairAcrossReads puts a surrogate pair at every offset around
+// the end of the first read, so that each of its bytes in turn is the last
+// one the first read returns.
+func TestFilter_PairAcrossReads(t *testing.T) {
+	for _, pair := range []string{"&#55357;&#56832;", "&#x0D83D;&#000056832;"} {
+		want, _ := filterAll(t, pair, false)
+		for _, size := range []int{32 << 10, 32<<10 - 7, 4 << 10} {
+			for offset := size - 2*maxCharRefLen - 8; offset <= size+8; offset++ {
+				in := strings.Repeat("a", offset) + pair + strings.Repeat(" ", 2*size)
+				f := NewFilter(chunkReader{strings.NewReader(in), size})
+				got, err := io.ReadAll(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := string(got[offset : offset+len(pair)]); got != want || f.Fixed != 1 {
+					t.Fatalf("%s in reads of %d at %d: %q (%d fixed), want %q", pair, size, offset, got, f.Fixed, want)
+				}
+			}
+		}
+	}
+}
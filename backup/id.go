@@ -0,0 +1,48 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// ID returns a stable identifier for the record: a hash of the same
+// identifying attributes Merge compares (see identityAttrs), so the same
+// message or call found in a full and an incremental backup has the same ID
+// even though the files differ.
+func (r Record) ID() string {
+	h := sha256.New()
+	field := func(s string) {
+		// Length-prefix every field so that adjacent fields cannot run
+		// into one another.
+		h.Write([]byte(strconv.Itoa(len(s))))
+		h.Write([]byte{':'})
+		h.Write([]byte(s))
+	}
+	field(r.Kind.String())
+	switch r.Kind {
+	case KindSMS:
+		field(string(r.SMS.Address))
+		field(r.SMS.Date)
+		field(strconv.Itoa(int(r.SMS.Type)))
+		field(r.SMS.Body)
+	case KindMMS:
+		field(string(r.MMS.Address))
+		field(r.MMS.Date)
+		field(strconv.Itoa(int(r.MMS.MessageBox)))
+		field(r.MMS.MessageID)
+		for _, p := range r.MMS.Parts {
+			field(p.ContentType)
+			field(p.Filename)
+			field(p.Name)
+			field(p.Text)
+			field(p.Data)
+		}
+	case KindCall:
+		field(string(r.Call.Number))
+		field(r.Call.Date)
+		field(strconv.Itoa(int(r.Call.Type)))
+		field(r.Call.Duration)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
@@ -0,0 +1,201 @@
+// Package backup reads and writes SMS Backup & Restore XML files as a whole:
+// merging overlapping full and incremental backups into one file.
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// MergeStats reports what Merge did.
+type MergeStats struct {
+	// Files is the number of input files read.
+	Files int
+	// Records is the number of distinct records written.
+	Records int
+	// Duplicates is the number of records dropped because an identical record
+	// had already been seen in the same or an earlier input.
+	Duplicates int
+}
+
+// recordKey identifies a record independently of the volatile attributes the
+// app rewrites on every backup (readable_date, contact_name, read, seen, ...),
+// so the same message found in a full and an incremental backup collapses to
+// one entry.
+type recordKey [sha256.Size]byte
+
+// identityAttrs lists, per record element, the attributes that make up its
+// identity. Nested MMS <part> elements contribute partIdentityAttrs.
+var identityAttrs = map[string][]string{
+	"sms":  {"address", "date", "type", "body"},
+	"mms":  {"address", "date", "msg_box", "m_id"},
+	"call": {"number", "date", "type", "duration"},
+}
+
+var partIdentityAttrs = []string{"seq", "ct", "cl", "name", "text", "data"}
+
+// recordPos locates a record by input file and position within that file.
+type recordPos struct {
+	file, index int
+}
+
+// Merge reads the backup files in inPaths in order and writes to w a single
+// backup containing each distinct record once, in first-seen order. All inputs
+// must share the same root element (<smses> or <calls>).
+//
+// The inputs are read twice: the first pass decides which records survive so
+// that the root element's count attribute can be written up front without
+// buffering a potentially multi-gigabyte result.
+func Merge(w io.Writer, inPaths []string) (MergeStats, error) {
+	var stats MergeStats
+	if len(inPaths) == 0 {
+		return stats, errors.New("no input files")
+	}
+
+	keep := make(map[recordKey]recordPos)
+	root := ""
+	for fi, path := range inPaths {
+		fileRoot, err := walkRecords(path, func(index int, _ []xml.Token, key recordKey) error {
+			if _, dup := keep[key]; dup {
+				stats.Duplicates++
+				return nil
+			}
+			keep[key] = recordPos{fi, index}
+			return nil
+		})
+		if err != nil {
+			return stats, err
+		}
+		if root == "" {
+			root = fileRoot
+		} else if fileRoot != root {
+			return stats, fmt.Errorf("%s: root element <%s> does not match <%s>", path, fileRoot, root)
+		}
+		stats.Files++
+	}
+	stats.Records = len(keep)
+
+	if _, err := fmt.Fprintf(w, "<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>\n<%s count=\"%d\">\n", root, stats.Records); err != nil {
+		return stats, err
+	}
+	enc := xml.NewEncoder(w)
+	for fi, path := range inPaths {
+		_, err := walkRecords(path, func(index int, tokens []xml.Token, key recordKey) error {
+			if keep[key] != (recordPos{fi, index}) {
+				return nil
+			}
+			for _, tok := range tokens {
+				if err := enc.EncodeToken(tok); err != nil {
+					return err
+				}
+			}
+			if err := enc.Flush(); err != nil {
+				return err
+			}
+			_, err := io.WriteString(w, "\n")
+			return err
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+	_, err := fmt.Fprintf(w, "</%s>\n", root)
+	return stats, err
+}
+
+// walkRecords calls fn for every top-level record element in the backup file at
+// path, passing the record's index, its complete token stream and its identity
+// key. It returns the name of the root element.
+func walkRecords(path string, fn func(index int, tokens []xml.Token, key recordKey) error) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	decoder := xml.NewDecoder(NewFilter(file))
+	root := ""
+	index := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return root, fmt.Errorf("decoding %s: %w", path, err)
+		}
+		se, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if root == "" {
+			root = se.Name.Local
+			continue
+		}
+		if _, known := identityAttrs[se.Name.Local]; !known {
+			if err = decoder.Skip(); err != nil {
+				return root, fmt.Errorf("decoding %s: %w", path, err)
+			}
+			continue
+		}
+		tokens, key, err := readRecord(decoder, se)
+		if err != nil {
+			return root, fmt.Errorf("decoding %s: %w", path, err)
+		}
+		if err = fn(index, tokens, key); err != nil {
+			return root, err
+		}
+		index++
+	}
+	if root == "" {
+		return "", fmt.Errorf("%s: no root element", path)
+	}
+	return root, nil
+}
+
+// readRecord consumes the element started by se and returns its tokens
+// (including se and the matching end element) together with its identity key.
+func readRecord(decoder *xml.Decoder, se xml.StartElement) ([]xml.Token, recordKey, error) {
+	h := sha256.New()
+	hashAttrs := func(name string, attrs []xml.Attr, wanted []string) {
+		fmt.Fprintf(h, "<%s", name)
+		for _, want := range wanted {
+			for _, a := range attrs {
+				if a.Name.Local == want {
+					// Length-prefix each value so no two attribute sets can
+					// produce the same byte stream.
+					fmt.Fprintf(h, " %s=%d:%s", want, len(a.Value), a.Value)
+				}
+			}
+		}
+	}
+	hashAttrs(se.Name.Local, se.Attr, identityAttrs[se.Name.Local])
+
+	tokens := []xml.Token{se.Copy()}
+	for depth := 1; depth > 0; {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, recordKey{}, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if t.Name.Local == "part" {
+				hashAttrs("part", t.Attr, partIdentityAttrs)
+			}
+		case xml.EndElement:
+			depth--
+		}
+		tokens = append(tokens, xml.CopyToken(token))
+	}
+
+	var key recordKey
+	h.Sum(key[:0])
+	return tokens, key, nil
+}
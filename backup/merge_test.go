@@ -0,0 +1,106 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBackup writes content to name inside dir and returns the full path.
+func writeBackup(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// countElements returns how many elements named local appear in doc.
+func countElements(t *testing.T, doc []byte, local string) int {
+	t.Helper()
+	d := xml.NewDecoder(bytes.NewReader(doc))
+	n := 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == local {
+			n++
+		}
+	}
+	return n
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	full := writeBackup(t, dir, "sms-full.xml", `<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>
+<smses count="3">
+  <sms address="+1" date="1000" type="1" body="hello" readable_date="Jan 1" contact_name="A"/>
+  <sms address="+1" date="2000" type="2" body="line1&#10;line2" contact_name="A"/>
+  <mms date="3000" address="+1" msg_box="1">
+    <parts><part seq="0" ct="image/jpeg" cl="a.jpg" data="YWFh"/></parts>
+  </mms>
+</smses>`)
+	// The incremental repeats two records with different volatile attributes
+	// and adds one new SMS and one MMS whose only difference is its payload.
+	incr := writeBackup(t, dir, "sms-incr.xml", `<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>
+<smses count="4">
+  <sms address="+1" date="1000" type="1" body="hello" readable_date="1 Jan" contact_name="Renamed"/>
+  <mms date="3000" address="+1" msg_box="1" read="1">
+    <parts><part seq="0" ct="image/jpeg" cl="a.jpg" data="YWFh"/></parts>
+  </mms>
+  <mms date="3000" address="+1" msg_box="1">
+    <parts><part seq="0" ct="image/jpeg" cl="a.jpg" data="YmJi"/></parts>
+  </mms>
+  <sms address="+2" date="4000" type="1" body="new"/>
+</smses>`)
+
+	var out bytes.Buffer
+	stats, err := Merge(&out, []string{full, incr})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if stats.Files != 2 || stats.Records != 5 || stats.Duplicates != 2 {
+		t.Errorf("stats = %+v, want {Files:2 Records:5 Duplicates:2}", stats)
+	}
+
+	doc := out.Bytes()
+	if !bytes.Contains(doc, []byte(`<smses count="5">`)) {
+		t.Errorf("merged root should carry count=5:\n%s", doc)
+	}
+	if n := countElements(t, doc, "sms"); n != 3 {
+		t.Errorf("merged output has %d <sms>, want 3", n)
+	}
+	if n := countElements(t, doc, "mms"); n != 2 {
+		t.Errorf("merged output has %d <mms>, want 2", n)
+	}
+	// First-seen wins: the full backup's contact_name is kept.
+	if strings.Contains(out.String(), "Renamed") {
+		t.Error("duplicate from later file should have been dropped")
+	}
+	// Attribute newlines must survive the round trip.
+	if !strings.Contains(out.String(), "line1&#xA;line2") {
+		t.Errorf("newline in body not preserved:\n%s", doc)
+	}
+}
+
+func TestMerge_RootMismatch(t *testing.T) {
+	dir := t.TempDir()
+	sms := writeBackup(t, dir, "sms-1.xml", `<smses count="0"></smses>`)
+	calls := writeBackup(t, dir, "calls-1.xml", `<calls count="0"></calls>`)
+
+	if _, err := Merge(&bytes.Buffer{}, []string{sms, calls}); err == nil {
+		t.Error("expected error merging <smses> with <calls>")
+	}
+}
+
+func TestMerge_NoInputs(t *testing.T) {
+	if _, err := Merge(&bytes.Buffer{}, nil); err == nil {
+		t.Error("expected error for empty input list")
+	}
+}
@@ -0,0 +1,27 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// ReadRecordAt decodes the record whose start tag is at offset in r, where
+// offset is a Record.Offset reported by a Scanner over the same input. It lets
+// a caller index a backup once and later fetch any message without rescanning
+// the file. The returned record's Offset is offset; its Source is empty.
+func ReadRecordAt(r io.ReaderAt, offset int64) (Record, error) {
+	s := NewScanner(io.NewSectionReader(r, offset, math.MaxInt64-offset))
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return Record{}, fmt.Errorf("reading record at offset %d: %w", offset, err)
+		}
+		return Record{}, fmt.Errorf("no record at offset %d", offset)
+	}
+	rec := s.Record()
+	if rec.Offset != 0 {
+		return Record{}, fmt.Errorf("offset %d does not start a record", offset)
+	}
+	rec.Offset = offset
+	return rec, nil
+}
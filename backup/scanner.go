@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+
+	"github.com/junkblocker/sbr/types"
+)
+
+// Kind identifies the type of a Record.
+type Kind int
+
+const (
+	KindSMS Kind = iota + 1
+	KindMMS
+	KindCall
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindSMS:
+		return "sms"
+	case KindMMS:
+		return "mms"
+	case KindCall:
+		return "call"
+	default:
+		return "unknown"
+	}
+}
+
+// Record is one top-level entry decoded from a backup file: a message from an
+// SMS backup or a call from a call log backup. Exactly one of SMS, MMS or Call
+// is set, according to Kind.
+type Record struct {
+	Kind Kind
+	// Source is the Scanner's Source at the time the record was read.
+	Source string
+	// Offset is the byte offset of the record's start tag in the input, as
+	// reported by xml.Decoder.InputOffset.
+	Offset int64
+	SMS    *types.SMS
+	MMS    *types.MMS
+	Call   *types.Call
+}
+
+// Scanner streams the records of a backup file one at a time, so that files
+// far larger than memory can be inspected. Its use mirrors bufio.Scanner:
+//
+//	s := backup.NewScanner(r)
+//	for s.Scan() {
+//		rec := s.Record()
+//		...
+//	}
+//	if err := s.Err(); err != nil {
+//		...
+//	}
+type Scanner struct {
+	// Source optionally names the input (typically its file path). It is
+	// copied into every Record so records can be traced back to their file.
+	Source string
+
+	decoder *xml.Decoder
+	rec     Record
+	err     error
+}
+
+// NewScanner returns a Scanner reading from r, through a Filter.
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{decoder: xml.NewDecoder(NewFilter(r))}
+}
+
+// Scan advances to the next record, which is then available through Record.
+// It returns false at the end of the input or on the first error.
+func (s *Scanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+	for {
+		offset := s.decoder.InputOffset()
+		token, err := s.decoder.Token()
+		if err != nil {
+			if err != io.EOF {
+				s.err = err
+			}
+			return false
+		}
+		se, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch se.Name.Local {
+		case "sms":
+			var sms types.SMS
+			if err = s.decoder.DecodeElement(&sms, &se); err != nil {
+				s.err = err
+				return false
+			}
+			s.rec = Record{Kind: KindSMS, Source: s.Source, Offset: offset, SMS: &sms}
+			return true
+		case "mms":
+			var mms types.MMS
+			if err = s.decoder.DecodeElement(&mms, &se); err != nil {
+				s.err = err
+				return false
+			}
+			s.rec = Record{Kind: KindMMS, Source: s.Source, Offset: offset, MMS: &mms}
+			return true
+		case "call":
+			var call types.Call
+			if err = s.decoder.DecodeElement(&call, &se); err != nil {
+				s.err = err
+				return false
+			}
+			s.rec = Record{Kind: KindCall, Source: s.Source, Offset: offset, Call: &call}
+			return true
+		}
+	}
+}
+
+// Record returns the record decoded by the most recent call to Scan.
+func (s *Scanner) Record() Record {
+	return s.rec
+}
+
+// Err returns the first non-EOF error encountered by Scan.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// ScanFile streams every record of the backup file at path to fn, with the
+// record's Source set to path.
+func ScanFile(path string, fn func(Record)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := NewScanner(f)
+	s.Source = path
+	for s.Scan() {
+		fn(s.Record())
+	}
+	return s.Err()
+}
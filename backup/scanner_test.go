@@ -0,0 +1,152 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanner(t *testing.T) {
+	doc := `<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>
+<smses count="2">
+  <sms address="+1" date="1000" type="2" body="hi" contact_name="Ann"/>
+  <mms date="2000" address="+2" contact_name="Bob">
+    <parts><part seq="0" ct="image/png" cl="x.png" data="eA=="/></parts>
+  </mms>
+</smses>`
+
+	s := NewScanner(strings.NewReader(doc))
+	var recs []Record
+	for s.Scan() {
+		recs = append(recs, s.Record())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+
+	sms := recs[0]
+	if sms.Kind != KindSMS || sms.SMS.Body != "hi" || sms.SMS.Type != 2 || sms.SMS.ContactName != "Ann" {
+		t.Errorf("sms record = %+v / %+v", sms, sms.SMS)
+	}
+	if !strings.HasPrefix(doc[sms.Offset:], "<sms ") {
+		t.Errorf("sms Offset %d does not point at <sms: %q", sms.Offset, doc[sms.Offset:sms.Offset+10])
+	}
+
+	mms := recs[1]
+	if mms.Kind != KindMMS || len(mms.MMS.Parts) != 1 || mms.MMS.Parts[0].Filename != "x.png" {
+		t.Errorf("mms record = %+v / %+v", mms, mms.MMS)
+	}
+	if !strings.HasPrefix(doc[mms.Offset:], "<mms ") {
+		t.Errorf("mms Offset %d does not point at <mms", mms.Offset)
+	}
+}
+
+func TestScanFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sms-1.xml")
+	doc := `<smses><sms address="+1" date="1000" type="1" body="a"/><sms address="+1" date="2000" type="1" body="b"/></smses>`
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var bodies []string
+	err := ScanFile(path, func(rec Record) {
+		if rec.Source != path {
+			t.Errorf("Source = %q, want %q", rec.Source, path)
+		}
+		bodies = append(bodies, rec.SMS.Body)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(bodies, ",") != "a,b" {
+		t.Errorf("bodies = %q", bodies)
+	}
+	if err := ScanFile(filepath.Join(t.TempDir(), "missing.xml"), func(Record) {}); err == nil {
+		t.Error("no error for a missing file")
+	}
+}
+
+func TestScanner_SyntaxError(t *testing.T) {
+	s := NewScanner(strings.NewReader(`<smses><sms address="+1" date="1"/><sms oops`))
+	n := 0
+	for s.Scan() {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("scanned %d records before the error, want 1", n)
+	}
+	if s.Err() == nil {
+		t.Error("expected a syntax error")
+	}
+}
+
+func TestReadRecordAt(t *testing.T) {
+	doc := `<smses>
+  <sms address="+1" date="1000" type="2" body="hi"/>
+  <mms date="2000" address="+2"><parts><part seq="0" ct="image/png" cl="x.png" data="eA=="/></parts></mms>
+</smses>`
+	var offsets []int64
+	s := NewScanner(strings.NewReader(doc))
+	for s.Scan() {
+		offsets = append(offsets, s.Record().Offset)
+	}
+
+	r := strings.NewReader(doc)
+	rec, err := ReadRecordAt(r, offsets[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Kind != KindMMS || rec.Offset != offsets[1] || rec.MMS.Parts[0].Data != "eA==" {
+		t.Errorf("record = %+v", rec)
+	}
+	if rec, err = ReadRecordAt(r, offsets[0]); err != nil || rec.SMS.Body != "hi" {
+		t.Errorf("ReadRecordAt(sms) = %+v, %v", rec, err)
+	}
+	if _, err = ReadRecordAt(r, offsets[1]+3); err == nil {
+		t.Error("ReadRecordAt accepted an offset inside a record")
+	}
+}
+
+func TestScanner_Calls(t *testing.T) {
+	doc := `<calls count="1">
+  <call number="+15550001" duration="42" date="1000" type="2" presentation="1" contact_name="Ann"/>
+</calls>`
+	s := NewScanner(strings.NewReader(doc))
+	if !s.Scan() {
+		t.Fatalf("Scan = false, err %v", s.Err())
+	}
+	rec := s.Record()
+	if rec.Kind != KindCall || rec.Call.Number != "+15550001" || rec.Call.Duration != "42" || rec.Call.Type.String() != "outgoing" || rec.Call.ContactName != "Ann" {
+		t.Errorf("call record = %+v / %+v", rec, rec.Call)
+	}
+}
+
+func TestRecordID(t *testing.T) {
+	scan := func(doc string) []Record {
+		var recs []Record
+		s := NewScanner(strings.NewReader(doc))
+		for s.Scan() {
+			recs = append(recs, s.Record())
+		}
+		return recs
+	}
+	full := scan(`<smses>
+  <sms address="+1" date="1000" type="2" body="hi" readable_date="a" contact_name="Ann"/>
+  <sms address="+1" date="1000" type="2" body="hi!"/>
+  <mms date="2000" address="+2" m_id="x"><parts><part ct="image/png" data="eA=="/></parts></mms>
+</smses>`)
+	incremental := scan(`<smses>
+  <mms date="2000" address="+2" m_id="x" read="1"><parts><part ct="image/png" data="eA=="/></parts></mms>
+  <sms address="+1" date="1000" type="2" body="hi" readable_date="b" contact_name="Ann Lee"/>
+</smses>`)
+
+	if full[0].ID() != incremental[1].ID() || full[2].ID() != incremental[0].ID() {
+		t.Error("the same record has different IDs in two backups")
+	}
+	if full[0].ID() == full[1].ID() {
+		t.Error("different records share an ID")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/thread"
+	"github.com/junkblocker/sbr/types"
+	"github.com/junkblocker/sbr/vcard"
+)
+
+var contactsCmd = &command{
+	name:    "contacts",
+	args:    "<file_or_directory_path>... <output_dir>",
+	summary: "Export contact cards shared in MMS as one merged contacts.vcf and contacts.json.",
+	minArgs: 2,
+	maxArgs: -1,
+	run:     runContacts,
+}
+
+// sharedCards are the cards found in one MMS.
+type sharedCards struct {
+	source string
+	offset int64
+	cards  []*vcard.Card
+}
+
+func runContacts(env *cmdEnv, args []string) int {
+	resolver, err := env.resolver()
+	if err != nil {
+		fmt.Fprintln(env.stderr, "sbr contacts:", err)
+		return exitUsage
+	}
+
+	inPaths, outPath := args[:len(args)-1], args[len(args)-1]
+	if err = ensureOutputDir(outPath); err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+
+	// The thread builder works out who sent each MMS; the cards are matched
+	// back to their messages by location once threads are resolved.
+	b := thread.NewBuilder(resolver)
+	var shared []sharedCards
+	err = scanBackups(env, inPaths, nil, func(rec backup.Record) {
+		b.Add(rec)
+		if rec.Kind != backup.KindMMS {
+			return
+		}
+		if cards := mmsCards(env, rec.MMS); len(cards) > 0 {
+			shared = append(shared, sharedCards{rec.Source, rec.Offset, cards})
+		}
+	})
+	if err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+
+	type location struct {
+		source string
+		offset int64
+	}
+	messages := make(map[location]*thread.Message)
+	titles := make(map[*thread.Message]string)
+	for _, t := range b.Threads() {
+		for _, m := range t.Messages {
+			messages[location{m.Source, m.Offset}] = m
+			titles[m] = t.Title()
+		}
+	}
+
+	var all []*vcard.Card
+	for _, s := range shared {
+		m := messages[location{s.source, s.offset}]
+		for _, c := range s.cards {
+			// Write numbers in the same E.164 form used everywhere else.
+			for i, tel := range c.Phones {
+				c.Phones[i].Value = string(resolver.Normalise(types.PhoneNumber(tel.Value)))
+			}
+			if m != nil {
+				c.Notes = append(c.Notes, shareNote(m, titles[m]))
+			}
+			all = append(all, c)
+		}
+	}
+	merged := vcard.Merge(all, func(tel string) string {
+		return string(resolver.Normalise(types.PhoneNumber(tel)))
+	})
+
+	err = writeExportFile(filepath.Join(outPath, "contacts.vcf"), func(w io.Writer) error {
+		return vcard.Write(w, merged)
+	})
+	if err == nil {
+		err = writeExportFile(filepath.Join(outPath, "contacts.json"), func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(merged)
+		})
+	}
+	if err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+
+	fmt.Fprintf(env.stdout, "Exported %d contact(s) from %d shared card(s) to %s\n", len(merged), len(all), outPath)
+	return exitOK
+}
+
+// mmsCards parses every vCard attachment of m. Unreadable attachments are
+// reported and skipped.
+func mmsCards(env *cmdEnv, m *types.MMS) []*vcard.Card {
+	var cards []*vcard.Card
+	for _, p := range m.Parts {
+		if !vcard.IsContentType(p.ContentType) {
+			continue
+		}
+		raw := []byte(p.Text)
+		if p.Text == "" || p.Text == "null" {
+			var err error
+			if raw, err = base64.StdEncoding.DecodeString(p.Data); err != nil {
+				fmt.Fprintln(env.stderr, "Error decoding vCard:", err)
+				continue
+			}
+			// Convert non-UTF-8 payloads; vcard.Parse handles BOMs and
+			// per-property CHARSET itself.
+			if text, err := processor.DecodeCharset(raw, p.Charset); err == nil {
+				raw = []byte(text)
+			}
+		}
+		parsed, err := vcard.Parse(raw)
+		if err != nil {
+			env.log.Debug("parsing vCard", "err", err)
+			continue
+		}
+		cards = append(cards, parsed...)
+	}
+	return cards
+}
+
+// shareNote records who shared a card and when.
+func shareNote(m *thread.Message, threadTitle string) string {
+	when := m.Time.Format("2006-01-02 15:04:05")
+	if m.Direction == thread.Sent {
+		return fmt.Sprintf("Shared by me with %s on %s", threadTitle, when)
+	}
+	sender := "(Unknown)"
+	if m.Sender != nil {
+		sender = m.Sender.Label()
+		if len(m.Sender.Addresses) > 0 && string(m.Sender.Addresses[0]) != sender {
+			sender += fmt.Sprintf(" (%s)", m.Sender.Addresses[0])
+		}
+	}
+	return fmt.Sprintf("Shared by %s on %s", sender, when)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/export"
+	"github.com/junkblocker/sbr/thread"
+)
+
+var exportFormat string
+
+var exportCmd = &command{
+	name:    "export",
+	args:    "<file_or_directory_path>... <output_dir>",
+	summary: "Export conversations as one text or HTML document per thread, or one e-mail per message.",
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&exportFormat, "format", "text", "output `format`: text, html or eml")
+	},
+	minArgs: 2,
+	maxArgs: -1,
+	run:     runExport,
+}
+
+func runExport(env *cmdEnv, args []string) int {
+	var (
+		ext   string
+		write func(io.Writer, *thread.Thread) error
+	)
+	switch exportFormat {
+	case "text":
+		ext, write = ".txt", export.WriteText
+	case "html":
+		ext, write = ".html", export.WriteHTML
+	case "eml":
+	default:
+		fmt.Fprintf(env.stderr, "sbr export: unknown format %q\n", exportFormat)
+		return exitUsage
+	}
+
+	resolver, err := env.resolver()
+	if err != nil {
+		fmt.Fprintln(env.stderr, "sbr export:", err)
+		return exitUsage
+	}
+
+	inPaths, outPath := args[:len(args)-1], args[len(args)-1]
+	if err = ensureOutputDir(outPath); err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+
+	b := thread.NewBuilder(resolver)
+	if err = scanBackups(env, inPaths, nil, b.Add); err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+
+	threads := b.Threads()
+	if exportFormat == "eml" {
+		if err = exportEML(env, inPaths, outPath, threads); err != nil {
+			fmt.Fprintln(env.stderr, "Error:", err)
+			return exitFailure
+		}
+		fmt.Fprintf(env.stdout, "Exported %d conversation(s) to %s\n", len(threads), outPath)
+		return exitOK
+	}
+	var index []export.IndexEntry
+	for _, t := range threads {
+		name := export.Filename(t, ext)
+		if err = writeExportFile(filepath.Join(outPath, name), func(w io.Writer) error { return write(w, t) }); err != nil {
+			fmt.Fprintln(env.stderr, "Error:", err)
+			return exitFailure
+		}
+		index = append(index, export.IndexEntry{Thread: t, Href: name})
+	}
+	if exportFormat == "html" {
+		err = writeExportFile(filepath.Join(outPath, "index.html"), func(w io.Writer) error {
+			return export.WriteHTMLIndex(w, index)
+		})
+		if err != nil {
+			fmt.Fprintln(env.stderr, "Error:", err)
+			return exitFailure
+		}
+	}
+
+	fmt.Fprintf(env.stdout, "Exported %d conversation(s) to %s\n", len(threads), outPath)
+	return exitOK
+}
+
+// exportEML writes every message of threads as an .eml file in a directory
+// per thread. Threads only hold message metadata, so the backups are scanned a
+// second time to embed MMS payloads.
+func exportEML(env *cmdEnv, inPaths []string, outPath string, threads []*thread.Thread) error {
+	type located struct {
+		t     *thread.Thread
+		m     *thread.Message
+		index int
+	}
+	type recordKey struct {
+		source string
+		offset int64
+	}
+	byRecord := make(map[recordKey]located)
+	for _, t := range threads {
+		dir := filepath.Join(outPath, export.Filename(t, ""))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		for i, m := range t.Messages {
+			byRecord[recordKey{m.Source, m.Offset}] = located{t, m, i + 1}
+		}
+	}
+
+	var writeErr error
+	err := scanBackups(env, inPaths, nil, func(rec backup.Record) {
+		loc, ok := byRecord[recordKey{rec.Source, rec.Offset}]
+		if !ok || writeErr != nil {
+			return
+		}
+		path := filepath.Join(outPath, export.Filename(loc.t, ""), export.EMLFilename(loc.m, loc.index))
+		writeErr = writeExportFile(path, func(w io.Writer) error {
+			return export.WriteEML(w, loc.t, loc.m, rec)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return writeErr
+}
+
+// writeExportFile creates path and fills it with render.
+func writeExportFile(path string, render func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = render(f); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/junkblocker/sbr/contact"
+	"github.com/junkblocker/sbr/gallery"
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/types"
+)
+
+// extractFlags holds the processor options shared by extract and verify, so
+// that verify checks exactly the files an identically-flagged extract writes.
+var extractFlags struct {
+	saveText bool
+	slides   bool
+	lenient  bool
+	// location and subSecond are the -tz and -subsecond naming options.
+	location  *time.Location
+	subSecond int
+	template  *processor.Template
+}
+
+func setExtractFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&extractFlags.saveText, "text", false, "also save each MMS's text to <date>.txt next to its attachments")
+	fs.BoolVar(&extractFlags.slides, "slides", false, "insert each attachment's SMIL slide number into its filename (<date>-slideNN-<name>)")
+	fs.BoolVar(&extractFlags.lenient, "lenient", false, "recover from damaged or truncated backups, skipping what cannot be read instead of stopping")
+	extractFlags.location, extractFlags.subSecond = nil, 0
+	fs.Func("tz", "name files in time `zone` local (the default), UTC or an IANA name such as Europe/London", locationFlag(&extractFlags.location))
+	fs.Func("subsecond", "add `n` (0-3) digits of the fraction of a second to file dates (default 0)", subSecondFlag(&extractFlags.subSecond))
+	extractFlags.template = nil
+	fs.Func("template", "name attachments after `pattern`, e.g. {date:2006}/{contact}/{date}-{time}-{leaf} (see README)", templateFlag(&extractFlags.template))
+}
+
+// autoBool is a boolean flag whose default is only known when the command
+// runs.
+type autoBool struct {
+	value, set bool
+}
+
+func (b *autoBool) String() string {
+	if b == nil || !b.set {
+		return ""
+	}
+	return strconv.FormatBool(b.value)
+}
+
+func (b *autoBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	b.value, b.set = v, true
+	return nil
+}
+
+func (b *autoBool) IsBoolFlag() bool { return true }
+
+// get returns the flag's value, or def if it was not given.
+func (b *autoBool) get(def bool) bool {
+	if !b.set {
+		return def
+	}
+	return b.value
+}
+
+// templateFlag returns a flag.Func parser of a -template value into *t.
+func templateFlag(t **processor.Template) func(string) error {
+	return func(s string) error {
+		tmpl, err := processor.ParseTemplate(s)
+		if err != nil {
+			return err
+		}
+		*t = tmpl
+		return nil
+	}
+}
+
+// locationFlag returns a flag.Func parser of a -tz value into *loc, which is
+// nil for the host's local zone.
+func locationFlag(loc **time.Location) func(string) error {
+	return func(s string) error {
+		if strings.EqualFold(s, "local") {
+			*loc = nil
+			return nil
+		}
+		l, err := time.LoadLocation(s)
+		if err != nil {
+			return fmt.Errorf("unknown time zone %q", s)
+		}
+		*loc = l
+		return nil
+	}
+}
+
+// subSecondFlag returns a flag.Func parser of a -subsecond value into *n.
+func subSecondFlag(n *int) func(string) error {
+	return func(s string) error {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 || v > 3 {
+			return fmt.Errorf("want 0 to 3 digits, got %q", s)
+		}
+		*n = v
+		return nil
+	}
+}
+
+// processorOptions builds processor.Options from the common and extract
+// flags. Its error is a usage error.
+func processorOptions(env *cmdEnv) (processor.Options, error) {
+	if extractFlags.slides && extractFlags.template != nil {
+		return processor.Options{}, errSlidesTemplate
+	}
+	n, err := contact.NewNormaliser(env.country)
+	if err != nil {
+		return processor.Options{}, err
+	}
+	return processor.Options{
+		DebugLevel:      env.debugLevel,
+		Logger:          env.log,
+		SaveText:        extractFlags.saveText,
+		SlideNumbers:    extractFlags.slides,
+		Lenient:         extractFlags.lenient,
+		Location:        extractFlags.location,
+		SubSecondDigits: extractFlags.subSecond,
+		Template:        extractFlags.template,
+		Normaliser:      n,
+	}, nil
+}
+
+// errSlidesTemplate rejects -slides with -template, which would ignore it.
+var errSlidesTemplate = errors.New("-slides does not apply to -template names; use the {slide} field instead")
+
+var (
+	extractGallery bool
+	// extractForce reprocesses files the output directory's ledger records as
+	// already extracted.
+	extractForce bool
+	// extractProgress defaults to whether standard error is a terminal.
+	extractProgress autoBool
+	// extractSink selects a directory, an archive or a bucket as the output.
+	extractSink string
+)
+
+var extractCmd = &command{
+	name:    "extract",
+	args:    "<file_or_directory_path> <output_dir_archive_or_s3_url>",
+	summary: "Extract MMS attachments from a backup file or directory of sms-*.xml backups.",
+	setFlags: func(fs *flag.FlagSet) {
+		setExtractFlags(fs)
+		fs.BoolVar(&extractGallery, "gallery", false, "also write image thumbnails to .thumbs and a gallery.html contact sheet")
+		fs.BoolVar(&extractForce, "force", false, "process every backup, even those already extracted unchanged")
+		fs.StringVar(&extractSink, "sink", "auto", "write to a `kind` of output: dir, tar, tar.gz, zip or s3; auto picks an archive by the output's extension (.tar, .tar.gz, .tgz, .zip) and s3 for s3://bucket/prefix")
+		fs.StringVar(&s3Output.endpoint, "s3-endpoint", "", "upload an s3:// output to the S3-compatible service at `url`, e.g. http://localhost:9000 (default AWS)")
+		fs.StringVar(&s3Output.region, "s3-region", "", "sign S3 requests for `region` (default $AWS_REGION or us-east-1)")
+		extractProgress = autoBool{}
+		fs.Var(&extractProgress, "progress", "show progress on standard error: a live bar on a terminal, a line every 10s otherwise (default true on a terminal)")
+	},
+	minArgs: 2,
+	maxArgs: 2,
+	run:     runExtract,
+}
+
+func runExtract(env *cmdEnv, args []string) int {
+	opts, err := processorOptions(env)
+	if err != nil {
+		fmt.Fprintln(env.stderr, "sbr extract:", err)
+		return exitUsage
+	}
+	opts.Force = extractForce
+
+	inPath := args[0]
+	outPath := args[1]
+
+	format, err := archiveFormat(extractSink, outPath)
+	if err != nil {
+		fmt.Fprintln(env.stderr, "sbr extract:", err)
+		return exitUsage
+	}
+	if format != "" && extractGallery {
+		fmt.Fprintln(env.stderr, "sbr extract: -gallery needs an output directory")
+		return exitUsage
+	}
+	if format == outputS3 {
+		// A bucket keeps no ledger either: each object is checked for instead.
+		if opts.Sink, err = newS3Sink(outPath); err != nil {
+			fmt.Fprintln(env.stderr, "sbr extract:", err)
+			return exitUsage
+		}
+	}
+
+	var (
+		resolver *contact.Resolver
+		mu       sync.Mutex
+		images   []processor.Saved
+	)
+	if extractGallery {
+		var err error
+		if resolver, err = env.resolver(); err != nil {
+			fmt.Fprintln(env.stderr, "sbr extract:", err)
+			return exitUsage
+		}
+		opts.OnSaved = func(s processor.Saved) {
+			if gallery.IsImage(s.ContentType) {
+				mu.Lock()
+				images = append(images, s)
+				mu.Unlock()
+			}
+		}
+	}
+
+	inPathInfo, err := os.Stat(inPath)
+	if err != nil {
+		fmt.Fprintf(env.stderr, "Error accessing path %s: %v\n", inPath, err)
+		return exitFailure
+	}
+	if format == "" {
+		if err = ensureOutputDir(outPath); err != nil {
+			fmt.Fprintln(env.stderr, "Error:", err)
+			return exitFailure
+		}
+	}
+
+	var meter *progressMeter
+	if extractProgress.get(isTerminal(env.stderr)) {
+		files, err := processor.FindBackupFiles(inPath)
+		if err != nil {
+			fmt.Fprintln(env.stderr, "Error:", err)
+			return exitFailure
+		}
+		meter = newProgressMeter(env.stderr, files)
+		opts.OnProgress = meter.update
+		meter.Start()
+	}
+
+	// An archive holds only what this run writes, so it keeps no ledger.
+	var archive *archiveOutput
+	if format != "" && format != outputS3 {
+		if archive, err = createArchive(outPath, format); err != nil {
+			if meter != nil {
+				meter.Stop()
+			}
+			fmt.Fprintln(env.stderr, "Error:", err)
+			return exitFailure
+		}
+		opts.Sink = archive.sink
+	}
+
+	var (
+		wg     sync.WaitGroup
+		failed int64
+	)
+	if inPathInfo.IsDir() {
+		failures := processor.ProcessDirectory(&wg, inPath, outPath, opts)
+		wg.Wait()
+		failed = failures.Load()
+	} else if processor.ProcessFileFromPath(inPath, outPath, opts) != nil {
+		failed = 1
+	}
+	if meter != nil {
+		meter.Stop()
+	}
+	if archive != nil {
+		if err := archive.commit(); err != nil {
+			fmt.Fprintln(env.stderr, "Error:", err)
+			return exitFailure
+		}
+	}
+
+	if extractGallery && !buildGallery(env, outPath, images, resolver) {
+		return exitFailure
+	}
+	if failed > 0 {
+		// The errors themselves have been logged as they happened.
+		fmt.Fprintf(env.stderr, "Error: %d backup file(s) not extracted completely\n", failed)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// buildGallery writes thumbnails and the contact sheet for every image in
+// the output directory. The gallery index keeps the senders of images earlier
+// runs saved, so backups the ledger skips need not be read again; this run's
+// images are added to it. Senders are resolved only once every image is
+// known, so a contact name recorded on any message applies to all of them.
+// It reports whether the index could be read and written.
+func buildGallery(env *cmdEnv, outPath string, images []processor.Saved, resolver *contact.Resolver) bool {
+	index, err := gallery.OpenIndex(outPath)
+	if err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return false
+	}
+	for _, s := range images {
+		rel, err := filepath.Rel(outPath, s.Path)
+		if err != nil {
+			continue
+		}
+		index.Add(gallery.Record{
+			Path:        filepath.ToSlash(rel),
+			Time:        s.Time,
+			Sender:      s.Sender,
+			Sent:        s.Sent,
+			Address:     s.Address,
+			ContactName: s.ContactName,
+		})
+	}
+	records, err := index.Sync()
+	if err == nil {
+		err = index.Save()
+	}
+	if err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return false
+	}
+
+	for _, r := range records {
+		resolver.Observe(types.PhoneNumber(r.Address), r.ContactName)
+	}
+	entries := make([]gallery.Entry, len(records))
+	for i, r := range records {
+		sender := "Me"
+		if !r.Sent {
+			sender = "(Unknown)"
+			if r.Sender != "" {
+				sender = resolver.Resolve(types.PhoneNumber(r.Sender)).Label()
+			}
+		}
+		entries[i] = gallery.Entry{Path: filepath.Join(outPath, filepath.FromSlash(r.Path)), Time: r.Time, Sender: sender}
+	}
+
+	n, errs := gallery.Build(outPath, entries, gallery.ThumbSize)
+	for _, err := range errs {
+		fmt.Fprintln(env.stderr, "Error creating thumbnail:", err)
+	}
+	fmt.Fprintf(env.stdout, "Gallery of %d image(s) written to %s\n", n, filepath.Join(outPath, gallery.PageName))
+	return true
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const goodBackup = `<?xml version='1.0'?><smses>
+  <mms date="1705318245000" address="+1"><parts>
+    <part seq="0" ct="image/png" cl="a.png" data="UA=="/>
+  </parts></mms>
+</smses>`
+
+// corruptBackup stops in the middle of a message.
+const corruptBackup = `<?xml version='1.0'?><smses><mms date="bad" unclosed`
+
+func runSbr(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stderr.String()
+}
+
+func writeBackup(t *testing.T, dir, name, doc string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractExitCode(t *testing.T) {
+	t.Run("good file", func(t *testing.T) {
+		in := writeBackup(t, t.TempDir(), "sms-1.xml", goodBackup)
+		if code, stderr := runSbr(t, "extract", "-progress=false", in, t.TempDir()); code != exitOK {
+			t.Errorf("exit %d, want %d; stderr:\n%s", code, exitOK, stderr)
+		}
+	})
+
+	t.Run("corrupt file", func(t *testing.T) {
+		in := writeBackup(t, t.TempDir(), "sms-1.xml", corruptBackup)
+		code, stderr := runSbr(t, "extract", "-progress=false", in, t.TempDir())
+		if code != exitFailure {
+			t.Errorf("exit %d, want %d", code, exitFailure)
+		}
+		if !strings.Contains(stderr, "not extracted completely") {
+			t.Errorf("stderr does not report the failure:\n%s", stderr)
+		}
+	})
+
+	t.Run("corrupt file in directory", func(t *testing.T) {
+		in := t.TempDir()
+		writeBackup(t, in, "sms-1.xml", goodBackup)
+		writeBackup(t, in, "sms-2.xml", corruptBackup)
+		out := t.TempDir()
+		if code, _ := runSbr(t, "extract", "-progress=false", "-tz", "UTC", in, out); code != exitFailure {
+			t.Errorf("exit %d, want %d", code, exitFailure)
+		}
+		// The good backup is extracted all the same.
+		if _, err := os.Stat(filepath.Join(out, "2024-01-15-113045-a.png")); err != nil {
+			t.Errorf("good backup not extracted: %v", err)
+		}
+	})
+}
+
+func TestExtractSlidesWithTemplate(t *testing.T) {
+	in := writeBackup(t, t.TempDir(), "sms-1.xml", goodBackup)
+	code, stderr := runSbr(t, "extract", "-progress=false", "-slides", "-template", "{date}-{leaf}", in, t.TempDir())
+	if code != exitUsage {
+		t.Errorf("exit %d, want %d", code, exitUsage)
+	}
+	if !strings.Contains(stderr, "{slide}") {
+		t.Errorf("stderr does not point at {slide}:\n%s", stderr)
+	}
+}
+
+func TestExtractProgressDefault(t *testing.T) {
+	in := writeBackup(t, t.TempDir(), "sms-1.xml", goodBackup)
+	// Standard error is not a terminal here, so progress is off unless asked
+	// for.
+	if _, stderr := runSbr(t, "extract", in, t.TempDir()); strings.Contains(stderr, "Done in") {
+		t.Errorf("progress shown by default off a terminal:\n%s", stderr)
+	}
+	if _, stderr := runSbr(t, "extract", "-progress", in, t.TempDir()); !strings.Contains(stderr, "Done in") {
+		t.Errorf("-progress shows no progress:\n%s", stderr)
+	}
+}
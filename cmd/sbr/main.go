@@ -1,48 +1,238 @@
+// Command sbr works with backups produced by the SMS Backup & Restore Android
+// app: extracting MMS attachments (once, or continuously as new backups
+// arrive), reporting statistics, exporting conversations, shared contacts and
+// SQL tables, searching message text, browsing backups in a web browser,
+// verifying an extracted tree, renaming one to a new naming convention and
+// merging overlapping backups.
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
-	"sync"
+	"strings"
 
+	"github.com/junkblocker/sbr/contact"
 	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/types"
 )
 
-var debugFlag = flag.Uint("d", 0, "Be more verbose")
+// Exit codes shared by every command.
+const (
+	exitOK      = 0 // success
+	exitFailure = 1 // the command ran but failed (I/O error, verification failure, ...)
+	exitUsage   = 2 // bad flags or arguments
+)
+
+// command describes one sbr subcommand.
+type command struct {
+	name    string
+	args    string // positional argument synopsis shown in usage
+	summary string // one-line description shown in the command list
+	// setFlags registers the command's own flags on fs. It may be nil.
+	setFlags func(fs *flag.FlagSet)
+	// minArgs and maxArgs bound the number of positional arguments; maxArgs < 0
+	// means unbounded.
+	minArgs, maxArgs int
+	run              func(env *cmdEnv, args []string) int
+}
+
+// cmdEnv carries the flags common to every command.
+type cmdEnv struct {
+	debugLevel uint
+	country    string
+	owner      string
+	logFormat  string
+	logFile    string
+	stdout     io.Writer
+	stderr     io.Writer
+	// log receives diagnostics, as -log-format and -log-file direct, at the
+	// level -d selects.
+	log *slog.Logger
+}
+
+// openLog sets env.log up from the -log-format and -log-file flags, which
+// runCommand has checked. The returned function closes the log file, if any.
+func (env *cmdEnv) openLog() (closeLog func() error, err error) {
+	w, closeLog := env.stderr, func() error { return nil }
+	if env.logFile != "" {
+		f, err := os.OpenFile(env.logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening log file: %w", err)
+		}
+		w, closeLog = f, f.Close
+	}
+	opts := &slog.HandlerOptions{Level: processor.DebugLogLevel(env.debugLevel)}
+	if env.logFormat == "json" {
+		env.log = slog.New(slog.NewJSONHandler(w, opts))
+	} else {
+		env.log = slog.New(slog.NewTextHandler(w, opts))
+	}
+	return closeLog, nil
+}
+
+// resolver builds a contact resolver from the -country and -owner flags.
+func (env *cmdEnv) resolver() (*contact.Resolver, error) {
+	n, err := contact.NewNormaliser(env.country)
+	if err != nil {
+		return nil, err
+	}
+	r := contact.NewResolver(n)
+	for _, a := range strings.Split(env.owner, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			r.SetOwner(types.PhoneNumber(a))
+		}
+	}
+	return r, nil
+}
+
+// commands is the table of subcommands, in the order they are listed by help.
+var commands = []*command{
+	extractCmd,
+	watchCmd,
+	statsCmd,
+	exportCmd,
+	contactsCmd,
+	searchCmd,
+	sqlCmd,
+	serveCmd,
+	verifyCmd,
+	migrateCmd,
+	mergeCmd,
+}
+
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
 
 func main() {
-	flag.Parse()
-	if flag.NArg() < 2 {
-		fmt.Println("Usage: sbr [-d 0,1,2,3] <file_or_directory_path> <output_dir>")
-		os.Exit(1)
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run dispatches args to a subcommand and returns the process exit code.
+//
+// For backwards compatibility with scripts written against the original
+// single-purpose tool, an invocation whose first argument is not a command
+// name (e.g. "sbr -d 1 in out" or "sbr in out") is treated as "sbr extract".
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stderr)
+		return exitUsage
 	}
 
-	opts := processor.Options{DebugLevel: *debugFlag}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			if c := lookupCommand(args[1]); c != nil {
+				newFlagSet(c, &cmdEnv{}, stdout).Usage()
+				return exitOK
+			}
+			fmt.Fprintf(stderr, "sbr: unknown command %q\n", args[1])
+			return exitUsage
+		}
+		printUsage(stdout)
+		return exitOK
+	}
 
-	inPath := flag.Arg(0)
-	outPath := flag.Arg(1)
+	c := lookupCommand(args[0])
+	if c == nil {
+		c = extractCmd
+	} else {
+		args = args[1:]
+	}
+	return runCommand(c, args, stdout, stderr)
+}
 
-	inPathInfo, err := os.Stat(inPath)
+// runCommand parses the flags and positional arguments for c and runs it.
+func runCommand(c *command, args []string, stdout, stderr io.Writer) int {
+	env := &cmdEnv{stdout: stdout, stderr: stderr}
+	fs := newFlagSet(c, env, stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	n := fs.NArg()
+	if n < c.minArgs || (c.maxArgs >= 0 && n > c.maxArgs) {
+		fmt.Fprintf(stderr, "sbr %s: wrong number of arguments\n", c.name)
+		fs.Usage()
+		return exitUsage
+	}
+	if env.logFormat != "text" && env.logFormat != "json" {
+		fmt.Fprintf(stderr, "sbr %s: -log-format must be text or json\n", c.name)
+		return exitUsage
+	}
+	closeLog, err := env.openLog()
 	if err != nil {
-		log.Fatalf("Error accessing path %s: %v\n", inPath, err)
+		fmt.Fprintf(stderr, "sbr %s: %v\n", c.name, err)
+		return exitFailure
+	}
+	code := c.run(env, fs.Args())
+	if err = closeLog(); err != nil {
+		fmt.Fprintf(stderr, "sbr %s: closing log file: %v\n", c.name, err)
+		code = max(code, exitFailure)
 	}
+	return code
+}
+
+// newFlagSet builds the flag set for c, registering the common flags into env
+// followed by the command's own flags.
+func newFlagSet(c *command, env *cmdEnv, out io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("sbr "+c.name, flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.UintVar(&env.debugLevel, "d", 0, "debug verbosity `level` (0 = quiet, 3 = very verbose)")
+	fs.StringVar(&env.country, "country", "", "ISO 3166 `code` of the default country for numbers written without a country code (e.g. US, GB)")
+	fs.StringVar(&env.owner, "owner", "", "comma-separated `numbers` belonging to the backup owner, excluded from contact grouping")
+	fs.StringVar(&env.logFormat, "log-format", "text", "diagnostics `format`: text or json")
+	fs.StringVar(&env.logFile, "log-file", "", "append diagnostics to `file` instead of standard error")
+	if c.setFlags != nil {
+		c.setFlags(fs)
+	}
+	fs.Usage = func() {
+		w := fs.Output()
+		fmt.Fprintf(w, "Usage: sbr %s [flags] %s\n\n%s\n\nFlags:\n", c.name, c.args, c.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
 
-	outPathInfo, err := os.Stat(outPath)
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: sbr <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	width := 0
+	for _, c := range commands {
+		width = max(width, len(c.name))
+	}
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "sbr help <command>" for details on a command.`)
+	fmt.Fprintln(w, `"sbr [-d N] <input> <output>" is shorthand for "sbr extract".`)
+}
+
+// ensureOutputDir creates outPath if it does not exist and checks that it is a
+// directory.
+func ensureOutputDir(outPath string) error {
+	info, err := os.Stat(outPath)
 	if err != nil {
-		if err = os.Mkdir(outPath, 0755); err != nil {
-			log.Fatalf("Error creating directory %s: %v\n", outPath, err)
+		if err = os.MkdirAll(outPath, 0755); err != nil {
+			return fmt.Errorf("creating directory %s: %w", outPath, err)
 		}
-	} else if !outPathInfo.IsDir() {
-		log.Fatalf("Output path %s is not a directory\n", outPath)
+		return nil
 	}
-
-	var wg sync.WaitGroup
-	if inPathInfo.IsDir() {
-		processor.ProcessDirectory(&wg, inPath, outPath, opts)
-	} else {
-		processor.ProcessFileFromPath(inPath, outPath, opts)
+	if !info.IsDir() {
+		return fmt.Errorf("output path %s is not a directory", outPath)
 	}
-	wg.Wait()
+	return nil
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/processor"
+)
+
+var mergeOutput string
+
+var mergeCmd = &command{
+	name:    "merge",
+	args:    "-o <output.xml> <file_or_directory_path>...",
+	summary: "Merge overlapping full and incremental backups into one deduplicated backup file.",
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&mergeOutput, "o", "", "write the merged backup to `file` (required)")
+	},
+	minArgs: 1,
+	maxArgs: -1,
+	run:     runMerge,
+}
+
+func runMerge(env *cmdEnv, args []string) int {
+	if mergeOutput == "" {
+		fmt.Fprintln(env.stderr, "sbr merge: -o is required")
+		return exitUsage
+	}
+
+	var inputs []string
+	for _, arg := range args {
+		files, err := processor.FindBackupFiles(arg)
+		if err != nil {
+			fmt.Fprintf(env.stderr, "Error accessing path %s: %v\n", arg, err)
+			return exitFailure
+		}
+		inputs = append(inputs, files...)
+	}
+
+	// Write to a temp file next to the destination and rename into place so a
+	// failed merge never leaves a truncated backup behind.
+	tmp, err := os.CreateTemp(filepath.Dir(mergeOutput), ".sbr-*.tmp")
+	if err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+	stats, err := backup.Merge(tmp, inputs)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), mergeOutput)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		fmt.Fprintln(env.stderr, "Error merging backups:", err)
+		return exitFailure
+	}
+
+	fmt.Fprintf(env.stdout, "Merged %d file(s): %d records written, %d duplicates dropped\n",
+		stats.Files, stats.Records, stats.Duplicates)
+	return exitOK
+}
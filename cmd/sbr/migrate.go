@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/junkblocker/sbr/processor"
+)
+
+// migrateFlags holds the naming convention an output directory was extracted
+// with; the extract flags give the one to migrate it to.
+var migrateFlags struct {
+	location  *time.Location
+	subSecond int
+	template  *processor.Template
+	naming    processor.Naming
+	slides    bool
+	dryRun    bool
+	undoLog   string
+	undo      string
+}
+
+var migrateCmd = &command{
+	name:    "migrate",
+	args:    "<file_or_directory_path> <output_dir> | -undo <log>",
+	summary: "Rename the files in an extracted directory from one naming convention to another.",
+	setFlags: func(fs *flag.FlagSet) {
+		setExtractFlags(fs)
+		migrateFlags.location, migrateFlags.subSecond, migrateFlags.template = nil, 0, nil
+		migrateFlags.naming = processor.NamingCurrent
+		fs.Func("from-naming", "the `rules` of the release that extracted the directory: current (the default), v1 (before names were decoded) or buildfilename", func(s string) error {
+			n, err := processor.ParseNaming(s)
+			migrateFlags.naming = n
+			return err
+		})
+		fs.Func("from-tz", "the time `zone` the directory was extracted in (default local)", locationFlag(&migrateFlags.location))
+		fs.Func("from-subsecond", "the `n` digits of the fraction of a second the directory was extracted with (default 0)", subSecondFlag(&migrateFlags.subSecond))
+		fs.Func("from-template", "the `pattern` the directory was extracted with (default none)", templateFlag(&migrateFlags.template))
+		fs.BoolVar(&migrateFlags.slides, "from-slides", false, "the directory was extracted with -slides")
+		fs.BoolVar(&migrateFlags.dryRun, "n", false, "only print the renames, without making them")
+		fs.StringVar(&migrateFlags.undoLog, "undo-log", "", "record the renames in `file` (default .sbr-migrate-<time>.json in the output directory)")
+		fs.StringVar(&migrateFlags.undo, "undo", "", "reverse the renames recorded in undo `log`, instead of migrating")
+	},
+	minArgs: 0,
+	maxArgs: 2,
+	run:     runMigrate,
+}
+
+func runMigrate(env *cmdEnv, args []string) int {
+	if migrateFlags.undo != "" {
+		if len(args) != 0 {
+			fmt.Fprintln(env.stderr, "sbr migrate: -undo takes no arguments")
+			return exitUsage
+		}
+		report := processor.Undo(migrateFlags.undo, migrateFlags.dryRun)
+		return printMigration(env, report, "from "+migrateFlags.undo)
+	}
+	if len(args) != 2 {
+		fmt.Fprintln(env.stderr, "sbr migrate: want <file_or_directory_path> <output_dir>")
+		return exitUsage
+	}
+
+	to, err := processorOptions(env)
+	if err != nil {
+		fmt.Fprintln(env.stderr, "sbr migrate:", err)
+		return exitUsage
+	}
+	if migrateFlags.slides && migrateFlags.template != nil {
+		fmt.Fprintln(env.stderr, "sbr migrate: -from-slides does not apply to -from-template names; use the {slide} field instead")
+		return exitUsage
+	}
+	from := to
+	from.Location = migrateFlags.location
+	from.SubSecondDigits = migrateFlags.subSecond
+	from.Template = migrateFlags.template
+	from.Naming = migrateFlags.naming
+	from.SlideNumbers = migrateFlags.slides
+
+	files, err := processor.FindBackupFiles(args[0])
+	if err != nil {
+		fmt.Fprintf(env.stderr, "Error accessing path %s: %v\n", args[0], err)
+		return exitFailure
+	}
+
+	// Every rename is planned, and recorded in the undo log, before the
+	// first is made: a migration that cannot be undone is not started.
+	report := processor.PlanMigration(files, args[1], from, to)
+	var logPath string
+	if !migrateFlags.dryRun && len(report.Renamed) > 0 {
+		logPath = migrateFlags.undoLog
+		if logPath == "" {
+			logPath = filepath.Join(args[1], processor.UndoLogName(time.Now()))
+		}
+		if err := processor.WriteUndoLog(logPath, args[1], report.Renamed); err != nil {
+			fmt.Fprintln(env.stderr, "Error:", err)
+			fmt.Fprintln(env.stderr, "Nothing was renamed.")
+			return exitFailure
+		}
+		planned := len(report.Renamed)
+		var errs []error
+		report.Renamed, errs = processor.ApplyRenames(report.Renamed, args[1])
+		report.Errors = append(report.Errors, errs...)
+		if len(report.Renamed) < planned {
+			// Undo ignores renames that were not made, but a log of only
+			// those that were is clearer.
+			if err := processor.WriteUndoLog(logPath, args[1], report.Renamed); err != nil {
+				report.Errors = append(report.Errors, err)
+			}
+		}
+	}
+	code := printMigration(env, report, fmt.Sprintf("in %d backup file(s)", len(files)))
+	if logPath != "" {
+		fmt.Fprintf(env.stdout, "To undo: sbr migrate -undo %s\n", logPath)
+	}
+	return code
+}
+
+// printMigration prints what a migration, or its undoing, did, with source
+// describing where the renames came from, and returns the exit code.
+func printMigration(env *cmdEnv, report processor.MigrateReport, source string) int {
+	for _, r := range report.Renamed {
+		fmt.Fprintf(env.stdout, "%s -> %s\n", r.Old, r.New)
+	}
+	for _, r := range report.Conflicts {
+		fmt.Fprintf(env.stdout, "conflict: %s -> %s: target exists\n", r.Old, r.New)
+	}
+	for _, e := range report.Errors {
+		fmt.Fprintln(env.stdout, "error:", e)
+	}
+	verb := "renamed"
+	if migrateFlags.dryRun {
+		verb = "to rename"
+	}
+	fmt.Fprintf(env.stdout, "%d %s, %d conflicts, %d errors %s\n",
+		len(report.Renamed), verb, len(report.Conflicts), len(report.Errors), source)
+
+	if len(report.Conflicts) > 0 || len(report.Errors) > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
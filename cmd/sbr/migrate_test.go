@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateUndoLogFirst(t *testing.T) {
+	in := writeBackup(t, t.TempDir(), "sms-1.xml", goodBackup)
+	out := t.TempDir()
+	if code, stderr := runSbr(t, "extract", "-progress=false", "-tz", "UTC", in, out); code != exitOK {
+		t.Fatalf("extract: exit %d; stderr:\n%s", code, stderr)
+	}
+	extracted := filepath.Join(out, "2024-01-15-113045-a.png")
+
+	t.Run("unwritable log", func(t *testing.T) {
+		log := filepath.Join(t.TempDir(), "missing", "undo.json")
+		code, stderr := runSbr(t, "migrate", "-from-tz", "UTC", "-tz", "UTC", "-subsecond", "3", "-undo-log", log, in, out)
+		if code != exitFailure {
+			t.Errorf("exit %d, want %d", code, exitFailure)
+		}
+		if !strings.Contains(stderr, "Nothing was renamed") {
+			t.Errorf("stderr does not report the failure:\n%s", stderr)
+		}
+		if _, err := os.Stat(extracted); err != nil {
+			t.Errorf("file renamed without an undo log: %v", err)
+		}
+	})
+
+	t.Run("logged", func(t *testing.T) {
+		log := filepath.Join(t.TempDir(), "undo.json")
+		if code, stderr := runSbr(t, "migrate", "-from-tz", "UTC", "-tz", "UTC", "-subsecond", "3", "-undo-log", log, in, out); code != exitOK {
+			t.Fatalf("exit %d; stderr:\n%s", code, stderr)
+		}
+		data, err := os.ReadFile(log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "2024-01-15-113045.000-a.png") {
+			t.Errorf("undo log does not record the rename:\n%s", data)
+		}
+		if _, err := os.Stat(filepath.Join(out, "2024-01-15-113045.000-a.png")); err != nil {
+			t.Error(err)
+		}
+	})
+}
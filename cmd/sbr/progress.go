@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/types"
+)
+
+// How often progress is redrawn on a terminal, and printed otherwise.
+const (
+	progressTTYInterval  = 200 * time.Millisecond
+	progressLineInterval = 10 * time.Second
+)
+
+// progressBarWidth is the number of cells in the terminal progress bar.
+const progressBarWidth = 24
+
+// progressMeter turns processor progress events into a live bar with rate and
+// ETA on a terminal, or a summary line every progressLineInterval otherwise.
+type progressMeter struct {
+	w     io.Writer
+	tty   bool
+	start time.Time
+	total int64 // bytes in all input files
+
+	mu        sync.Mutex
+	read      map[string]int64 // bytes parsed so far, per file
+	skipped   int64            // bytes in files skipped as unchanged
+	filesDone int
+	unchanged int
+	files     int
+	mms       int
+	written   int
+	existed   int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newProgressMeter returns a meter for processing files, drawing to w.
+func newProgressMeter(w io.Writer, files []string) *progressMeter {
+	m := &progressMeter{
+		w:     w,
+		tty:   isTerminal(w),
+		start: time.Now(),
+		read:  make(map[string]int64, len(files)),
+		files: len(files),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			m.total += info.Size()
+		}
+	}
+	return m
+}
+
+// isTerminal reports whether w is a character device such as a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// update records one event; it is the processor's OnProgress callback.
+func (m *progressMeter) update(p processor.Progress) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch p.Kind {
+	case processor.ProgressRead:
+		m.read[p.File] = p.Offset
+	case processor.ProgressMMS:
+		m.read[p.File] = p.Offset
+		m.mms++
+	case processor.ProgressWritten:
+		m.written++
+	case processor.ProgressExisted:
+		m.existed++
+	case processor.ProgressFileSkipped:
+		m.skipped += p.Size
+		m.unchanged++
+		m.filesDone++
+	case processor.ProgressFileDone:
+		m.read[p.File] = p.Size
+		m.filesDone++
+	}
+}
+
+// Start draws the progress until Stop is called.
+func (m *progressMeter) Start() {
+	interval := progressLineInterval
+	if m.tty {
+		interval = progressTTYInterval
+	}
+	go func() {
+		defer close(m.done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				m.draw(false)
+			case <-m.stop:
+				m.draw(true)
+				return
+			}
+		}
+	}()
+}
+
+// Stop draws the final state and ends the progress display.
+func (m *progressMeter) Stop() {
+	close(m.stop)
+	<-m.done
+}
+
+func (m *progressMeter) draw(final bool) {
+	m.mu.Lock()
+	var parsed int64
+	for _, n := range m.read {
+		parsed += n
+	}
+	read := parsed + m.skipped
+	filesDone, unchanged, mms, written, existed := m.filesDone, m.unchanged, m.mms, m.written, m.existed
+	m.mu.Unlock()
+
+	// Skipped files take no time, so the rate counts parsed bytes only.
+	elapsed := time.Since(m.start)
+	var rate float64
+	if secs := elapsed.Seconds(); secs > 0 {
+		rate = float64(parsed) / secs
+	}
+	eta := "--"
+	if rate > 0 && read < m.total {
+		eta = time.Duration(float64(m.total-read) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+	pct := 100.0
+	if m.total > 0 {
+		pct = 100 * float64(read) / float64(m.total)
+	}
+	rateText := types.FormatBytes(int64(rate)) + "/s"
+
+	if m.tty {
+		filled := min(int(pct/100*progressBarWidth), progressBarWidth)
+		bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+		fmt.Fprintf(m.w, "\r[%s] %3.0f%%  %s/%s  %s  ETA %s  %d/%d files  %d MMS  %d written  %d existing\033[K",
+			bar, pct, types.FormatBytes(read), types.FormatBytes(m.total), rateText, eta,
+			filesDone, m.files, mms, written, existed)
+		if final {
+			fmt.Fprintln(m.w)
+		}
+		return
+	}
+	if final {
+		fmt.Fprintf(m.w, "Done in %s: %d/%d files (%d unchanged), %s parsed at %s, %d MMS, %d attachment(s) written, %d already present\n",
+			elapsed.Round(time.Second), filesDone, m.files, unchanged, types.FormatBytes(parsed), rateText, mms, written, existed)
+		return
+	}
+	fmt.Fprintf(m.w, "Progress: %.0f%% (%s of %s) at %s, ETA %s; %d/%d files, %d MMS, %d attachment(s) written, %d already present\n",
+		pct, types.FormatBytes(read), types.FormatBytes(m.total), rateText, eta, filesDone, m.files, mms, written, existed)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/processor"
+)
+
+// scanBackups streams every record of every backup file designated by paths
+// (files, or directories searched for sms-*.xml) to fn. onFile, if non-nil, is
+// called before each file is scanned.
+func scanBackups(env *cmdEnv, paths []string, onFile func(path string), fn func(backup.Record)) error {
+	for _, arg := range paths {
+		files, err := processor.FindBackupFiles(arg)
+		if err != nil {
+			return fmt.Errorf("accessing path %s: %w", arg, err)
+		}
+		for _, f := range files {
+			env.log.Debug("scanning file", "file", f)
+			if onFile != nil {
+				onFile(f)
+			}
+			if err = backup.ScanFile(f, fn); err != nil {
+				return fmt.Errorf("decoding file %s: %w", f, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"time"
+
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/search"
+)
+
+var (
+	searchRegexp  bool
+	searchSince   string
+	searchUntil   string
+	searchContact string
+	searchContext int
+	searchVCards  bool
+	searchBots    bool
+	searchIndex   string
+	searchReindex bool
+)
+
+var searchCmd = &command{
+	name:    "search",
+	args:    "<query> <file_or_directory_path>...",
+	summary: "Find messages by text, with date and contact filters.",
+	setFlags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&searchRegexp, "regex", false, "treat the query as a regular expression (RE2 syntax)")
+		fs.StringVar(&searchSince, "since", "", "only messages on or after `YYYY-MM-DD`")
+		fs.StringVar(&searchUntil, "until", "", "only messages on or before `YYYY-MM-DD`")
+		fs.StringVar(&searchContact, "contact", "", "only conversations with a participant whose name or number contains `text`")
+		fs.IntVar(&searchContext, "C", 0, "show `N` messages of context around each match")
+		fs.BoolVar(&searchVCards, "vcards", false, "also search shared contact cards")
+		fs.BoolVar(&searchBots, "bots", false, "also search RCS business messages")
+		fs.StringVar(&searchIndex, "index", "", "keep a search index in `file`, rebuilt when the backups change")
+		fs.BoolVar(&searchReindex, "reindex", false, "rebuild the -index file even if it is up to date")
+	},
+	minArgs: 2,
+	maxArgs: -1,
+	run:     runSearch,
+}
+
+func runSearch(env *cmdEnv, args []string) int {
+	query, inPaths := args[0], args[1:]
+
+	q := search.ParseQuery(query)
+	if searchRegexp {
+		re, err := regexp.Compile(query)
+		if err != nil {
+			fmt.Fprintln(env.stderr, "sbr search:", err)
+			return exitUsage
+		}
+		q = search.Query{Regexp: re}
+	}
+	q.Contact = searchContact
+	var err error
+	if q.Since, err = parseDay(searchSince); err != nil {
+		fmt.Fprintln(env.stderr, "sbr search: -since:", err)
+		return exitUsage
+	}
+	if q.Until, err = parseDay(searchUntil); err != nil {
+		fmt.Fprintln(env.stderr, "sbr search: -until:", err)
+		return exitUsage
+	}
+	if !q.Until.IsZero() {
+		// -until names the last day included.
+		q.Until = q.Until.AddDate(0, 0, 1)
+	}
+
+	resolver, err := env.resolver()
+	if err != nil {
+		fmt.Fprintln(env.stderr, "sbr search:", err)
+		return exitUsage
+	}
+
+	var files []string
+	for _, arg := range inPaths {
+		found, err := processor.FindBackupFiles(arg)
+		if err != nil {
+			fmt.Fprintf(env.stderr, "Error accessing path %s: %v\n", arg, err)
+			return exitFailure
+		}
+		files = append(files, found...)
+	}
+
+	opts := search.Options{VCards: searchVCards, BotMessages: searchBots}
+	var ix *search.Index
+	if searchIndex != "" && !searchReindex {
+		ix, err = search.Load(searchIndex)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintln(env.stderr, "Rebuilding index:", err)
+		}
+		if ix != nil && !ix.Current(files, opts) {
+			ix = nil
+		}
+	}
+	if ix == nil {
+		if ix, err = search.Build(files, resolver, opts); err != nil {
+			fmt.Fprintln(env.stderr, "Error:", err)
+			return exitFailure
+		}
+		if searchIndex != "" {
+			if err = ix.Save(searchIndex); err != nil {
+				fmt.Fprintln(env.stderr, "Error:", err)
+				return exitFailure
+			}
+			env.log.Debug("saved index", "path", searchIndex, "messages", len(ix.Docs))
+		}
+	}
+
+	matches := ix.Search(q)
+	if err = search.WriteText(env.stdout, ix, matches, searchContext); err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+	fmt.Fprintf(env.stderr, "%d matching message(s)\n", len(matches))
+	return exitOK
+}
+
+// parseDay parses a YYYY-MM-DD date as local midnight; "" is the zero time.
+func parseDay(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(time.DateOnly, s, time.Local)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/server"
+)
+
+var serveAddr string
+
+var serveCmd = &command{
+	name:    "serve",
+	args:    "[-addr host:port] <file_or_directory_path>...",
+	summary: "Browse conversations and attachments in a web browser without extracting anything.",
+	setFlags: func(fs *flag.FlagSet) {
+		fs.StringVar(&serveAddr, "addr", "127.0.0.1:8080", "listen on `host:port`")
+	},
+	minArgs: 1,
+	maxArgs: -1,
+	run:     runServe,
+}
+
+func runServe(env *cmdEnv, args []string) int {
+	resolver, err := env.resolver()
+	if err != nil {
+		fmt.Fprintln(env.stderr, "sbr serve:", err)
+		return exitUsage
+	}
+
+	var files []string
+	for _, arg := range args {
+		found, err := processor.FindBackupFiles(arg)
+		if err != nil {
+			fmt.Fprintf(env.stderr, "Error accessing path %s: %v\n", arg, err)
+			return exitFailure
+		}
+		files = append(files, found...)
+	}
+
+	s, err := server.New(files, resolver)
+	if err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+	defer s.Close()
+
+	fmt.Fprintf(env.stdout, "Serving %d conversation(s) from %d file(s) on http://%s/\n", len(s.Threads()), len(files), serveAddr)
+	if err = http.ListenAndServe(serveAddr, s); err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/s3"
+)
+
+// Archive formats extract can write instead of a directory.
+const (
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+	archiveZip   = "zip"
+	// outputS3 is not an archive but a bucket: objects are uploaded as they
+	// are extracted.
+	outputS3 = "s3"
+)
+
+// archiveFormat returns the archive format that the -sink flag value kind
+// selects for outPath, outputS3 for a bucket, or "" for a directory. "auto"
+// goes by outPath's scheme or extension.
+func archiveFormat(kind, outPath string) (string, error) {
+	isS3 := strings.HasPrefix(strings.ToLower(outPath), "s3://")
+	switch strings.ToLower(kind) {
+	case "auto":
+		lower := strings.ToLower(outPath)
+		switch {
+		case isS3:
+			return outputS3, nil
+		case strings.HasSuffix(lower, ".tar"):
+			return archiveTar, nil
+		case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+			return archiveTarGz, nil
+		case strings.HasSuffix(lower, ".zip"):
+			return archiveZip, nil
+		}
+		return "", nil
+	case "dir":
+		return "", nil
+	case archiveTar:
+		return archiveTar, nil
+	case archiveTarGz, "tgz":
+		return archiveTarGz, nil
+	case archiveZip:
+		return archiveZip, nil
+	case outputS3:
+		if !isS3 {
+			return "", fmt.Errorf("-sink s3 needs an s3://bucket/prefix output, not %q", outPath)
+		}
+		return outputS3, nil
+	}
+	return "", fmt.Errorf("unknown sink %q (want auto, dir, tar, tar.gz, zip or s3)", kind)
+}
+
+// archiveOutput is an archive being written to a temp file beside its
+// destination, so that a failed run never leaves a truncated archive behind.
+type archiveOutput struct {
+	sink processor.Sink
+	// end finishes the archive's stream.
+	end  io.Closer
+	tmp  *os.File
+	dest string
+}
+
+// createArchive starts writing an archive of format to path.
+func createArchive(path, format string) (*archiveOutput, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".sbr-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	a := &archiveOutput{tmp: tmp, dest: path}
+	switch format {
+	case archiveZip:
+		s := processor.NewZipSink(tmp)
+		a.sink, a.end = s, s
+	default:
+		s := processor.NewTarSink(tmp, format == archiveTarGz)
+		a.sink, a.end = s, s
+	}
+	return a, nil
+}
+
+// commit finishes the archive and moves it into place.
+func (a *archiveOutput) commit() error {
+	err := a.end.Close()
+	if closeErr := a.tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(a.tmp.Name(), a.dest)
+	}
+	if err != nil {
+		_ = os.Remove(a.tmp.Name())
+		return fmt.Errorf("writing archive %s: %w", a.dest, err)
+	}
+	return nil
+}
+
+// s3Output holds the -s3-endpoint and -s3-region flags.
+var s3Output struct {
+	endpoint string
+	region   string
+}
+
+// newS3Sink returns the sink of an s3://bucket/prefix output. Credentials
+// come from the environment, as for the AWS command-line tools, so that they
+// stay out of shell history and process listings.
+func newS3Sink(outPath string) (*s3.Sink, error) {
+	u, err := url.Parse(outPath)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 output %q (want s3://bucket/prefix)", outPath)
+	}
+	cfg := s3.Config{
+		Endpoint:  s3Output.endpoint,
+		Region:    s3Output.region,
+		Bucket:    u.Host,
+		AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	if cfg.Endpoint == "" {
+		region := cfg.Region
+		if region == "" {
+			region = s3.DefaultRegion
+		}
+		cfg.Endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("S3 output needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY set")
+	}
+	c, err := s3.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return s3.NewSink(c, prefix), nil
+}
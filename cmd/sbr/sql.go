@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/sqlexport"
+)
+
+var sqlCmd = &command{
+	name:    "sql",
+	args:    "<file_or_directory_path>... <output_dir>",
+	summary: "Export messages, parts, addresses, threads and calls as CSV tables with a SQL schema, updating an earlier export.",
+	setFlags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&extractFlags.slides, "slides", false, "name part paths as extract -slides does")
+		fs.Func("tz", "name part paths as extract -tz `zone` does", locationFlag(&extractFlags.location))
+		fs.Func("subsecond", "name part paths as extract -subsecond `n` does", subSecondFlag(&extractFlags.subSecond))
+		fs.Func("template", "name part paths as extract -template `pattern` does", templateFlag(&extractFlags.template))
+	},
+	minArgs: 2,
+	maxArgs: -1,
+	run:     runSQL,
+}
+
+func runSQL(env *cmdEnv, args []string) int {
+	resolver, err := env.resolver()
+	if err != nil {
+		fmt.Fprintln(env.stderr, "sbr sql:", err)
+		return exitUsage
+	}
+	opts, err := processorOptions(env)
+	if err != nil {
+		fmt.Fprintln(env.stderr, "sbr sql:", err)
+		return exitUsage
+	}
+
+	inPaths, outPath := args[:len(args)-1], args[len(args)-1]
+	if err = ensureOutputDir(outPath); err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+
+	// A directory holds both kinds of backup; a file named directly is found
+	// by both searches and must only be read once.
+	var files []string
+	seen := make(map[string]bool)
+	for _, arg := range inPaths {
+		for _, find := range []func(string) ([]string, error){processor.FindBackupFiles, processor.FindCallsBackupFiles} {
+			found, err := find(arg)
+			if err != nil {
+				fmt.Fprintf(env.stderr, "Error accessing path %s: %v\n", arg, err)
+				return exitFailure
+			}
+			for _, f := range found {
+				if !seen[f] {
+					seen[f] = true
+					files = append(files, f)
+				}
+			}
+		}
+	}
+
+	db, err := sqlexport.Load(outPath)
+	if err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+	b := sqlexport.NewBuilder(resolver)
+	for _, f := range files {
+		env.log.Debug("scanning file", "file", f)
+		hasMMS := false
+		err = backup.ScanFile(f, func(rec backup.Record) {
+			hasMMS = hasMMS || rec.Kind == backup.KindMMS
+			b.Add(rec)
+		})
+		if err != nil {
+			fmt.Fprintf(env.stderr, "Error decoding file %s: %v\n", f, err)
+			return exitFailure
+		}
+		if hasMMS {
+			// Record where extract puts each attachment.
+			if err = planPaths(f, opts, b); err != nil {
+				fmt.Fprintln(env.stderr, "Error:", err)
+				return exitFailure
+			}
+		}
+	}
+
+	added := b.Upsert(db)
+	if err = db.Save(outPath); err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+	fmt.Fprintf(env.stdout, "Exported %d message(s) and %d call(s) to %s (%d new row(s))\n",
+		db.Len("messages"), db.Len("calls"), outPath, added)
+	return exitOK
+}
+
+func planPaths(path string, opts processor.Options, b *sqlexport.Builder) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = processor.PlanFile(f, path, opts, func(p processor.Planned) {
+		b.SetPath(path, p.Offset, p.PartIndex, p.Name)
+	})
+	if err != nil {
+		return fmt.Errorf("naming attachments of %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/junkblocker/sbr/stats"
+)
+
+var (
+	statsJSON     bool
+	statsTop      int
+	statsContacts int
+)
+
+var statsCmd = &command{
+	name:    "stats",
+	args:    "<file_or_directory_path>...",
+	summary: "Summarise backups: message counts, contacts per year, attachment volume and duplicates.",
+	setFlags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&statsJSON, "json", false, "print the report as JSON")
+		fs.IntVar(&statsTop, "top", 10, "number of largest attachments to list")
+		fs.IntVar(&statsContacts, "contacts", 25, "maximum contacts to list in the table (0 = all)")
+	},
+	minArgs: 1,
+	maxArgs: -1,
+	run:     runStats,
+}
+
+func runStats(env *cmdEnv, args []string) int {
+	resolver, err := env.resolver()
+	if err != nil {
+		fmt.Fprintln(env.stderr, "sbr stats:", err)
+		return exitUsage
+	}
+	c := stats.NewCollector(statsTop, resolver)
+	err = scanBackups(env, args, func(string) { c.AddFile() }, c.Add)
+	if err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+
+	report := c.Report()
+	if statsJSON {
+		enc := json.NewEncoder(env.stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintln(env.stderr, "Error:", err)
+			return exitFailure
+		}
+		return exitOK
+	}
+	if err := stats.WriteTable(env.stdout, report, statsContacts); err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+	return exitOK
+}
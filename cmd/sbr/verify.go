@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/junkblocker/sbr/processor"
+)
+
+var verifyCmd = &command{
+	name:     "verify",
+	args:     "<file_or_directory_path> <output_dir>",
+	summary:  "Check that every attachment in the backups is present and intact in an extracted directory.",
+	setFlags: setExtractFlags,
+	minArgs:  2,
+	maxArgs:  2,
+	run:      runVerify,
+}
+
+func runVerify(env *cmdEnv, args []string) int {
+	opts, err := processorOptions(env)
+	if err != nil {
+		fmt.Fprintln(env.stderr, "sbr verify:", err)
+		return exitUsage
+	}
+
+	files, err := processor.FindBackupFiles(args[0])
+	if err != nil {
+		fmt.Fprintf(env.stderr, "Error accessing path %s: %v\n", args[0], err)
+		return exitFailure
+	}
+
+	var report processor.VerifyReport
+	for _, f := range files {
+		report.Merge(processor.VerifyFileFromPath(f, args[1], opts))
+	}
+
+	for _, p := range report.Missing {
+		fmt.Fprintln(env.stdout, "missing:", p)
+	}
+	for _, p := range report.Mismatched {
+		fmt.Fprintln(env.stdout, "mismatched:", p)
+	}
+	for _, e := range report.Errors {
+		fmt.Fprintln(env.stdout, "error:", e)
+	}
+	fmt.Fprintf(env.stdout, "%d ok, %d missing, %d mismatched, %d errors in %d backup file(s)\n",
+		report.OK, len(report.Missing), len(report.Mismatched), len(report.Errors), len(files))
+
+	if !report.Clean() {
+		return exitFailure
+	}
+	return exitOK
+}
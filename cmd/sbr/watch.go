@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/watch"
+)
+
+var (
+	watchPoll     bool
+	watchInterval time.Duration
+	watchSettle   time.Duration
+)
+
+var watchCmd = &command{
+	name:    "watch",
+	args:    "<input_dir> <output_dir>",
+	summary: "Keep running and extract attachments from every new or changed backup that appears in a directory.",
+	setFlags: func(fs *flag.FlagSet) {
+		setExtractFlags(fs)
+		fs.BoolVar(&extractForce, "force", false, "process backups already in the directory even if they were extracted unchanged")
+		fs.BoolVar(&watchPoll, "poll", false, "poll the directory instead of using change notifications")
+		fs.DurationVar(&watchInterval, "interval", watch.DefaultInterval, "how often to rescan the directory")
+		fs.DurationVar(&watchSettle, "settle", watch.DefaultSettle, "how long a file must stay unchanged before it is processed")
+	},
+	minArgs: 2,
+	maxArgs: 2,
+	run:     runWatch,
+}
+
+func runWatch(env *cmdEnv, args []string) int {
+	opts, err := processorOptions(env)
+	if err != nil {
+		fmt.Fprintln(env.stderr, "sbr watch:", err)
+		return exitUsage
+	}
+	inPath, outPath := args[0], args[1]
+	info, err := os.Stat(inPath)
+	if err != nil {
+		fmt.Fprintf(env.stderr, "Error accessing path %s: %v\n", inPath, err)
+		return exitFailure
+	}
+	if !info.IsDir() {
+		fmt.Fprintf(env.stderr, "sbr watch: %s is not a directory\n", inPath)
+		return exitUsage
+	}
+	if err = ensureOutputDir(outPath); err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+
+	// The ledger carries what has been extracted across restarts: backups
+	// already present when watch starts are only processed if they changed.
+	if opts.Ledger, err = processor.OpenLedger(outPath); err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+	opts.Force = extractForce
+	// Backups the ledger skips as unchanged are not announced.
+	opts.OnProgress = func(p processor.Progress) {
+		if p.Kind == processor.ProgressFileStarted {
+			fmt.Fprintln(env.stdout, "Processing", p.File)
+		}
+	}
+	w, err := watch.New(inPath, watch.Options{
+		Match:    processor.IsBackupFile,
+		Interval: watchInterval,
+		Settle:   watchSettle,
+		Poll:     watchPoll,
+		Logger:   env.log,
+	}, func(path string) error {
+		return processor.ProcessFileFromPath(path, outPath, opts)
+	})
+	if err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Fprintf(env.stdout, "Watching %s for new backups (Ctrl-C to stop)\n", inPath)
+	if err = w.Run(ctx); err != nil {
+		fmt.Fprintln(env.stderr, "Error:", err)
+		return exitFailure
+	}
+	return exitOK
+}
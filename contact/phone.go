@@ -0,0 +1,187 @@
+// Package contact normalises the addresses found in SMS Backup & Restore files
+// and resolves them into contact identities, so that "+1 (555) 123-4567",
+// "5551234567" and "15551234567" are recognised as the same person.
+package contact
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/junkblocker/sbr/types"
+)
+
+// region holds the dialling rules needed to turn a national number into E.164.
+type region struct {
+	// cc is the country calling code, without '+'.
+	cc string
+	// trunk is the national trunk prefix dialled before area codes ("0" in
+	// most of Europe, "1" in the NANP, "" where there is none).
+	trunk string
+	// idd is the international direct dialling prefix ("00", "011", ...).
+	idd string
+	// nationalLen is the length of a complete national significant number,
+	// or 0 if it varies.
+	nationalLen int
+}
+
+// regions maps ISO 3166-1 alpha-2 codes to dialling rules. It covers the
+// countries sbr is most often used in; others can still be handled by passing
+// numbers that already carry a '+' or IDD prefix.
+var regions = map[string]region{
+	"US": {cc: "1", trunk: "1", idd: "011", nationalLen: 10},
+	"CA": {cc: "1", trunk: "1", idd: "011", nationalLen: 10},
+	"PR": {cc: "1", trunk: "1", idd: "011", nationalLen: 10},
+	"GB": {cc: "44", trunk: "0", idd: "00"},
+	"IE": {cc: "353", trunk: "0", idd: "00"},
+	"DE": {cc: "49", trunk: "0", idd: "00"},
+	"FR": {cc: "33", trunk: "0", idd: "00", nationalLen: 9},
+	"NL": {cc: "31", trunk: "0", idd: "00", nationalLen: 9},
+	"BE": {cc: "32", trunk: "0", idd: "00"},
+	"CH": {cc: "41", trunk: "0", idd: "00", nationalLen: 9},
+	"AT": {cc: "43", trunk: "0", idd: "00"},
+	"IT": {cc: "39", idd: "00"},
+	"ES": {cc: "34", idd: "00", nationalLen: 9},
+	"PT": {cc: "351", idd: "00", nationalLen: 9},
+	"SE": {cc: "46", trunk: "0", idd: "00"},
+	"NO": {cc: "47", idd: "00", nationalLen: 8},
+	"DK": {cc: "45", idd: "00", nationalLen: 8},
+	"FI": {cc: "358", trunk: "0", idd: "00"},
+	"PL": {cc: "48", idd: "00", nationalLen: 9},
+	"IN": {cc: "91", trunk: "0", idd: "00", nationalLen: 10},
+	"PK": {cc: "92", trunk: "0", idd: "00"},
+	"CN": {cc: "86", trunk: "0", idd: "00"},
+	"JP": {cc: "81", trunk: "0", idd: "010"},
+	"KR": {cc: "82", trunk: "0", idd: "001"},
+	"SG": {cc: "65", idd: "000", nationalLen: 8},
+	"AU": {cc: "61", trunk: "0", idd: "0011", nationalLen: 9},
+	"NZ": {cc: "64", trunk: "0", idd: "00"},
+	"ZA": {cc: "27", trunk: "0", idd: "00", nationalLen: 9},
+	"BR": {cc: "55", trunk: "0", idd: "00"},
+	"MX": {cc: "52", idd: "00", nationalLen: 10},
+	"RU": {cc: "7", trunk: "8", idd: "810", nationalLen: 10},
+}
+
+// maxShortCodeLen is the longest digit string treated as a short code (carrier
+// and business short codes are 3-6 digits). Short codes have no E.164 form and
+// are left as they are.
+const maxShortCodeLen = 6
+
+// Normaliser converts raw addresses to a canonical form:
+//
+//   - Phone numbers become E.164 ("+15551234567"). Numbers written without a
+//     country code are interpreted using the default region.
+//   - Short codes ("22000") are kept as bare digits.
+//   - E-mail addresses (MMS can be sent to and from them) are lowercased.
+//   - Alphanumeric sender IDs ("AMAZON", "VZ-ALERT") are kept as written.
+//
+// The zero value has no default region: national numbers are returned as bare
+// digits rather than guessed at.
+type Normaliser struct {
+	region  region
+	known   bool
+	country string
+}
+
+// NewNormaliser returns a Normaliser that interprets national numbers using
+// the dialling rules of defaultCountry, an ISO 3166-1 alpha-2 code such as
+// "US" or "GB". An empty defaultCountry yields the zero Normaliser.
+func NewNormaliser(defaultCountry string) (*Normaliser, error) {
+	if defaultCountry == "" {
+		return &Normaliser{}, nil
+	}
+	r, ok := regions[strings.ToUpper(defaultCountry)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported country %q", defaultCountry)
+	}
+	return &Normaliser{region: r, known: true, country: strings.ToUpper(defaultCountry)}, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the default country, or ""
+// for the zero Normaliser.
+func (n *Normaliser) Country() string {
+	return n.country
+}
+
+// Normalise returns the canonical form of a single address. Addresses that
+// list several recipients must be split with SplitAddresses first.
+func (n *Normaliser) Normalise(raw types.PhoneNumber) types.PhoneNumber {
+	s := strings.TrimSpace(string(raw))
+	if s == "" || s == "null" {
+		return ""
+	}
+	if strings.Contains(s, "@") {
+		return types.PhoneNumber(strings.ToLower(s))
+	}
+
+	var digits strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0,
+			r == ' ', r == '-', r == '.', r == '(', r == ')', r == '/':
+			// Formatting characters.
+		default:
+			// Letters or other symbols: an alphanumeric sender ID.
+			return types.PhoneNumber(s)
+		}
+	}
+	d := digits.String()
+	if d == "" {
+		return types.PhoneNumber(s)
+	}
+	if s[0] == '+' {
+		return types.PhoneNumber("+" + d)
+	}
+	if len(d) <= maxShortCodeLen {
+		return types.PhoneNumber(d)
+	}
+	if !n.known {
+		if strings.HasPrefix(d, "00") {
+			return types.PhoneNumber("+" + d[2:])
+		}
+		return types.PhoneNumber(d)
+	}
+
+	r := n.region
+	if strings.HasPrefix(d, r.idd) {
+		return types.PhoneNumber("+" + d[len(r.idd):])
+	}
+	if r.nationalLen > 0 {
+		// A number of exactly national length, or one that already starts with
+		// the country code (common in NANP: "15551234567").
+		switch {
+		case len(d) == r.nationalLen:
+			return types.PhoneNumber("+" + r.cc + d)
+		case len(d) == len(r.cc)+r.nationalLen && strings.HasPrefix(d, r.cc):
+			return types.PhoneNumber("+" + d)
+		case r.trunk != "" && len(d) == len(r.trunk)+r.nationalLen && strings.HasPrefix(d, r.trunk):
+			return types.PhoneNumber("+" + r.cc + d[len(r.trunk):])
+		}
+		return types.PhoneNumber(d)
+	}
+	if r.trunk != "" && strings.HasPrefix(d, r.trunk) {
+		return types.PhoneNumber("+" + r.cc + d[len(r.trunk):])
+	}
+	return types.PhoneNumber("+" + r.cc + d)
+}
+
+// SplitAddresses splits the address attribute of a group message, where the
+// app joins recipients with '~', into individual addresses. Empty and "null"
+// entries are dropped.
+func SplitAddresses(raw types.PhoneNumber) []types.PhoneNumber {
+	var out []types.PhoneNumber
+	for _, a := range strings.Split(string(raw), "~") {
+		a = strings.TrimSpace(a)
+		if a != "" && a != "null" {
+			out = append(out, types.PhoneNumber(a))
+		}
+	}
+	return out
+}
+
+// IsPhoneNumber reports whether a normalised address is an E.164 number, as
+// opposed to a short code, e-mail address or alphanumeric sender ID.
+func IsPhoneNumber(a types.PhoneNumber) bool {
+	return strings.HasPrefix(string(a), "+")
+}
@@ -0,0 +1,61 @@
+package contact
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/junkblocker/sbr/types"
+)
+
+func TestNormalise(t *testing.T) {
+	cases := []struct {
+		country string
+		in      types.PhoneNumber
+		want    types.PhoneNumber
+	}{
+		// NANP: every spelling of the same number converges.
+		{"US", "+1 (555) 123-4567", "+15551234567"},
+		{"US", "5551234567", "+15551234567"},
+		{"US", "15551234567", "+15551234567"},
+		{"US", "555.123.4567", "+15551234567"},
+		{"US", "011 44 7911 123456", "+447911123456"},
+		// UK: trunk 0 replaced by the country code.
+		{"GB", "07911 123456", "+447911123456"},
+		{"GB", "+44 7911 123456", "+447911123456"},
+		{"GB", "0044 7911 123456", "+447911123456"},
+		// Short codes, e-mail and alphanumeric senders are left intact.
+		{"US", "22000", "22000"},
+		{"US", "  Someone@Example.COM ", "someone@example.com"},
+		{"US", "VZ-ALERT", "VZ-ALERT"},
+		// Without a default country national numbers stay as digits.
+		{"", "(555) 123-4567", "5551234567"},
+		{"", "+1 555 123 4567", "+15551234567"},
+		{"", "00447911123456", "+447911123456"},
+		// Nothing to normalise.
+		{"US", "", ""},
+		{"US", "null", ""},
+	}
+	for _, tc := range cases {
+		n, err := NewNormaliser(tc.country)
+		if err != nil {
+			t.Fatalf("NewNormaliser(%q): %v", tc.country, err)
+		}
+		if got := n.Normalise(tc.in); got != tc.want {
+			t.Errorf("[%s] Normalise(%q) = %q, want %q", tc.country, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestNewNormaliser_UnknownCountry(t *testing.T) {
+	if _, err := NewNormaliser("XX"); err == nil {
+		t.Error("expected error for unknown country")
+	}
+}
+
+func TestSplitAddresses(t *testing.T) {
+	got := SplitAddresses("+1555~ +1666 ~null~~")
+	want := []types.PhoneNumber{"+1555", "+1666"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitAddresses = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,266 @@
+package contact
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/junkblocker/sbr/types"
+)
+
+// Identity is one person (or business, or group of numbers belonging to the
+// same address-book entry) as resolved from the messages observed.
+type Identity struct {
+	// ID is a stable key for the identity: its lowest normalised address, or
+	// "name:<name>" for an identity known only by name.
+	ID string
+	// Name is the contact name seen most often for any of the identity's
+	// addresses, or "" if the app never recorded one.
+	Name string
+	// Addresses lists the identity's normalised addresses in sorted order.
+	Addresses []types.PhoneNumber
+}
+
+// Label returns the best human-readable label for the identity.
+func (id *Identity) Label() string {
+	if id.Name != "" {
+		return id.Name
+	}
+	if len(id.Addresses) > 0 {
+		return string(id.Addresses[0])
+	}
+	return id.ID
+}
+
+// Resolver merges observed (address, contact name) pairs into identities. Two
+// addresses belong to the same identity when they normalise to the same value
+// or when the app recorded the same contact name for both - e.g. a friend's
+// mobile and work numbers, both saved under one address-book entry.
+//
+// The owner's own numbers can be registered with SetOwner; they are never
+// merged into another identity and are excluded by Participants.
+//
+// A Resolver is not safe for concurrent use. Observe everything first, then
+// call Resolve or Identities; resolution is recomputed lazily after each new
+// observation.
+type Resolver struct {
+	norm   *Normaliser
+	owner  map[types.PhoneNumber]bool
+	parent map[string]string
+	names  map[string]map[string]int // address key -> name -> count
+	byKey  map[string]*Identity
+}
+
+// NewResolver returns a Resolver that normalises addresses with n. A nil n is
+// equivalent to the zero Normaliser.
+func NewResolver(n *Normaliser) *Resolver {
+	if n == nil {
+		n = &Normaliser{}
+	}
+	return &Resolver{
+		norm:   n,
+		owner:  make(map[types.PhoneNumber]bool),
+		parent: make(map[string]string),
+		names:  make(map[string]map[string]int),
+	}
+}
+
+// Normalise normalises a single address with the resolver's Normaliser.
+func (r *Resolver) Normalise(a types.PhoneNumber) types.PhoneNumber {
+	return r.norm.Normalise(a)
+}
+
+// SetOwner registers the backup owner's own addresses.
+func (r *Resolver) SetOwner(addrs ...types.PhoneNumber) {
+	for _, a := range addrs {
+		if n := r.norm.Normalise(a); n != "" {
+			r.owner[n] = true
+		}
+	}
+	r.byKey = nil
+}
+
+// IsOwner reports whether a belongs to the backup owner.
+func (r *Resolver) IsOwner(a types.PhoneNumber) bool {
+	return r.owner[r.norm.Normalise(a)]
+}
+
+// Observe records the address attribute and contact_name of one message. For
+// group messages both are lists ("a~b", "Ann, Bob"); names are paired with
+// addresses only when the two lists have the same length, since the app
+// omits unknown contacts from contact_name.
+func (r *Resolver) Observe(address types.PhoneNumber, contactName string) {
+	addrs := SplitAddresses(address)
+	names := splitNames(contactName, len(addrs))
+	for i, a := range addrs {
+		n := r.norm.Normalise(a)
+		if n == "" || r.owner[n] {
+			continue
+		}
+		key := addrKey(n)
+		r.find(key)
+		if names == nil || names[i] == "" {
+			continue
+		}
+		name := names[i]
+		if r.names[key] == nil {
+			r.names[key] = make(map[string]int)
+		}
+		r.names[key][name]++
+		r.union(key, nameKey(name))
+	}
+	r.byKey = nil
+}
+
+// Resolve returns the identity a single address belongs to. Addresses that
+// were never observed resolve to a fresh identity of their own.
+func (r *Resolver) Resolve(a types.PhoneNumber) *Identity {
+	n := r.norm.Normalise(a)
+	r.resolveAll()
+	if id := r.byKey[r.root(addrKey(n))]; id != nil {
+		return id
+	}
+	return &Identity{ID: string(n), Addresses: []types.PhoneNumber{n}}
+}
+
+// Participants normalises and resolves every address in addrs, dropping the
+// owner's own addresses and duplicates, and returns the identities sorted by
+// ID.
+func (r *Resolver) Participants(addrs []types.PhoneNumber) []*Identity {
+	seen := make(map[string]bool)
+	var out []*Identity
+	for _, a := range addrs {
+		for _, single := range SplitAddresses(a) {
+			if r.IsOwner(single) {
+				continue
+			}
+			id := r.Resolve(single)
+			if !seen[id.ID] {
+				seen[id.ID] = true
+				out = append(out, id)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Identities returns every identity observed so far, sorted by ID.
+func (r *Resolver) Identities() []*Identity {
+	r.resolveAll()
+	seen := make(map[*Identity]bool)
+	var out []*Identity
+	for _, id := range r.byKey {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// resolveAll (re)builds byKey, mapping each union-find root to its Identity.
+func (r *Resolver) resolveAll() {
+	if r.byKey != nil {
+		return
+	}
+	r.byKey = make(map[string]*Identity)
+	nameCounts := make(map[string]map[string]int)
+	for key := range r.parent {
+		root := r.root(key)
+		id := r.byKey[root]
+		if id == nil {
+			id = &Identity{}
+			r.byKey[root] = id
+			nameCounts[root] = make(map[string]int)
+		}
+		if a, ok := strings.CutPrefix(key, "addr:"); ok {
+			id.Addresses = append(id.Addresses, types.PhoneNumber(a))
+			for name, c := range r.names[key] {
+				nameCounts[root][name] += c
+			}
+		}
+	}
+	for root, id := range r.byKey {
+		sort.Slice(id.Addresses, func(i, j int) bool { return id.Addresses[i] < id.Addresses[j] })
+		id.Name = mostFrequent(nameCounts[root])
+		if len(id.Addresses) > 0 {
+			id.ID = string(id.Addresses[0])
+		} else {
+			id.ID = root
+		}
+	}
+}
+
+// find registers key if necessary and returns its root.
+func (r *Resolver) find(key string) string {
+	if _, ok := r.parent[key]; !ok {
+		r.parent[key] = key
+	}
+	return r.root(key)
+}
+
+// root returns the union-find root of key without registering it.
+func (r *Resolver) root(key string) string {
+	for {
+		p, ok := r.parent[key]
+		if !ok || p == key {
+			return key
+		}
+		// Path halving.
+		gp := r.parent[p]
+		r.parent[key] = gp
+		key = gp
+	}
+}
+
+func (r *Resolver) union(a, b string) {
+	ra, rb := r.find(a), r.find(b)
+	if ra == rb {
+		return
+	}
+	// Keep address keys as roots so identities are named after a number.
+	if strings.HasPrefix(rb, "addr:") && !strings.HasPrefix(ra, "addr:") {
+		ra, rb = rb, ra
+	}
+	r.parent[rb] = ra
+}
+
+func addrKey(a types.PhoneNumber) string { return "addr:" + string(a) }
+
+func nameKey(name string) string { return "name:" + strings.ToLower(name) }
+
+// splitNames splits a contact_name attribute into n names, or returns nil if
+// it does not contain exactly n usable names.
+func splitNames(contactName string, n int) []string {
+	contactName = strings.TrimSpace(contactName)
+	if contactName == "" || contactName == "(Unknown)" || contactName == "null" {
+		return nil
+	}
+	if n == 1 {
+		return []string{contactName}
+	}
+	parts := strings.Split(contactName, ",")
+	if len(parts) != n {
+		return nil
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+		if parts[i] == "(Unknown)" {
+			parts[i] = ""
+		}
+	}
+	return parts
+}
+
+// mostFrequent returns the key with the highest count, breaking ties by the
+// lexically smallest key so the result is deterministic.
+func mostFrequent(counts map[string]int) string {
+	best, bestN := "", 0
+	for k, n := range counts {
+		if n > bestN || (n == bestN && k < best) {
+			best, bestN = k, n
+		}
+	}
+	return best
+}
@@ -0,0 +1,94 @@
+package contact
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/junkblocker/sbr/types"
+)
+
+func newUSResolver(t *testing.T) *Resolver {
+	t.Helper()
+	n, err := NewNormaliser("US")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewResolver(n)
+}
+
+func TestResolver_MergesSpellings(t *testing.T) {
+	r := newUSResolver(t)
+	r.Observe("+1 (555) 123-4567", "(Unknown)")
+	r.Observe("5551234567", "Ann")
+	r.Observe("15551234567", "Ann")
+
+	ids := r.Identities()
+	if len(ids) != 1 {
+		t.Fatalf("got %d identities, want 1: %+v", len(ids), ids)
+	}
+	if ids[0].Name != "Ann" || ids[0].ID != "+15551234567" {
+		t.Errorf("identity = %+v", ids[0])
+	}
+}
+
+func TestResolver_MergesByContactName(t *testing.T) {
+	r := newUSResolver(t)
+	r.Observe("5551234567", "Ann")
+	r.Observe("5559999999", "ann")
+	r.Observe("5550000000", "Bob")
+
+	ann := r.Resolve("+15559999999")
+	want := []types.PhoneNumber{"+15551234567", "+15559999999"}
+	if !reflect.DeepEqual(ann.Addresses, want) {
+		t.Errorf("Ann addresses = %v, want %v", ann.Addresses, want)
+	}
+	if r.Resolve("5551234567") != ann {
+		t.Error("both of Ann's numbers should resolve to the same identity")
+	}
+	if r.Resolve("5550000000").Label() != "Bob" {
+		t.Errorf("Bob label = %q", r.Resolve("5550000000").Label())
+	}
+}
+
+func TestResolver_GroupNamesPairedWithAddresses(t *testing.T) {
+	r := newUSResolver(t)
+	r.Observe("5551111111~5552222222", "Ann, Bob")
+	// A mismatched name list must not be guessed at.
+	r.Observe("5553333333~5554444444", "Carol")
+
+	if got := r.Resolve("5552222222").Name; got != "Bob" {
+		t.Errorf("second group member name = %q, want Bob", got)
+	}
+	if got := r.Resolve("5553333333").Name; got != "" {
+		t.Errorf("unpaired name should not be assigned, got %q", got)
+	}
+}
+
+func TestResolver_Owner(t *testing.T) {
+	r := newUSResolver(t)
+	r.SetOwner("(555) 000-0001")
+	r.Observe("5550000001~5551111111", "Me, Ann")
+
+	if !r.IsOwner("+15550000001") {
+		t.Error("owner number not recognised after normalisation")
+	}
+	parts := r.Participants([]types.PhoneNumber{"+15550000001", "5551111111", "+1 555 111 1111"})
+	if len(parts) != 1 || parts[0].ID != "+15551111111" {
+		t.Errorf("Participants = %+v, want just +15551111111", parts)
+	}
+	for _, id := range r.Identities() {
+		for _, a := range id.Addresses {
+			if a == "+15550000001" {
+				t.Errorf("owner address leaked into identity %+v", id)
+			}
+		}
+	}
+}
+
+func TestResolver_Unobserved(t *testing.T) {
+	r := NewResolver(nil)
+	id := r.Resolve("+44 7911 123456")
+	if id.ID != "+447911123456" || id.Label() != "+447911123456" {
+		t.Errorf("unobserved identity = %+v", id)
+	}
+}
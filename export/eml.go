@@ -0,0 +1,245 @@
+package export
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/contact"
+	"github.com/junkblocker/sbr/thread"
+	"github.com/junkblocker/sbr/types"
+)
+
+// emlDomain is appended to phone numbers to form syntactically valid e-mail
+// addresses. ".invalid" is reserved (RFC 2606) so they can never be delivered.
+const emlDomain = "sms.invalid"
+
+// WriteEML renders message m of thread t as an RFC 5322 e-mail, so it can be
+// imported into any mail client. rec must be the backup record m was built
+// from: MMS part payloads are embedded from it.
+//
+// An SMS becomes a text/plain message. An MMS becomes multipart/related with
+// an HTML body that lays out the slides as they appeared on the phone,
+// referencing each embedded part by Content-ID.
+func WriteEML(w io.Writer, t *thread.Thread, m *thread.Message, rec backup.Record) error {
+	if m.Kind == backup.KindMMS && rec.MMS == nil {
+		return errors.New("MMS message requires its backup record")
+	}
+	id := messageID(t, m)
+
+	var hdr strings.Builder
+	from, to := emlParticipants(t, m)
+	fmt.Fprintf(&hdr, "From: %s\r\n", from)
+	fmt.Fprintf(&hdr, "To: %s\r\n", to)
+	fmt.Fprintf(&hdr, "Date: %s\r\n", m.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&hdr, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject(m)))
+	fmt.Fprintf(&hdr, "Message-ID: <%s@%s>\r\n", id, emlDomain)
+	fmt.Fprintf(&hdr, "X-SBR-Thread: %s\r\n", mime.QEncoding.Encode("utf-8", t.ID))
+	fmt.Fprintf(&hdr, "X-SBR-Direction: %s\r\n", m.Direction)
+	hdr.WriteString("MIME-Version: 1.0\r\n")
+
+	if m.Kind != backup.KindMMS {
+		hdr.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		hdr.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if _, err := io.WriteString(w, hdr.String()); err != nil {
+			return err
+		}
+		return writeQP(w, m.Body)
+	}
+
+	mw := multipart.NewWriter(w)
+	// A deterministic boundary keeps re-exports byte-identical.
+	if err := mw.SetBoundary("sbr-" + id); err != nil {
+		return err
+	}
+	fmt.Fprintf(&hdr, "Content-Type: multipart/related; type=\"text/html\"; boundary=%q\r\n\r\n", mw.Boundary())
+	if _, err := io.WriteString(w, hdr.String()); err != nil {
+		return err
+	}
+
+	body, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	if err = writeQP(body, emlHTML(m, id)); err != nil {
+		return err
+	}
+
+	for _, p := range m.Parts {
+		if p.Index >= len(rec.MMS.Parts) {
+			continue
+		}
+		src := rec.MMS.Parts[p.Index]
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprintf("part%d", p.Index)
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(p.ContentType, map[string]string{"name": name})},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + contentID(id, p.Index) + ">"},
+			"Content-Disposition":       {mime.FormatMediaType("inline", map[string]string{"filename": name})},
+		})
+		if err != nil {
+			return err
+		}
+		if err = writeBase64Lines(part, src.Data); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// EMLFilename returns the name of the file WriteEML output is stored in: the
+// message timestamp plus its position in the thread, which keeps messages sent
+// in the same second apart.
+func EMLFilename(m *thread.Message, index int) string {
+	return fmt.Sprintf("%s-%04d.eml", m.Time.Format("2006-01-02-150405"), index)
+}
+
+// emlParticipants returns the From and To header values for m.
+func emlParticipants(t *thread.Thread, m *thread.Message) (from, to string) {
+	me := mail.Address{Name: ownerLabel, Address: "owner@" + emlDomain}
+	var others []string
+	for _, p := range t.Participants {
+		if m.Direction == thread.Received && m.Sender != nil && p.ID == m.Sender.ID {
+			continue
+		}
+		others = append(others, emlAddress(p).String())
+	}
+	if m.Direction == thread.Sent {
+		return me.String(), strings.Join(others, ", ")
+	}
+	sender := mail.Address{Name: "(Unknown)", Address: "unknown@" + emlDomain}
+	if m.Sender != nil {
+		sender = *emlAddress(m.Sender)
+	}
+	return sender.String(), strings.Join(append([]string{me.String()}, others...), ", ")
+}
+
+func emlAddress(id *contact.Identity) *mail.Address {
+	addr := types.PhoneNumber(id.ID)
+	if len(id.Addresses) > 0 {
+		addr = id.Addresses[0]
+	}
+	a := string(addr)
+	if !strings.Contains(a, "@") {
+		a = strings.Map(func(r rune) rune {
+			if r == ' ' || r == '<' || r == '>' || r == '"' {
+				return -1
+			}
+			return r
+		}, a) + "@" + emlDomain
+	}
+	return &mail.Address{Name: id.Label(), Address: a}
+}
+
+// subject derives a Subject from the first line of the message text.
+func subject(m *thread.Message) string {
+	text := m.Body
+	for _, s := range m.Slides {
+		if text != "" {
+			break
+		}
+		text = s.Text
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	if r := []rune(line); len(r) > 60 {
+		line = string(r[:60]) + "…"
+	}
+	if line == "" {
+		return strings.ToUpper(m.Kind.String())
+	}
+	return line
+}
+
+// emlHTML lays out an MMS body, referencing parts by Content-ID.
+func emlHTML(m *thread.Message, id string) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"></head><body>\n")
+	writePart := func(p thread.Part) {
+		cid := contentID(id, p.Index)
+		switch {
+		case strings.HasPrefix(p.ContentType, "image/"):
+			fmt.Fprintf(&b, "<p><img src=\"cid:%s\" alt=\"%s\" style=\"max-width:100%%\"></p>\n", cid, html.EscapeString(p.Name))
+		case strings.HasPrefix(p.ContentType, "video/"):
+			fmt.Fprintf(&b, "<p><video controls src=\"cid:%s\"></video></p>\n", cid)
+		case strings.HasPrefix(p.ContentType, "audio/"):
+			fmt.Fprintf(&b, "<p><audio controls src=\"cid:%s\"></audio></p>\n", cid)
+		default:
+			fmt.Fprintf(&b, "<p>📎 %s</p>\n", html.EscapeString(describePart(p)))
+		}
+	}
+	writeText := func(text string) {
+		if text != "" {
+			fmt.Fprintf(&b, "<p>%s</p>\n", strings.ReplaceAll(html.EscapeString(text), "\n", "<br>"))
+		}
+	}
+
+	if len(m.Slides) > 0 {
+		for _, s := range m.Slides {
+			b.WriteString("<div class=\"slide\">\n")
+			for _, p := range s.Parts {
+				writePart(p)
+			}
+			writeText(s.Text)
+			b.WriteString("</div>\n")
+		}
+	} else {
+		for _, p := range m.Parts {
+			writePart(p)
+		}
+		writeText(m.Body)
+	}
+	b.WriteString("</body></html>\n")
+	return b.String()
+}
+
+func contentID(messageID string, index int) string {
+	return fmt.Sprintf("part%d.%s@%s", index, messageID, emlDomain)
+}
+
+// messageID derives a stable identifier for m from its thread, time and
+// text, so re-exporting a merged backup yields the same IDs.
+func messageID(t *thread.Thread, m *thread.Message) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s|%s", t.ID, m.Time.UnixMilli(), m.Kind, m.Body)))
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+func writeQP(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, s); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64Lines writes already-encoded base64 data wrapped at 76 columns,
+// as MIME requires.
+func writeBase64Lines(w io.Writer, data string) error {
+	const lineLen = 76
+	if data == "null" {
+		data = ""
+	}
+	for len(data) > 0 {
+		n := min(lineLen, len(data))
+		if _, err := io.WriteString(w, data[:n]+"\r\n"); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
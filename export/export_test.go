@@ -0,0 +1,155 @@
+package export
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/contact"
+	"github.com/junkblocker/sbr/thread"
+	"github.com/junkblocker/sbr/types"
+)
+
+func sampleThread() *thread.Thread {
+	ann := &contact.Identity{ID: "+15551112222", Name: "Ann", Addresses: []types.PhoneNumber{"+15551112222"}}
+	return &thread.Thread{
+		ID:           ann.ID,
+		Participants: []*contact.Identity{ann},
+		Messages: []*thread.Message{
+			{Kind: backup.KindSMS, Time: time.Date(2024, 1, 15, 11, 30, 45, 0, time.Local), Direction: thread.Received, Sender: ann, Body: "hi <there>\nsecond line"},
+			{Kind: backup.KindMMS, Time: time.Date(2024, 1, 15, 11, 31, 0, 0, time.Local), Direction: thread.Sent,
+				Parts: []thread.Part{{Index: 1, ContentType: "image/jpeg", Name: "p.jpg", Size: 2048}}},
+		},
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteText(&buf, sampleThread()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"Conversation with Ann\n",
+		"Ann <+15551112222>",
+		"[2024-01-15 11:30:45] Ann:\n  hi <there>\n  second line\n",
+		"[2024-01-15 11:31:00] Me:\n",
+		"[attachment: p.jpg, image/jpeg, 2.0 KiB]",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("text export missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, sampleThread()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "hi &lt;there&gt;") {
+		t.Error("message body not HTML-escaped")
+	}
+	if !strings.Contains(out, `class="msg sent"`) {
+		t.Error("sent message not marked")
+	}
+
+	buf.Reset()
+	if err := WriteHTMLIndex(&buf, []IndexEntry{{Thread: sampleThread(), Href: "Ann-1.html"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `href="Ann-1.html"`) {
+		t.Errorf("index missing link:\n%s", buf.String())
+	}
+}
+
+func TestFilename(t *testing.T) {
+	th := sampleThread()
+	th.Participants[0].Name = "A/B: C?"
+	name := Filename(th, ".txt")
+	if strings.ContainsAny(name, `/:?`) || !strings.HasSuffix(name, ".txt") {
+		t.Errorf("Filename = %q is not sanitised", name)
+	}
+	other := sampleThread()
+	other.ID = "+15559999999"
+	other.Participants[0].Name = "A/B: C?"
+	if Filename(other, ".txt") == name {
+		t.Error("threads with equal titles but different IDs share a filename")
+	}
+}
+
+func TestWriteEML(t *testing.T) {
+	th := sampleThread()
+
+	t.Run("sms", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteEML(&buf, th, th.Messages[0], backup.Record{}); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := mail.ReadMessage(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if from := msg.Header.Get("From"); !strings.Contains(from, "Ann") || !strings.Contains(from, "+15551112222@sms.invalid") {
+			t.Errorf("From = %q", from)
+		}
+		if subj := msg.Header.Get("Subject"); subj != "hi <there>" {
+			t.Errorf("Subject = %q", subj)
+		}
+		body, _ := io.ReadAll(quotedprintable.NewReader(msg.Body))
+		if string(body) != "hi <there>\r\nsecond line" {
+			t.Errorf("body = %q", body)
+		}
+	})
+
+	t.Run("mms", func(t *testing.T) {
+		m := th.Messages[1]
+		m.Slides = []thread.Slide{{Number: 1, Text: "look", Parts: m.Parts}}
+		rec := backup.Record{Kind: backup.KindMMS, MMS: &types.MMS{Parts: []types.MMSPart{
+			{ContentType: "application/smil"},
+			{ContentType: "image/jpeg", Filename: "p.jpg", Data: "aGVsbG8="},
+		}}}
+		var buf bytes.Buffer
+		if err := WriteEML(&buf, th, m, rec); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := mail.ReadMessage(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if from := msg.Header.Get("From"); !strings.Contains(from, "Me") {
+			t.Errorf("From = %q, want the owner", from)
+		}
+		_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := multipart.NewReader(msg.Body, params["boundary"])
+
+		root, err := r.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		html, _ := io.ReadAll(root)
+		image, err := r.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cid := strings.Trim(image.Header.Get("Content-Id"), "<>")
+		if !strings.Contains(string(html), `src="cid:`+cid+`"`) || !strings.Contains(string(html), "look") {
+			t.Errorf("HTML body does not reference the image %q and caption:\n%s", cid, html)
+		}
+		data, _ := io.ReadAll(image)
+		if strings.TrimSpace(string(data)) != "aGVsbG8=" {
+			t.Errorf("image data = %q", data)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package export
+
+import (
+	"html/template"
+	"io"
+
+	"github.com/junkblocker/sbr/thread"
+)
+
+// IndexEntry links one exported thread from the index page.
+type IndexEntry struct {
+	Thread *thread.Thread
+	// Href is the path of the thread's page relative to the index.
+	Href string
+}
+
+var funcs = template.FuncMap{
+	"author":       author,
+	"formatTime":   formatTime,
+	"describePart": describePart,
+	"isSent":       func(m *thread.Message) bool { return m.Direction == thread.Sent },
+	"last": func(t *thread.Thread) *thread.Message {
+		if len(t.Messages) == 0 {
+			return nil
+		}
+		return t.Messages[len(t.Messages)-1]
+	},
+}
+
+const style = `
+body { font-family: system-ui, sans-serif; max-width: 48rem; margin: 2rem auto; background: #f4f4f6; color: #222; }
+h1 { font-size: 1.3rem; }
+.participants { color: #666; font-size: .9rem; }
+.msg { margin: .6rem 0; display: flex; flex-direction: column; }
+.msg.sent { align-items: flex-end; }
+.bubble { max-width: 75%; padding: .5rem .8rem; border-radius: 1rem; background: #fff; white-space: pre-wrap; word-wrap: break-word; }
+.sent .bubble { background: #0b84ff; color: #fff; }
+.meta { font-size: .75rem; color: #888; margin: 0 .5rem .15rem; }
+.part { font-size: .8rem; opacity: .8; }
+.slide + .slide { border-top: 1px dashed currentColor; margin-top: .4rem; padding-top: .4rem; }
+table { border-collapse: collapse; width: 100%; }
+td { padding: .3rem .5rem; border-bottom: 1px solid #ddd; }
+`
+
+var threadTemplate = template.Must(template.New("thread").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>` + style + `</style>
+</head>
+<body>
+<h1>{{if .Group}}Group conversation{{else}}Conversation{{end}} with {{.Title}}</h1>
+<p class="participants">{{range $i, $p := .Participants}}{{if $i}}, {{end}}{{$p.Label}}{{range $p.Addresses}} &lt;{{.}}&gt;{{end}}{{end}}</p>
+{{range .Messages}}<div class="msg{{if isSent .}} sent{{end}}">
+<div class="meta">{{author .}} · {{formatTime .Time}}</div>
+<div class="bubble">{{if .Slides}}{{range .Slides}}<div class="slide">{{range .Parts}}
+<div class="part">📎 {{describePart .}}</div>{{end}}{{if .Text}}
+<div>{{.Text}}</div>{{end}}</div>{{end}}{{else}}{{.Body}}{{range .Parts}}
+<div class="part">📎 {{describePart .}}</div>{{end}}{{end}}</div>
+</div>
+{{end}}</body>
+</html>
+`))
+
+var indexTemplate = template.Must(template.New("index").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Conversations</title>
+<style>` + style + `</style>
+</head>
+<body>
+<h1>Conversations</h1>
+<table>
+{{range .}}<tr><td><a href="{{.Href}}">{{.Thread.Title}}</a>{{if .Thread.Group}} (group){{end}}</td><td>{{len .Thread.Messages}} message(s)</td><td>{{with last .Thread}}{{formatTime .Time}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTML renders t as a self-contained HTML page laid out like a phone's
+// messaging app: received messages on the left, sent on the right. MMS with a
+// SMIL presentation are shown slide by slide.
+func WriteHTML(w io.Writer, t *thread.Thread) error {
+	return threadTemplate.Execute(w, t)
+}
+
+// WriteHTMLIndex renders an index page linking to every exported thread.
+func WriteHTMLIndex(w io.Writer, entries []IndexEntry) error {
+	return indexTemplate.Execute(w, entries)
+}
@@ -0,0 +1,113 @@
+// Package export renders reconstructed conversations (see package thread) as
+// human-readable documents.
+package export
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/thread"
+	"github.com/junkblocker/sbr/types"
+)
+
+// timeLayout is used for message timestamps in every export format.
+const timeLayout = "2006-01-02 15:04:05"
+
+// ownerLabel names the backup owner as the author of sent messages.
+const ownerLabel = "Me"
+
+// WriteText renders t as plain text, one message per paragraph.
+func WriteText(w io.Writer, t *thread.Thread) error {
+	ew := &errWriter{w: w}
+
+	kind := "Conversation"
+	if t.Group {
+		kind = "Group conversation"
+	}
+	ew.printf("%s with %s\n", kind, t.Title())
+	for _, p := range t.Participants {
+		ew.printf("  %s\n", participantLine(p.Label(), p.Addresses))
+	}
+	ew.printf("%d message(s)\n", len(t.Messages))
+
+	for _, m := range t.Messages {
+		ew.printf("\n[%s] %s:\n", formatTime(m.Time), author(m))
+		if m.Body != "" {
+			for _, line := range strings.Split(m.Body, "\n") {
+				ew.printf("  %s\n", line)
+			}
+		}
+		for _, p := range m.Parts {
+			ew.printf("  [%s]\n", describePart(p))
+		}
+	}
+	return ew.err
+}
+
+// Filename returns a filesystem-safe, stable filename for t with the given
+// extension: a readable slug of the title plus a short hash of the thread ID,
+// so two threads with the same title never collide.
+func Filename(t *thread.Thread, ext string) string {
+	sum := sha256.Sum256([]byte(t.ID))
+	title := processor.SanitiseFilename(t.Title())
+	if r := []rune(title); len(r) > 60 {
+		title = string(r[:60])
+	}
+	if title == "" {
+		title = "thread"
+	}
+	return fmt.Sprintf("%s-%x%s", title, sum[:4], ext)
+}
+
+func author(m *thread.Message) string {
+	if m.Direction == thread.Sent {
+		return ownerLabel
+	}
+	if m.Sender == nil {
+		return "(Unknown)"
+	}
+	return m.Sender.Label()
+}
+
+func describePart(p thread.Part) string {
+	name := p.Name
+	if name == "" {
+		name = fmt.Sprintf("part %d", p.Index)
+	}
+	return fmt.Sprintf("attachment: %s, %s, %s", name, p.ContentType, types.FormatBytes(p.Size))
+}
+
+func participantLine(label string, addrs []types.PhoneNumber) string {
+	if len(addrs) == 0 || (len(addrs) == 1 && string(addrs[0]) == label) {
+		return label
+	}
+	s := make([]string, len(addrs))
+	for i, a := range addrs {
+		s[i] = string(a)
+	}
+	return fmt.Sprintf("%s <%s>", label, strings.Join(s, ", "))
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown date"
+	}
+	return t.Format(timeLayout)
+}
+
+// errWriter latches the first write error so rendering code can print
+// unconditionally and check once at the end.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...any) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
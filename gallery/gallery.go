@@ -0,0 +1,186 @@
+package gallery
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PageName is the name of the contact sheet written by Build.
+const PageName = "gallery.html"
+
+// Entry is one image on the contact sheet.
+type Entry struct {
+	// Path is the image file, inside the gallery's output directory.
+	Path string
+	Time time.Time
+	// Sender labels who sent the image.
+	Sender string
+}
+
+// Build writes a thumbnail of every entry to outDir/.thumbs (see Thumbnail)
+// and the contact sheet to outDir/gallery.html. Images that cannot be decoded
+// are left off the sheet and reported in errs; they do not stop the build.
+// Thumbnails are generated in parallel.
+func Build(outDir string, entries []Entry, size int) (n int, errs []error) {
+	thumbDir := filepath.Join(outDir, ThumbDir)
+	if err := os.MkdirAll(thumbDir, 0o755); err != nil {
+		return 0, []error{err}
+	}
+
+	thumbs := make([]string, len(entries))
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	idx := make(chan int)
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				thumb, err := Thumbnail(entries[i].Path, thumbDir, size)
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+					continue
+				}
+				thumbs[i] = thumb
+			}
+		}()
+	}
+	for i := range entries {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+
+	var items []item
+	for i, e := range entries {
+		if thumbs[i] == "" {
+			continue
+		}
+		href, err := relURL(outDir, e.Path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		thumb, err := relURL(outDir, thumbs[i])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		items = append(items, item{Entry: e, Href: href, Thumb: thumb})
+	}
+
+	if err := savePage(filepath.Join(outDir, PageName), items); err != nil {
+		return 0, append(errs, err)
+	}
+	return len(items), errs
+}
+
+// savePage writes the contact sheet of items to path, through a temp file so
+// that an interrupted build leaves the previous page in place.
+func savePage(path string, items []item) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".sbr-*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temp file for %s: %w", path, err)
+	}
+	err = writePage(tmp, items)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// relURL returns path relative to base as a URL path.
+func relURL(base, path string) (string, error) {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Path: filepath.ToSlash(rel)}).EscapedPath(), nil
+}
+
+type item struct {
+	Entry
+	Href, Thumb string
+}
+
+type senderGroup struct {
+	Sender string
+	Items  []item
+}
+
+type dayGroup struct {
+	Day     string
+	Senders []senderGroup
+}
+
+// group orders items newest day first; within a day by sender, and each
+// sender's images chronologically.
+func group(items []item) []dayGroup {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Time.Before(items[j].Time) })
+	byDay := make(map[string]map[string][]item)
+	for _, it := range items {
+		day := it.Time.Format("2006-01-02")
+		if byDay[day] == nil {
+			byDay[day] = make(map[string][]item)
+		}
+		byDay[day][it.Sender] = append(byDay[day][it.Sender], it)
+	}
+	days := make([]dayGroup, 0, len(byDay))
+	for day, senders := range byDay {
+		g := dayGroup{Day: day}
+		for sender, its := range senders {
+			g.Senders = append(g.Senders, senderGroup{Sender: sender, Items: its})
+		}
+		sort.Slice(g.Senders, func(i, j int) bool { return g.Senders[i].Sender < g.Senders[j].Sender })
+		days = append(days, g)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day > days[j].Day })
+	return days
+}
+
+var pageTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Gallery</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2rem; background: #f4f4f6; color: #222; }
+h2 { font-size: 1.1rem; margin: 1.5rem 0 .3rem; border-bottom: 1px solid #ccc; }
+h3 { font-size: .9rem; color: #666; margin: .6rem 0 .3rem; }
+.sheet { display: flex; flex-wrap: wrap; gap: .4rem; }
+.sheet img { height: 128px; border-radius: .3rem; background: #fff; }
+</style>
+</head>
+<body>
+<h1>Gallery</h1>
+{{range .}}<h2>{{.Day}}</h2>
+{{range .Senders}}<h3>{{.Sender}}</h3>
+<div class="sheet">{{range .Items}}
+<a href="{{.Href}}"><img src="{{.Thumb}}" loading="lazy" alt="" title="{{.Time.Format "15:04:05"}}"></a>{{end}}
+</div>
+{{end}}{{end}}</body>
+</html>
+`))
+
+func writePage(w io.Writer, items []item) error {
+	return pageTemplate.Execute(w, group(items))
+}
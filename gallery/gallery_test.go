@@ -0,0 +1,162 @@
+package gallery
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePNG writes a w×h PNG of a solid colour and returns its path.
+func writePNG(t *testing.T, dir, name string, w, h int, c color.Color) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err = png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func decodeJPEG(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := jpeg.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestThumbnail(t *testing.T) {
+	dir := t.TempDir()
+	thumbs := t.TempDir()
+
+	wide := writePNG(t, dir, "wide.png", 600, 300, color.RGBA{200, 10, 10, 255})
+	thumb, err := Thumbnail(wide, thumbs, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := decodeJPEG(t, thumb)
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("thumbnail is %dx%d, want 100x50", b.Dx(), b.Dy())
+	}
+	if r, _, _, _ := img.At(50, 25).RGBA(); r>>8 < 180 {
+		t.Errorf("thumbnail colour lost: red = %d", r>>8)
+	}
+
+	// Identical content in another file reuses the same thumbnail.
+	data, _ := os.ReadFile(wide)
+	copyPath := filepath.Join(dir, "copy.png")
+	if err = os.WriteFile(copyPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Thumbnail(copyPath, thumbs, 100)
+	if err != nil || again != thumb {
+		t.Errorf("Thumbnail(copy) = %q, %v; want %q", again, err, thumb)
+	}
+
+	// Small images keep their size; transparency becomes white.
+	small := writePNG(t, dir, "small.png", 20, 40, color.RGBA{})
+	thumb, err = Thumbnail(small, thumbs, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = decodeJPEG(t, thumb)
+	if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 40 {
+		t.Errorf("small thumbnail is %dx%d, want 20x40", b.Dx(), b.Dy())
+	}
+	if r, g, b, _ := img.At(10, 10).RGBA(); r>>8 < 240 || g>>8 < 240 || b>>8 < 240 {
+		t.Errorf("transparent pixel = %d,%d,%d, want white", r>>8, g>>8, b>>8)
+	}
+
+	if _, err = Thumbnail(writeFile(t, dir, "bad.png", "not an image"), thumbs, 100); err == nil {
+		t.Error("Thumbnail accepted a non-image")
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBuild(t *testing.T) {
+	out := t.TempDir()
+	day1 := time.Date(2024, 1, 15, 10, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+	entries := []Entry{
+		{Path: writePNG(t, out, "a #1.png", 10, 10, color.White), Time: day1, Sender: "Bob"},
+		{Path: writePNG(t, out, "b.png", 10, 10, color.Black), Time: day2, Sender: "Me"},
+		{Path: writePNG(t, out, "c.png", 12, 10, color.Black), Time: day1.Add(time.Hour), Sender: "Ann"},
+		{Path: writeFile(t, out, "bad.png", "junk"), Time: day1, Sender: "Ann"},
+	}
+	n, errs := Build(out, entries, 64)
+	if n != 3 || len(errs) != 1 {
+		t.Fatalf("Build = %d, %v; want 3 images and 1 error", n, errs)
+	}
+	page, err := os.ReadFile(filepath.Join(out, PageName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(page)
+	// Newest day first; senders sorted within a day.
+	order := []string{"<h2>2024-01-16</h2>", "<h3>Me</h3>", "<h2>2024-01-15</h2>", "<h3>Ann</h3>", "<h3>Bob</h3>"}
+	last := -1
+	for _, s := range order {
+		i := strings.Index(html, s)
+		if i <= last {
+			t.Fatalf("%q missing or out of order in:\n%s", s, html)
+		}
+		last = i
+	}
+	if !strings.Contains(html, `href="a%20%231.png"`) {
+		t.Errorf("image link not URL-escaped:\n%s", html)
+	}
+	if strings.Contains(html, "bad.png") {
+		t.Error("undecodable image listed")
+	}
+}
+
+func TestThumbnail_MaxPixels(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile(writePNG(t, dir, "tiny.png", 1, 1, color.White))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Claim 100000x100000 pixels in the IHDR chunk, which follows the 8-byte
+	// signature, and fix up its CRC.
+	binary.BigEndian.PutUint32(data[16:], 100000)
+	binary.BigEndian.PutUint32(data[20:], 100000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	huge := writeFile(t, dir, "huge.png", string(data))
+
+	_, err = Thumbnail(huge, t.TempDir(), 100)
+	if err == nil || !strings.Contains(err.Error(), "pixel limit") {
+		t.Errorf("Thumbnail(huge) = %v, want the pixel limit error", err)
+	}
+}
@@ -0,0 +1,163 @@
+package gallery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IndexFile is the name of the gallery index inside the thumbnail directory.
+const IndexFile = "index.json"
+
+// Record is what the index keeps of one image: enough to place it on the
+// contact sheet without reading the backup it came from again.
+type Record struct {
+	// Path is the image's '/'-separated path relative to the output
+	// directory.
+	Path string    `json:"path"`
+	Time time.Time `json:"time"`
+	// Sender is the raw address the image came from and Sent whether the
+	// backup owner sent it; Address and ContactName are its message's, for
+	// resolving Sender to a contact. All are empty for an image found in the
+	// directory without having been extracted with the gallery on.
+	Sender      string `json:"sender,omitempty"`
+	Sent        bool   `json:"sent,omitempty"`
+	Address     string `json:"address,omitempty"`
+	ContactName string `json:"contact_name,omitempty"`
+}
+
+// Index records the images of an output directory across runs, so that the
+// contact sheet lists every image there, not only those one run extracted.
+type Index struct {
+	outDir  string
+	records map[string]Record
+}
+
+// OpenIndex loads the index of outDir; a missing index is empty.
+func OpenIndex(outDir string) (*Index, error) {
+	x := &Index{outDir: outDir, records: make(map[string]Record)}
+	data, err := os.ReadFile(x.path())
+	if errors.Is(err, fs.ErrNotExist) {
+		return x, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err = json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", x.path(), err)
+	}
+	for _, r := range records {
+		x.records[r.Path] = r
+	}
+	return x, nil
+}
+
+func (x *Index) path() string {
+	return filepath.Join(x.outDir, ThumbDir, IndexFile)
+}
+
+// Add records r, replacing any record of the same path.
+func (x *Index) Add(r Record) {
+	x.records[r.Path] = r
+}
+
+// Sync brings the index in line with the directory: records of images no
+// longer there are dropped, and images not yet recorded are added with their
+// modification time, which extraction sets to the message time. It returns
+// the records, sorted by path.
+func (x *Index) Sync() ([]Record, error) {
+	present := make(map[string]bool)
+	err := filepath.WalkDir(x.outDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != x.outDir && strings.HasPrefix(d.Name(), ".") {
+			// .thumbs, the ledger and temp files.
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !isImageName(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(x.outDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		present[rel] = true
+		if _, ok := x.records[rel]; !ok {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			x.records[rel] = Record{Path: rel, Time: info.ModTime()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning %s: %w", x.outDir, err)
+	}
+	records := make([]Record, 0, len(present))
+	for rel, r := range x.records {
+		if !present[rel] {
+			delete(x.records, rel)
+			continue
+		}
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Path < records[j].Path })
+	return records, nil
+}
+
+// Save writes the index, through a temp file so that an interrupted run
+// leaves the previous index in place.
+func (x *Index) Save() error {
+	records := make([]Record, 0, len(x.records))
+	for _, r := range x.records {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Path < records[j].Path })
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := x.path()
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".sbr-*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temp file for %s: %w", path, err)
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// isImageName reports whether a file's extension is one an image IsImage
+// accepts is saved under.
+func isImageName(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package gallery
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndex(t *testing.T) {
+	out := t.TempDir()
+	writePNG(t, out, "a.png", 4, 4, color.White)
+	writePNG(t, out, "gone.png", 4, 4, color.White)
+	if err := os.MkdirAll(filepath.Join(out, "2024"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writePNG(t, filepath.Join(out, "2024"), "b.png", 4, 4, color.Black)
+	writeFile(t, out, "note.txt", "not an image")
+	mtime := time.Date(2024, 1, 15, 11, 30, 45, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(out, "2024", "b.png"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := OpenIndex(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := Record{Path: "a.png", Time: mtime.Add(time.Hour), Sender: "+1", Sent: true}
+	x.Add(sent)
+	x.Add(Record{Path: "gone.png", Sender: "+2"})
+	if err = os.Remove(filepath.Join(out, "gone.png")); err != nil {
+		t.Fatal(err)
+	}
+	records, err := x.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// gone.png is dropped, 2024/b.png found with its file time and no
+	// sender, and note.txt left out.
+	if len(records) != 2 || records[0].Path != "2024/b.png" || !records[0].Time.Equal(mtime) ||
+		records[0].Sender != "" || records[1] != sent {
+		t.Fatalf("Sync = %+v", records)
+	}
+	if err = x.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later run finds what the first recorded, thumbnails and all.
+	if _, errs := Build(out, nil, 64); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	again, err := OpenIndex(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err = again.Sync()
+	if err != nil || len(records) != 2 || records[1] != sent {
+		t.Errorf("reloaded Sync = %+v, %v", records, err)
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/junkblocker/sbr
 
 go 1.22.0
+
+require golang.org/x/text v0.21.0
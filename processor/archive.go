@@ -0,0 +1,149 @@
+package processor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// archiveSink is what TarSink and ZipSink share: the names written so far,
+// and a lock that keeps each file's entry whole.
+type archiveSink struct {
+	mu    sync.Mutex
+	names map[string]bool
+	err   error // the first write error; the archive is unusable after it
+}
+
+func (s *archiveSink) Exists(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.names[name], nil
+}
+
+func (s *archiveSink) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.names))
+	for name := range s.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// put writes one entry with write, unless name was written before.
+func (s *archiveSink) put(name string, write func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if s.names[name] {
+		return nil
+	}
+	if err := write(); err != nil {
+		s.err = fmt.Errorf("writing %s to archive: %w", name, err)
+		return s.err
+	}
+	s.names[name] = true
+	return nil
+}
+
+// TarSink is a Sink writing a tar archive, optionally gzip-compressed, to a
+// stream. Only files put in this run exist in it, so every run writes a
+// complete archive. Close finishes the archive.
+type TarSink struct {
+	archiveSink
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+// NewTarSink returns a TarSink writing to w, compressed with gzip if
+// compress is set.
+func NewTarSink(w io.Writer, compress bool) *TarSink {
+	s := &TarSink{archiveSink: archiveSink{names: make(map[string]bool)}}
+	if compress {
+		s.gz = gzip.NewWriter(w)
+		w = s.gz
+	}
+	s.tw = tar.NewWriter(w)
+	return s
+}
+
+func (s *TarSink) Put(name string, data []byte, mtime time.Time) error {
+	return s.put(name, func() error {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(data)),
+			ModTime:  mtime,
+		}
+		if err := s.tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := s.tw.Write(data)
+		return err
+	})
+}
+
+// Close writes the end of the archive. It does not close the underlying
+// writer.
+func (s *TarSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.tw.Close()
+	if s.gz != nil {
+		if gzErr := s.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if s.err != nil {
+		return s.err
+	}
+	return err
+}
+
+// ZipSink is a Sink writing a zip archive to a stream. Like TarSink, it
+// holds only the files put in this run. Close finishes the archive.
+type ZipSink struct {
+	archiveSink
+	zw *zip.Writer
+}
+
+// NewZipSink returns a ZipSink writing to w.
+func NewZipSink(w io.Writer) *ZipSink {
+	return &ZipSink{archiveSink: archiveSink{names: make(map[string]bool)}, zw: zip.NewWriter(w)}
+}
+
+func (s *ZipSink) Put(name string, data []byte, mtime time.Time) error {
+	return s.put(name, func() error {
+		w, err := s.zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: mtime,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+// Close writes the archive's central directory. It does not close the
+// underlying writer.
+func (s *ZipSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.zw.Close()
+	if s.err != nil {
+		return s.err
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTarSink(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+		sink := NewTarSink(&buf, compress)
+		opts := Options{Sink: sink, Location: time.UTC, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+		ProcessFile(strings.NewReader(sinkDoc), "sms-1.xml", "out.tar", opts)
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var r io.Reader = &buf
+		if compress {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = gz
+		}
+		tr := tar.NewReader(r)
+		got := make(map[string]string)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(tr)
+			got[hdr.Name] = string(data)
+			if hdr.ModTime.Unix() != 1705318245 {
+				t.Errorf("%s: mtime %v", hdr.Name, hdr.ModTime)
+			}
+		}
+		if len(got) != 3 || got["2024-01-15-113045-a.jpg"] != "A" || got["2024-01-15-113045-1.png"] != "P" {
+			t.Errorf("compress=%t: archive holds %q", compress, got)
+		}
+		if names, _ := sink.List(); len(names) != 3 {
+			t.Errorf("List = %q", names)
+		}
+	}
+}
+
+func TestZipSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewZipSink(&buf)
+	opts := Options{Sink: sink, Location: time.UTC, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	ProcessFile(strings.NewReader(sinkDoc), "sms-1.xml", "out.zip", opts)
+	// Putting a name again keeps the first entry.
+	if err := sink.Put("2024-01-15-113045-a.jpg", []byte("X"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 3 {
+		t.Fatalf("archive has %d entries, want 3", len(zr.File))
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if f.Name == "2024-01-15-113045-a.jpg" && string(data) != "A" {
+			t.Errorf("%s holds %q", f.Name, data)
+		}
+		if f.Modified.Unix() != 1705318245 {
+			t.Errorf("%s: mtime %v", f.Name, f.Modified)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/junkblocker/sbr/rcs"
+)
+
+// emitBotMessage plans the files for one RCS bot message part: the JSON as
+// received ("<stem>.json") plus text and HTML renderings of its cards
+// ("<stem>.txt", "<stem>.html"). The stem is the part's attachment name without
+// its extension, so the three sort together next to the message's other
+// attachments. A collision on the JSON name disambiguates all three with the
+// JSON's content hash.
+//
+// The JSON is saved even when it cannot be parsed, so nothing is lost; only
+// the renderings are skipped.
+func emitBotMessage(part mmsPart, partIndex int, datePrefix string, sentTime time.Time, outPath string, seenKeys map[string]bool, log *slog.Logger, emit func(workItem)) {
+	raw, err := botMessageJSON(part)
+	if err != nil {
+		log.Error("decoding bot message", "date", sentTime, "part", partIndex, "err", err)
+		return
+	}
+	if raw == nil {
+		return
+	}
+	log.Log(context.Background(), LevelTrace, "bot message", "date", sentTime, "part", partIndex, "json", string(raw))
+
+	// Name the part as an attachment with the bot message extension, whatever
+	// extension its cl happens to carry.
+	stemOf := func(disambigHash string) string {
+		name := buildFilenameInternal(part, datePrefix, partIndex, disambigHash)
+		return strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	naturalKey := strings.ToLower(stemOf("") + ".json")
+	var disambigHash string
+	if seenKeys[naturalKey] {
+		disambigHash = contentHash(raw)
+	}
+	seenKeys[naturalKey] = true
+	stem := stemOf(disambigHash)
+
+	item := func(ext string, content []byte) workItem {
+		return workItem{
+			datePrefix:   datePrefix,
+			sentTime:     sentTime,
+			outPath:      outPath,
+			partIndex:    partIndex,
+			disambigHash: disambigHash,
+			content:      content,
+			name:         stem + ext,
+		}
+	}
+	emit(item(".json", raw))
+
+	msg, err := rcs.Parse(raw)
+	if err != nil {
+		log.Error("parsing bot message", "date", sentTime, "part", partIndex, "err", err)
+		return
+	}
+	var text, html bytes.Buffer
+	if err = rcs.WriteText(&text, msg); err != nil {
+		log.Error("rendering bot message", "date", sentTime, "part", partIndex, "err", err)
+		return
+	}
+	if err = rcs.WriteHTML(&html, msg); err != nil {
+		log.Error("rendering bot message", "date", sentTime, "part", partIndex, "err", err)
+		return
+	}
+	emit(item(".txt", text.Bytes()))
+	emit(item(".html", html.Bytes()))
+}
+
+// botMessageJSON returns the JSON carried by a bot message part: its text
+// attribute, or its base64 data when the text attribute is empty. It returns
+// nil if the part is empty.
+func botMessageJSON(part mmsPart) ([]byte, error) {
+	if part.Text != "" && part.Text != "null" {
+		return []byte(part.Text), nil
+	}
+	if part.Data == "" || part.Data == "null" {
+		return nil, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(part.Data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding bot message data: %w", err)
+	}
+	return raw, nil
+}
@@ -0,0 +1,56 @@
+package processor
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessFile_BotMessage(t *testing.T) {
+	card := `{"message":{"generalPurposeCard":{"content":{"title":"Boarding pass","description":"Gate 12"}}}}`
+	doc := func(cl string, data string) string {
+		return `<smses><mms date="1705318245000" address="Airline">
+    <parts>
+      <part seq="0" ct="application/vnd.gsma.botmessage.v1.0+json" cl="` + cl + `" text="null" data="` + data + `"/>
+    </parts>
+  </mms></smses>`
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(card))
+
+	t.Run("json and renderings saved", func(t *testing.T) {
+		dir := t.TempDir()
+		ProcessFile(strings.NewReader(doc("null", encoded)), "test.xml", dir, Options{})
+
+		assertFile(t, filepath.Join(dir, ts1Prefix+"-0.json"), []byte(card))
+		assertFile(t, filepath.Join(dir, ts1Prefix+"-0.txt"), []byte("Boarding pass\nGate 12\n"))
+		html, err := os.ReadFile(filepath.Join(dir, ts1Prefix+"-0.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(html), "<h2>Boarding pass</h2>") {
+			t.Errorf("HTML rendering missing card title:\n%s", html)
+		}
+
+		if report := VerifyFile(strings.NewReader(doc("null", encoded)), "test.xml", dir, Options{}); !report.Clean() || report.OK != 3 {
+			t.Errorf("verify report = %+v, want 3 ok", report)
+		}
+	})
+
+	t.Run("named part keeps its stem", func(t *testing.T) {
+		dir := t.TempDir()
+		ProcessFile(strings.NewReader(doc("card.bin", encoded)), "test.xml", dir, Options{})
+		assertFile(t, filepath.Join(dir, ts1Prefix+"-card.json"), []byte(card))
+		assertFile(t, filepath.Join(dir, ts1Prefix+"-card.txt"), []byte("Boarding pass\nGate 12\n"))
+	})
+
+	t.Run("invalid json saved without renderings", func(t *testing.T) {
+		dir := t.TempDir()
+		bad := base64.StdEncoding.EncodeToString([]byte(`{"message":`))
+		ProcessFile(strings.NewReader(doc("null", bad)), "test.xml", dir, Options{})
+		if names := readDir(t, dir); len(names) != 1 || names[0] != ts1Prefix+"-0.json" {
+			t.Errorf("got %v, want only the JSON", names)
+		}
+	})
+}
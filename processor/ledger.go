@@ -0,0 +1,202 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// LedgerFile is the name of the processed-input ledger kept in the output
+// directory.
+const LedgerFile = ".sbr-ledger.json"
+
+// fingerprintChunk is how much of each end of a file fingerprint hashes.
+const fingerprintChunk int64 = 64 << 10
+
+// Ledger records the backup files whose attachments have all been written to
+// an output directory, so that later runs can skip them without parsing.
+// A file counts as unchanged when its size and modification time match the
+// ledger, or, if only the time differs (the file was copied or synced again),
+// when its fingerprint - a hash of its size and first and last 64 KiB - does.
+// Files processed with different output options are never unchanged.
+//
+// A Ledger is safe for concurrent use.
+type Ledger struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]LedgerEntry
+}
+
+// LedgerEntry is the state of one input file when it was processed.
+type LedgerEntry struct {
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mtime"`
+	Fingerprint string    `json:"fingerprint"`
+	// Options summarises the Options that affect output filenames and
+	// content.
+	Options string `json:"options"`
+}
+
+// OpenLedger reads the ledger of outDir, which may not exist yet.
+func OpenLedger(outDir string) (*Ledger, error) {
+	l := &Ledger{path: filepath.Join(outDir, LedgerFile), entries: make(map[string]LedgerEntry)}
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &l.entries)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading ledger %s: %w", l.path, err)
+	}
+	return l, nil
+}
+
+// ledgerKey identifies an input file independently of the working directory.
+func ledgerKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// stamp returns the current state of the file at path.
+func stamp(path string, opts Options) (LedgerEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return LedgerEntry{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return LedgerEntry{}, err
+	}
+	fp, err := fingerprint(f, info.Size())
+	if err != nil {
+		return LedgerEntry{}, fmt.Errorf("fingerprinting %s: %w", path, err)
+	}
+	return LedgerEntry{
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		Fingerprint: fp,
+		Options:     opts.outputSignature(),
+	}, nil
+}
+
+func fingerprint(r io.ReaderAt, size int64) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n", size)
+	head := min(size, fingerprintChunk)
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, head)); err != nil {
+		return "", err
+	}
+	if size > head {
+		start := max(size-fingerprintChunk, head)
+		if _, err := io.Copy(h, io.NewSectionReader(r, start, size-start)); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)[:16]), nil
+}
+
+// Unchanged reports whether the file at path was processed with output
+// options equivalent to opts and has not changed since.
+func (l *Ledger) Unchanged(path string, opts Options) bool {
+	key := ledgerKey(path)
+	l.mu.Lock()
+	e, ok := l.entries[key]
+	l.mu.Unlock()
+	if !ok || e.Options != opts.outputSignature() {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != e.Size {
+		return false
+	}
+	if info.ModTime().Equal(e.ModTime) {
+		return true
+	}
+	now, err := stamp(path, opts)
+	if err != nil || now.Fingerprint != e.Fingerprint {
+		return false
+	}
+	// Same content under a new time: remember the time so the next check
+	// does not read the file.
+	_ = l.record(key, now)
+	return true
+}
+
+func (l *Ledger) record(key string, e LedgerEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[key] = e
+	data, err := json.MarshalIndent(l.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".sbr-*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temp file for %s: %w", l.path, err)
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), l.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("writing ledger %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// processWithLedger processes the file at path unless the ledger shows it is
+// unchanged (and opts.Force is not set), and records it once every attachment
+// is on disk. It returns an error if the file was not processed completely.
+func processWithLedger(l *Ledger, path, outPath string, opts Options) error {
+	log := opts.logger()
+	if !opts.Force && l.Unchanged(path, opts) {
+		log.Debug("skipping unchanged file", "file", path)
+		if opts.OnProgress != nil {
+			var size int64
+			if info, err := os.Stat(path); err == nil {
+				size = info.Size()
+			}
+			opts.progress(Progress{Kind: ProgressFileSkipped, File: path, Offset: size, Size: size})
+		}
+		return nil
+	}
+	// Stamp before processing: if the file changes while it is read, the
+	// recorded state no longer matches and the next run processes it again.
+	before, err := stamp(path, opts)
+	if err != nil {
+		log.Error("opening file", "file", path, "err", err)
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Error("opening file", "file", path, "err", err)
+		return err
+	}
+	defer file.Close()
+	if err = processFile(file, path, outPath, opts); err != nil {
+		// Already reported; leave the file out of the ledger so that it is
+		// retried.
+		return err
+	}
+	if err = l.record(ledgerKey(path), before); err != nil {
+		log.Error("recording file in ledger", "file", path, "err", err)
+		return err
+	}
+	return nil
+}
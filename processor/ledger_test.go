@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProcessDirectory_Ledger(t *testing.T) {
+	inDir, outDir := t.TempDir(), t.TempDir()
+	input := filepath.Join(inDir, "sms-1.xml")
+	doc := `<smses>
+  <mms date="1705318245000" address="+1">
+    <parts><part seq="0" ct="image/jpeg" cl="img.jpg" text="null" data="` + mustEncode("img") + `"/></parts>
+  </mms>
+</smses>`
+	if err := os.WriteFile(input, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(outDir, ts1Prefix+"-img.jpg")
+
+	// run processes the directory after removing the extracted file, and
+	// reports whether the input was processed (the file written again).
+	run := func(opts Options) bool {
+		t.Helper()
+		_ = os.Remove(out)
+		var wg sync.WaitGroup
+		ProcessDirectory(&wg, inDir, outDir, opts)
+		wg.Wait()
+		_, err := os.Stat(out)
+		return err == nil
+	}
+
+	if !run(Options{}) {
+		t.Fatal("first run did not process the input")
+	}
+	if run(Options{}) {
+		t.Error("unchanged input was processed again")
+	}
+	if !run(Options{Force: true}) {
+		t.Error("Force did not reprocess the input")
+	}
+	if !run(Options{SaveText: true}) {
+		t.Error("input was skipped although the output options changed")
+	}
+
+	// Copying the file again only changes its time: the fingerprint still
+	// matches.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(input, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if run(Options{SaveText: true}) {
+		t.Error("input with a new time but the same content was processed again")
+	}
+	l, err := OpenLedger(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := l.entries[ledgerKey(input)]; !e.ModTime.Equal(later) {
+		t.Errorf("ledger time = %v, want the new time %v", e.ModTime, later)
+	}
+
+	// New content of the same size is caught by the fingerprint.
+	if err = os.WriteFile(input, []byte(doc[:len(doc)-9]+"</smses>\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later = later.Add(time.Hour)
+	if err = os.Chtimes(input, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !run(Options{SaveText: true}) {
+		t.Error("changed input was skipped")
+	}
+
+	// Lenient decoding may recover messages a strict run could not.
+	if !run(Options{SaveText: true, Lenient: true}) {
+		t.Error("input was skipped although -lenient was added")
+	}
+}
+
+func TestProcessDirectory_LedgerSkipsIncomplete(t *testing.T) {
+	inDir, outDir := t.TempDir(), t.TempDir()
+	// A backup still being written: cut off mid-document.
+	doc := `<smses>
+  <mms date="1705318245000" address="+1">
+    <parts><part seq="0" ct="image/jpeg" cl="img.jpg" text="null" data="` + mustEncode("img") + `"/></parts>
+  </mms>
+  <mms date="17053`
+	if err := os.WriteFile(filepath.Join(inDir, "sms-1.xml"), []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	ProcessDirectory(&wg, inDir, outDir, Options{})
+	wg.Wait()
+
+	l, err := OpenLedger(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.entries) != 0 {
+		t.Errorf("truncated input was recorded as processed: %+v", l.entries)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	big := make([]byte, 3*fingerprintChunk)
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		e, err := stamp(path, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e.Fingerprint
+	}
+	a := write("a", big)
+	big[len(big)-1] = 1
+	if b := write("b", big); b == a {
+		t.Error("fingerprint ignores the end of the file")
+	}
+	big[len(big)-1] = 0
+	big[fingerprintChunk+1] = 1
+	if c := write("c", big); c != a {
+		t.Error("fingerprint reads the middle of the file")
+	}
+}
@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"log/slog"
+
+	"github.com/junkblocker/sbr/backup"
+)
+
+// recordReader feeds a decoder one byte at a time, so that nothing is read
+// ahead of the decoder's offset, and after a decoding error skips forward to
+// the next record for a new decoder to resume from.
+type recordReader struct {
+	br *bufio.Reader
+	// n counts the bytes consumed from br.
+	n int64
+	// prefix is read before br. A resumed decoder is handed an opening root
+	// element so that the closing one at the end of the file is not an
+	// error.
+	prefix string
+}
+
+func (r *recordReader) ReadByte() (byte, error) {
+	if r.prefix != "" {
+		c := r.prefix[0]
+		r.prefix = r.prefix[1:]
+		return c, nil
+	}
+	c, err := r.br.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return c, err
+}
+
+func (r *recordReader) Read(p []byte) (int, error) {
+	if r.prefix != "" {
+		n := copy(p, r.prefix)
+		r.prefix = r.prefix[n:]
+		return n, nil
+	}
+	n, err := r.br.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// skipToRecord discards input up to the next "<sms" or "<mms" start tag and
+// reports whether it found one.
+func (r *recordReader) skipToRecord() bool {
+	for {
+		peek, err := r.br.Peek(5)
+		if len(peek) == 5 && isRecordStart(peek) {
+			return true
+		}
+		if err != nil && len(peek) < 5 {
+			d, _ := r.br.Discard(len(peek))
+			r.n += int64(d)
+			return false
+		}
+		// Jump to the next '<' still buffered, if any.
+		step := 1
+		if buf, _ := r.br.Peek(r.br.Buffered()); len(buf) > 1 {
+			if i := bytes.IndexByte(buf[1:], '<'); i >= 0 {
+				step = i + 1
+			} else {
+				step = len(buf)
+			}
+		}
+		d, _ := r.br.Discard(step)
+		r.n += int64(d)
+	}
+}
+
+func isRecordStart(b []byte) bool {
+	if b[0] != '<' || (string(b[1:4]) != "sms" && string(b[1:4]) != "mms") {
+		return false
+	}
+	switch b[4] {
+	case ' ', '\t', '\n', '\r', '/', '>':
+		return true
+	}
+	return false
+}
+
+// recovery carries Options.Lenient decoding of one file: the sanitised input
+// (see backup.NewSanitiser) and the bytes and records skipped to get past
+// damage.
+type recovery struct {
+	san *backup.Filter
+	src *recordReader
+	// skippedBytes and skippedRecords total what was lost.
+	skippedBytes   int64
+	skippedRecords int
+}
+
+// newRecovery returns the lenient decoder of r.
+func newRecovery(r io.Reader) (*recovery, *xml.Decoder) {
+	san := backup.NewSanitiser(r)
+	rc := &recovery{san: san, src: &recordReader{br: bufio.NewReader(san)}}
+	return rc, xml.NewDecoder(rc.src)
+}
+
+// resume skips the damage found by a decoding error, from offset from (the
+// start of the record or token being decoded) to the next record. inRecord
+// says the error struck inside a record, which is then lost. It returns a
+// decoder for the rest of the file, with the offset in the file of the
+// decoder's first byte, or nil at the end of the file.
+func (rc *recovery) resume(from int64, inRecord bool, err error, log *slog.Logger) (*xml.Decoder, int64) {
+	found := rc.src.skipToRecord()
+	skipped := rc.src.n - from
+	if skipped > 0 || inRecord {
+		rc.skippedBytes += skipped
+		rc.skippedRecords++
+		log.Warn("skipping damaged input", "offset", from, "bytes", skipped, "err", err)
+	}
+	if !found {
+		return nil, 0
+	}
+	const root = "<smses>"
+	rc.src.prefix = root
+	return xml.NewDecoder(rc.src), rc.src.n - int64(len(root))
+}
+
+// report logs what recovery cost, if anything.
+func (rc *recovery) report(log *slog.Logger) {
+	if rc.skippedBytes > 0 || rc.skippedRecords > 0 || rc.san.Fixed > 0 {
+		log.Warn("recovered damaged file", "skipped_bytes", rc.skippedBytes,
+			"skipped_records", rc.skippedRecords, "replaced_chars", rc.san.Fixed)
+	}
+}
@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// lenientDoc has an illegal character in an SMS body, then a damaged SMS, then
+// two MMS.
+var lenientDoc = `<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>
+<smses count="4">
+  <mms date="1705318245000" address="+1"><parts><part seq="0" ct="image/jpeg" cl="a.jpg" data="` + mustEncode("a") + `"/></parts></mms>
+  <sms address="+1" date="1000" body="bell` + "\x07" + `&#7;"/>
+  <sms address="+1" date="2000" body="oops <<<"/>
+  <mms date="1705318246000" address="+1"><parts><part seq="0" ct="image/jpeg" cl="b.jpg" data="` + mustEncode("b") + `"/></parts></mms>
+</smses>
+`
+
+func lenientLog(t *testing.T, buf *bytes.Buffer) map[string]map[string]any {
+	t.Helper()
+	byMsg := make(map[string]map[string]any)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		byMsg[rec["msg"].(string)] = rec
+	}
+	return byMsg
+}
+
+func TestProcessFile_Lenient(t *testing.T) {
+	t.Run("strict stops at the first error", func(t *testing.T) {
+		dir := t.TempDir()
+		ProcessFile(strings.NewReader(lenientDoc), "sms-1.xml", dir, Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+		if got := readDir(t, dir); len(got) != 1 {
+			t.Errorf("strict run wrote %q, want only the first attachment", got)
+		}
+	})
+
+	t.Run("lenient resumes at the next record", func(t *testing.T) {
+		dir := t.TempDir()
+		var buf bytes.Buffer
+		opts := Options{Lenient: true, Logger: slog.New(slog.NewJSONHandler(&buf, nil))}
+		ProcessFile(strings.NewReader(lenientDoc), "sms-1.xml", dir, opts)
+		if got := readDir(t, dir); len(got) != 2 {
+			t.Errorf("lenient run wrote %q, want both attachments", got)
+		}
+		logs := lenientLog(t, &buf)
+		sum := logs["recovered damaged file"]
+		if sum == nil || sum["skipped_records"] != 1.0 || sum["replaced_chars"] != 2.0 {
+			t.Fatalf("summary = %v", sum)
+		}
+		skip := logs["skipping damaged input"]
+		start := strings.Index(lenientDoc, `<sms address="+1" date="2000"`)
+		end := strings.Index(lenientDoc, `<mms date="1705318246000"`)
+		if skip == nil || skip["offset"] != float64(start) || skip["bytes"] != float64(end-start) {
+			t.Errorf("skip = %v, want offset %d, bytes %d", skip, start, end-start)
+		}
+	})
+
+	t.Run("offsets stay file offsets", func(t *testing.T) {
+		var offsets []int64
+		opts := Options{Lenient: true, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+		err := PlanFile(strings.NewReader(lenientDoc), "sms-1.xml", opts, func(p Planned) {
+			offsets = append(offsets, p.Offset)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(offsets) != 2 {
+			t.Fatalf("planned %d attachments, want 2", len(offsets))
+		}
+		for _, off := range offsets {
+			if !strings.HasPrefix(lenientDoc[off:], "<mms ") {
+				t.Errorf("offset %d does not point at <mms: %q", off, lenientDoc[off:off+10])
+			}
+		}
+	})
+
+	t.Run("truncated file", func(t *testing.T) {
+		dir := t.TempDir()
+		cut := strings.Index(lenientDoc, "b.jpg")
+		var buf bytes.Buffer
+		opts := Options{Lenient: true, Logger: slog.New(slog.NewJSONHandler(&buf, nil))}
+		ProcessFile(strings.NewReader(lenientDoc[:cut]), "sms-1.xml", dir, opts)
+		if got := readDir(t, dir); len(got) != 1 {
+			t.Errorf("wrote %q, want the first attachment", got)
+		}
+		sum := lenientLog(t, &buf)["recovered damaged file"]
+		if sum == nil || sum["skipped_records"] != 2.0 {
+			t.Errorf("summary = %v, want the damaged SMS and the cut MMS skipped", sum)
+		}
+	})
+}
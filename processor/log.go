@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Levels below slog.LevelDebug, for the chattier debug verbosities.
+const (
+	// LevelVerbose reports files and attachments that are skipped.
+	LevelVerbose = slog.LevelDebug - 4
+	// LevelTrace reports every XML token and bot message payload.
+	LevelTrace = slog.LevelDebug - 8
+)
+
+// DebugLogLevel maps the -d debug verbosity (0 = quiet, 3 = very verbose) to
+// the minimum level to log.
+func DebugLogLevel(debugLevel uint) slog.Level {
+	switch debugLevel {
+	case 0:
+		return slog.LevelInfo
+	case 1:
+		return slog.LevelDebug
+	case 2:
+		return LevelVerbose
+	default:
+		return LevelTrace
+	}
+}
+
+// defaultLoggers holds, for each debug verbosity, the logger a nil
+// Options.Logger stands for, built on first use.
+var defaultLoggers = func() (loggers [4]func() *slog.Logger) {
+	for i := range loggers {
+		level := DebugLogLevel(uint(i))
+		loggers[i] = sync.OnceValue(func() *slog.Logger {
+			return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+		})
+	}
+	return loggers
+}()
+
+// logger returns the logger for processor diagnostics: o.Logger, or text on
+// standard output at the level o.DebugLevel selects.
+func (o Options) logger() *slog.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return defaultLoggers[min(o.DebugLevel, 3)]()
+}
+
+// withFile returns opts with a logger that tags every record with the backup
+// file being read.
+func withFile(opts Options, filePath string) Options {
+	opts.Logger = opts.logger().With("file", filePath)
+	return opts
+}
@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessFile_Logger(t *testing.T) {
+	dir := t.TempDir()
+	xmlDoc := `<smses>
+  <mms date="1705318245000" address="+1">
+    <parts>
+      <part seq="0" ct="image/jpeg" cl="a.jpg" data="` + mustEncode("x") + `"/>
+      <part seq="1" ct="application/x-strange" cl="b.bin" data="` + mustEncode("y") + `"/>
+    </parts>
+  </mms>
+  <mms date="not-a-date" address="+1"><parts/></mms>
+</smses>`
+
+	var buf bytes.Buffer
+	opts := Options{Logger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))}
+	ProcessFile(strings.NewReader(xmlDoc), "sms-1.xml", dir, opts)
+
+	byMsg := make(map[string]map[string]any)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		if rec["file"] != "sms-1.xml" {
+			t.Errorf("record %v has no file attribute", rec)
+		}
+		byMsg[rec["msg"].(string)] = rec
+	}
+
+	if rec := byMsg["processing file"]; rec == nil || rec["level"] != "DEBUG" {
+		t.Errorf("processing file record = %v", rec)
+	}
+	unknown := byMsg["unknown content type"]
+	if unknown == nil || unknown["level"] != "WARN" || unknown["part"] != 1.0 || unknown["content_type"] != "application/x-strange" {
+		t.Errorf("unknown content type record = %v", unknown)
+	}
+	if date, _ := time.Parse(time.RFC3339, unknown["date"].(string)); !date.Equal(time.UnixMilli(1705318245000)) {
+		t.Errorf("unknown content type date = %v", unknown["date"])
+	}
+	bad := byMsg["parsing MMS date"]
+	if bad == nil || bad["level"] != "ERROR" || bad["date"] != "not-a-date" || bad["err"] == nil {
+		t.Errorf("parsing MMS date record = %v", bad)
+	}
+}
+
+func TestDebugLogLevel(t *testing.T) {
+	want := []slog.Level{slog.LevelInfo, slog.LevelDebug, LevelVerbose, LevelTrace, LevelTrace}
+	for d, w := range want {
+		if got := DebugLogLevel(uint(d)); got != w {
+			t.Errorf("DebugLogLevel(%d) = %v, want %v", d, got, w)
+		}
+	}
+}
+
+func TestOptionsLogger_Default(t *testing.T) {
+	for d := uint(0); d <= 4; d++ {
+		o := Options{DebugLevel: d}
+		l := o.logger()
+		if l != o.logger() {
+			t.Errorf("DebugLevel %d: a new default logger on every call", d)
+		}
+		ctx := context.Background()
+		level := DebugLogLevel(d)
+		if !l.Enabled(ctx, level) || l.Enabled(ctx, level-1) {
+			t.Errorf("DebugLevel %d: default logger not at level %v", d, level)
+		}
+	}
+}
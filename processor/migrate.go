@@ -0,0 +1,195 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rename is one output file moved by a migration.
+type Rename struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// MigrateReport summarises how an output directory was renamed from one
+// naming convention to another.
+type MigrateReport struct {
+	// Renamed lists the files moved, or, in a dry run, that would be.
+	Renamed []Rename
+	// Conflicts lists files left alone because their new name is taken by a
+	// file that is not itself being renamed.
+	Conflicts []Rename
+	// Errors lists files that could not be planned or renamed.
+	Errors []error
+}
+
+// Merge folds other into r.
+func (r *MigrateReport) Merge(other MigrateReport) {
+	r.Renamed = append(r.Renamed, other.Renamed...)
+	r.Conflicts = append(r.Conflicts, other.Conflicts...)
+	r.Errors = append(r.Errors, other.Errors...)
+}
+
+// MigrateFile renames the files a backup file produced in outPath from the
+// names the options from give them to those the options to give them. Only
+// the naming options (Naming, Location, SubSecondDigits, Template,
+// SlideNumbers) may differ between the two: both are planned as ProcessFile
+// would, and files are paired in the order the plans produce them. Files that
+// do not exist under their old name are ignored, so running a migration
+// twice, or over a backup set whose files overlap, is harmless. With dryRun,
+// nothing is renamed.
+//
+// Files are moved to temporary names first, so that one file may take the
+// name another is giving up. Directories left empty are removed.
+func MigrateFile(filePath, outPath string, from, to Options, dryRun bool) MigrateReport {
+	report := PlanMigration([]string{filePath}, outPath, from, to)
+	if dryRun || len(report.Renamed) == 0 {
+		return report
+	}
+	report.Renamed, report.Errors = ApplyRenames(report.Renamed, outPath)
+	return report
+}
+
+// PlanMigration works out the renames MigrateFile would make for every one of
+// filePaths, taken together, without renaming anything. Files that cannot be
+// planned are reported as errors and contribute no renames.
+func PlanMigration(filePaths []string, outPath string, from, to Options) MigrateReport {
+	var (
+		report     MigrateReport
+		olds, news []string
+	)
+	for _, filePath := range filePaths {
+		o, err := planNames(filePath, outPath, from)
+		if err != nil {
+			report.Errors = append(report.Errors, err)
+			continue
+		}
+		n, err := planNames(filePath, outPath, to)
+		if err == nil && len(n) != len(o) {
+			err = fmt.Errorf("planning %s: the conventions differ in more than naming", filePath)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, err)
+			continue
+		}
+		olds = append(olds, o...)
+		news = append(news, n...)
+	}
+	report.Renamed, report.Conflicts = migrations(olds, news)
+	return report
+}
+
+// ApplyRenames makes the renames of a planned migration, and returns those it
+// made and the errors that stopped the others. Directories below top left
+// empty are removed.
+func ApplyRenames(renames []Rename, top string) (done []Rename, errs []error) {
+	var (
+		moved []Rename
+		temps []string
+	)
+	for i, r := range renames {
+		tmp := filepath.Join(filepath.Dir(r.Old), fmt.Sprintf(".sbr-migrate-%d.tmp", i))
+		if _, err := os.Lstat(tmp); err == nil {
+			errs = append(errs, fmt.Errorf("renaming %s: %s is in the way", r.Old, tmp))
+			continue
+		}
+		if err := os.Rename(r.Old, tmp); err != nil {
+			errs = append(errs, fmt.Errorf("renaming %s: %w", r.Old, err))
+			continue
+		}
+		moved = append(moved, r)
+		temps = append(temps, tmp)
+	}
+	for i, r := range moved {
+		err := os.MkdirAll(filepath.Dir(r.New), 0o755)
+		if err == nil {
+			err = os.Rename(temps[i], r.New)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("renaming %s to %s: %w", r.Old, r.New, err))
+			if err = os.Rename(temps[i], r.Old); err != nil {
+				// The file is left under its temporary name.
+				errs = append(errs, fmt.Errorf("restoring %s from %s: %w", r.Old, temps[i], err))
+			}
+			continue
+		}
+		done = append(done, r)
+	}
+	for _, r := range done {
+		removeEmptyDirs(filepath.Dir(r.Old), top)
+	}
+	return done, errs
+}
+
+// removeEmptyDirs removes dir and its parents below top for as long as they
+// are empty, tidying up after files a template had put in subdirectories.
+func removeEmptyDirs(dir, top string) {
+	top = filepath.Clean(top)
+	for dir = filepath.Clean(dir); dir != top && strings.HasPrefix(dir, top+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// planNames returns the output paths of the files a backup file produces in
+// outPath under opts, in the order planFile produces them.
+func planNames(filePath, outPath string, opts Options) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening file %s: %w", filePath, err)
+	}
+	defer file.Close()
+	var names []string
+	err = planFile(file, filePath, outPath, withFile(opts, filePath), func(item workItem) {
+		names = append(names, filepath.Join(item.outPath, item.filename()))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("planning %s: %w", filePath, err)
+	}
+	return names, nil
+}
+
+// migrations pairs old and new names into the renames to make: those whose
+// name changes and whose old file exists. A rename whose new name is taken,
+// by an existing file that is not moving away or by another rename, is a
+// conflict.
+func migrations(olds, news []string) (renames, conflicts []Rename) {
+	seen := make(map[string]bool)
+	for i, old := range olds {
+		if old == news[i] || seen[old] {
+			continue
+		}
+		if _, err := os.Lstat(old); err != nil {
+			continue
+		}
+		seen[old] = true
+		renames = append(renames, Rename{Old: old, New: news[i]})
+	}
+
+	// Dropping a conflicting rename leaves its file in place, which may in
+	// turn block another, so repeat until nothing changes.
+	for changed := true; changed; {
+		changed = false
+		moving := make(map[string]bool, len(renames))
+		for _, r := range renames {
+			moving[r.Old] = true
+		}
+		claimed := make(map[string]bool, len(renames))
+		kept := renames[:0]
+		for _, r := range renames {
+			_, err := os.Lstat(r.New)
+			if claimed[r.New] || err == nil && !moving[r.New] {
+				conflicts = append(conflicts, r)
+				changed = true
+				continue
+			}
+			claimed[r.New] = true
+			kept = append(kept, r)
+		}
+		renames = kept
+	}
+	return renames, conflicts
+}
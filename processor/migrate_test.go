@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDatePrefix_Options(t *testing.T) {
+	tests := []struct {
+		opts Options
+		want string
+	}{
+		{Options{Location: time.UTC}, "2024-01-15-113045"},
+		{Options{Location: time.UTC, SubSecondDigits: 1}, "2024-01-15-113045.1"},
+		{Options{Location: time.UTC, SubSecondDigits: 3}, "2024-01-15-113045.123"},
+		{Options{Location: time.UTC, SubSecondDigits: 9}, "2024-01-15-113045.123"},
+		{Options{Location: time.FixedZone("IST", 5*3600+1800)}, "2024-01-15-170045"},
+	}
+	for _, tt := range tests {
+		got, sent, err := tt.opts.datePrefix("1705318245123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("datePrefix(%v, %d) = %q, want %q", tt.opts.Location, tt.opts.SubSecondDigits, got, tt.want)
+		}
+		if tt.opts.SubSecondDigits > 0 && sent.UnixMilli() != 1705318245123 {
+			t.Errorf("sent time %v lost its milliseconds", sent)
+		}
+	}
+}
+
+func TestOutputSignature_Naming(t *testing.T) {
+	base := Options{}.outputSignature()
+	for _, o := range []Options{{Location: time.UTC}, {SubSecondDigits: 3}} {
+		if o.outputSignature() == base {
+			t.Errorf("signature of %+v matches the default's", o)
+		}
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	doc := `<smses>
+  <mms date="1705318245123" address="+1"><parts>
+    <part seq="0" ct="image/jpeg" cl="a.jpg" data="` + mustEncode("A") + `"/>
+    <part seq="1" ct="image/jpeg" cl="b.jpg" data="` + mustEncode("B") + `"/>
+  </parts></mms>
+</smses>`
+	dir := t.TempDir()
+	in := filepath.Join(dir, "sms-1.xml")
+	out := filepath.Join(dir, "out")
+	if err := os.WriteFile(in, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(out, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	from := Options{Location: time.FixedZone("X", 3600)}
+	to := Options{Location: time.UTC, SubSecondDigits: 3}
+	ProcessFileFromPath(in, out, from)
+	// An unrelated file already has one of the new names.
+	blocker := filepath.Join(out, "2024-01-15-113045.123-b.jpg")
+	if err := os.WriteFile(blocker, []byte("other"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dry := MigrateFile(in, out, from, to, true)
+	if len(dry.Renamed) != 1 || len(dry.Conflicts) != 1 || len(dry.Errors) != 0 {
+		t.Fatalf("dry run = %+v", dry)
+	}
+	if got := readDir(t, out); strings.Join(got, " ") != "2024-01-15-113045.123-b.jpg 2024-01-15-123045-a.jpg 2024-01-15-123045-b.jpg" {
+		t.Fatalf("dry run changed the directory: %q", got)
+	}
+
+	report := MigrateFile(in, out, from, to, false)
+	if len(report.Renamed) != 1 || len(report.Errors) != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	if r := report.Renamed[0]; filepath.Base(r.Old) != "2024-01-15-123045-a.jpg" || filepath.Base(r.New) != "2024-01-15-113045.123-a.jpg" {
+		t.Errorf("renamed %+v", r)
+	}
+	if c := report.Conflicts[0]; filepath.Base(c.Old) != "2024-01-15-123045-b.jpg" {
+		t.Errorf("conflict %+v", c)
+	}
+	if got, _ := os.ReadFile(filepath.Join(out, "2024-01-15-113045.123-a.jpg")); string(got) != "A" {
+		t.Errorf("migrated content = %q", got)
+	}
+
+	// Once migrated, there is nothing left to do.
+	if again := MigrateFile(in, out, from, to, false); len(again.Renamed) != 0 || len(again.Errors) != 0 {
+		t.Errorf("second run = %+v", again)
+	}
+}
+
+func TestMigrations_Swap(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for _, p := range []string{a, b} {
+		if err := os.WriteFile(p, []byte(filepath.Base(p)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	renames, conflicts := migrations([]string{a, b}, []string{b, a})
+	if len(renames) != 2 || len(conflicts) != 0 {
+		t.Errorf("renames %v, conflicts %v: names given up should be free to take", renames, conflicts)
+	}
+}
+
+func TestRemoveEmptyDirs(t *testing.T) {
+	top := t.TempDir()
+	deep := filepath.Join(top, "2024", "Ann")
+	if err := os.MkdirAll(deep, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(top, "2024", "keep"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	removeEmptyDirs(deep, top)
+	if _, err := os.Stat(deep); !os.IsNotExist(err) {
+		t.Errorf("empty directory left: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(top, "2024")); err != nil {
+		t.Errorf("non-empty directory removed: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/junkblocker/sbr/types"
+)
+
+// Naming selects the rules that name attachments. Trees extracted by earlier
+// releases, or through BuildFilename, follow rules that differ from the
+// current ones, so a re-run would extract their attachments again under new
+// names; MigrateFile with the old Naming in its from options renames them
+// instead. New trees should use NamingCurrent.
+type Naming int
+
+const (
+	// NamingCurrent is the convention ProcessFile uses.
+	NamingCurrent Naming = iota
+	// NamingV1 is the convention before part names were decoded using their
+	// chset (naming version 1).
+	NamingV1
+	// NamingBuildFilename is BuildFilename's convention: names are used
+	// unsanitised, unnamed parts are "<datePrefix><ext>" without their index,
+	// and colliding names are not disambiguated.
+	NamingBuildFilename
+)
+
+var namingNames = []string{
+	NamingCurrent:       "current",
+	NamingV1:            "v1",
+	NamingBuildFilename: "buildfilename",
+}
+
+func (n Naming) String() string {
+	if n >= 0 && int(n) < len(namingNames) {
+		return namingNames[n]
+	}
+	return fmt.Sprintf("Naming(%d)", int(n))
+}
+
+// ParseNaming returns the Naming called s, as Naming.String names it.
+func ParseNaming(s string) (Naming, error) {
+	for n, name := range namingNames {
+		if strings.EqualFold(s, name) {
+			return Naming(n), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown naming %q (want %s)", s, strings.Join(namingNames, ", "))
+}
+
+// legacyFilename returns the name of an attachment under an earlier naming.
+func legacyFilename(w workItem) string {
+	part := w.part
+	switch w.naming {
+	case NamingBuildFilename:
+		return BuildFilename(types.MMSPart{
+			ContentType: part.ContentType,
+			Filename:    part.Filename,
+			Name:        part.Name,
+		}, w.datePrefix)
+	case NamingV1:
+		// A chset of ISO-8859-1 leaves the name as stored.
+		part.Charset = "4"
+	}
+	return buildFilenameInternal(part, w.datePrefix, w.partIndex, w.disambigHash)
+}
+
+// Filename returns the path, relative to the output directory, at which
+// ProcessFile saves part partIndex of mms under o. It is the name ProcessFile
+// uses, slide number, Template and Naming included.
+//
+// Within one backup file, ProcessFile leaves the name of the first
+// attachment to get it alone, and disambiguates each later attachment whose
+// name matches it, ignoring case, with the ContentHash of its data. Pass ""
+// as disambigHash for the first, and that hash for the others. Filename does
+// not count the files SaveText and bot messages add.
+func (o Options) Filename(mms *types.MMS, partIndex int, disambigHash string) (string, error) {
+	item, err := o.publicItem(mms, partIndex)
+	if err != nil {
+		return "", err
+	}
+	item.disambigHash = disambigHash
+	return item.filename(), nil
+}
+
+// SaveAttachment decodes part partIndex of mms and writes it under outPath,
+// as Filename names it, unless the file already exists. Options.OnSaved and
+// Options.OnProgress are called as ProcessFile calls them.
+func (o Options) SaveAttachment(mms *types.MMS, partIndex int, disambigHash, outPath string) error {
+	item, err := o.publicItem(mms, partIndex)
+	if err != nil {
+		return err
+	}
+	item.disambigHash = disambigHash
+	item.outPath = outPath
+	return saveAttachment(item, o)
+}
+
+// ContentHash returns the disambiguation hash of an attachment's decoded
+// data: the first 8 hex digits of its SHA-256.
+func ContentHash(data []byte) string {
+	return contentHash(data)
+}
+
+// publicItem returns the work item for part partIndex of mms, as planFile
+// would build it.
+func (o Options) publicItem(mms *types.MMS, partIndex int) (workItem, error) {
+	if partIndex < 0 || partIndex >= len(mms.Parts) {
+		return workItem{}, fmt.Errorf("part index %d out of range", partIndex)
+	}
+	rec := recordFromMMS(mms)
+	datePrefix, sentTime, err := o.datePrefix(rec.Date)
+	if err != nil {
+		return workItem{}, err
+	}
+	var slides []int
+	if o.wantSlides() {
+		// As in ProcessFile, a message whose presentation does not parse
+		// keeps plain names.
+		slides, _ = partSlides(rec)
+	}
+	return o.attachmentItem(rec, partIndex, datePrefix, sentTime, slides)
+}
+
+// recordFromMMS returns the internal form of mms.
+func recordFromMMS(mms *types.MMS) *mmsRecord {
+	rec := &mmsRecord{
+		Date:        mms.Date,
+		Address:     string(mms.Address),
+		ContactName: mms.ContactName,
+		MessageBox:  mms.MessageBox,
+		Body:        mms.Body,
+		Parts:       make([]mmsPart, len(mms.Parts)),
+		Addrs:       make([]mmsAddr, len(mms.Addresses)),
+	}
+	for i, p := range mms.Parts {
+		rec.Parts[i] = mmsPart{
+			Data:        p.Data,
+			ContentType: p.ContentType,
+			Filename:    p.Filename,
+			Name:        p.Name,
+			Text:        p.Text,
+			Charset:     p.Charset,
+			ContentID:   p.ContentID,
+		}
+	}
+	for i, a := range mms.Addresses {
+		rec.Addrs[i] = mmsAddr{Address: string(a.Address), Type: a.Type}
+	}
+	return rec
+}
@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/junkblocker/sbr/types"
+)
+
+func TestParseNaming(t *testing.T) {
+	for _, n := range []Naming{NamingCurrent, NamingV1, NamingBuildFilename} {
+		got, err := ParseNaming(strings.ToUpper(n.String()))
+		if err != nil || got != n {
+			t.Errorf("ParseNaming(%q) = %v, %v", n, got, err)
+		}
+	}
+	if _, err := ParseNaming("v0"); err == nil {
+		t.Error("ParseNaming(v0) succeeded")
+	}
+}
+
+func TestLegacyFilename(t *testing.T) {
+	// "日本.jpg" in Shift_JIS, stored one byte per character.
+	sjis := string([]rune{0x93, 0xfa, 0x96, 0x7b}) + ".jpg"
+	named := mmsPart{ContentType: "image/jpeg", Filename: sjis, Charset: "17"}
+	unnamed := mmsPart{ContentType: "image/png"}
+	tests := []struct {
+		naming Naming
+		part   mmsPart
+		want   string
+	}{
+		{NamingCurrent, named, "P-日本.jpg"},
+		{NamingV1, named, "P-" + sjis},
+		{NamingCurrent, unnamed, "P-2.png"},
+		{NamingV1, unnamed, "P-2.png"},
+		{NamingBuildFilename, unnamed, "P.png"},
+		{NamingBuildFilename, mmsPart{Filename: "a/b:c.jpg"}, "P-a/b:c.jpg"},
+	}
+	for _, tt := range tests {
+		w := workItem{part: tt.part, datePrefix: "P", partIndex: 2, naming: tt.naming}
+		if got := w.filename(); got != tt.want {
+			t.Errorf("%v: filename = %q, want %q", tt.naming, got, tt.want)
+		}
+	}
+	// BuildFilename never disambiguated collisions.
+	w := workItem{part: unnamed, datePrefix: "P", disambigHash: "aabbccdd", naming: NamingBuildFilename}
+	if got := w.filename(); got != "P.png" {
+		t.Errorf("disambiguated BuildFilename name %q", got)
+	}
+}
+
+func TestOptionsFilename(t *testing.T) {
+	doc := `<smses>
+  <mms date="1705318245000" address="+1" contact_name="Ann"><parts>
+    <part seq="0" ct="image/jpeg" cl="a.jpg" data="` + mustEncode("A") + `"/>
+    <part seq="1" ct="image/png" data="` + mustEncode("P") + `"/>
+  </parts></mms>
+  <mms date="1705318245000" address="+1" contact_name="Ann"><parts>
+    <part seq="0" ct="image/jpeg" cl="A.JPG" data="` + mustEncode("B") + `"/>
+  </parts></mms>
+</smses>`
+	var msgs struct {
+		MMS []types.MMS `xml:"mms"`
+	}
+	if err := xml.Unmarshal([]byte(doc), &msgs); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ParseTemplate("{contact}/{leaf}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []Options{{}, {Location: time.UTC, SubSecondDigits: 3}, {Template: tmpl}} {
+		var planned []string
+		err := PlanFile(strings.NewReader(doc), "sms-1.xml", opts, func(p Planned) {
+			planned = append(planned, p.Name)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Name the parts as ProcessFile does, disambiguating repeats.
+		var named []string
+		seen := make(map[string]bool)
+		for _, m := range msgs.MMS {
+			for i, p := range m.Parts {
+				name, err := opts.Filename(&m, i, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if key := strings.ToLower(name); seen[key] {
+					data, _ := base64.StdEncoding.DecodeString(p.Data)
+					name, _ = opts.Filename(&m, i, ContentHash(data))
+				} else {
+					seen[key] = true
+				}
+				named = append(named, name)
+			}
+		}
+		if strings.Join(named, " ") != strings.Join(planned, " ") {
+			t.Errorf("Filename gives %q, ProcessFile %q", named, planned)
+		}
+	}
+
+	if _, err := (Options{}).Filename(&msgs.MMS[0], 2, ""); err == nil {
+		t.Error("Filename accepted a part index out of range")
+	}
+}
+
+func TestOptionsSaveAttachment(t *testing.T) {
+	dir := t.TempDir()
+	mms := &types.MMS{Date: "1705318245000", Parts: []types.MMSPart{
+		{ContentType: "image/jpeg", Data: mustEncode("A")},
+		{ContentType: "image/jpeg", Data: mustEncode("B")},
+	}}
+	opts := Options{Location: time.UTC}
+	for i := range mms.Parts {
+		if err := opts.SaveAttachment(mms, i, "", dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readDir(t, dir); strings.Join(got, " ") != "2024-01-15-113045-0.jpg 2024-01-15-113045-1.jpg" {
+		t.Errorf("wrote %q", got)
+	}
+}
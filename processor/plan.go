@@ -0,0 +1,31 @@
+package processor
+
+import (
+	"io"
+)
+
+// Planned is an attachment file that ProcessFile would write.
+type Planned struct {
+	// Offset is the position of the attachment's <mms> start tag in the
+	// backup, as in backup.Record.Offset, and PartIndex the 0-based position
+	// of the part within the message.
+	Offset    int64
+	PartIndex int
+	// Name is the file's path relative to the output directory.
+	Name string
+}
+
+// PlanFile parses a backup file exactly as ProcessFile would and calls fn for
+// every attachment it would write, without writing anything. Generated files
+// (the SaveText option's text, bot message renderings) are not reported.
+//
+// It returns the error that stopped parsing, if any; fn has then been called
+// only for the attachments before it.
+func PlanFile(r io.Reader, filePath string, opts Options, fn func(Planned)) error {
+	return planFile(r, filePath, "", withFile(opts, filePath), func(item workItem) {
+		if item.content != nil {
+			return
+		}
+		fn(Planned{Offset: item.offset, PartIndex: item.partIndex, Name: item.filename()})
+	})
+}
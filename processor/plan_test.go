@@ -0,0 +1,69 @@
+package processor
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanFile(t *testing.T) {
+	doc := `<smses>
+  <mms date="1705318245000" address="5551112222">
+    <parts>
+      <part seq="0" ct="text/plain" text="hi" data="null"/>
+      <part seq="1" ct="image/jpeg" cl="a.jpg" text="null" data="` + mustEncode("A") + `"/>
+    </parts>
+  </mms>
+  <mms date="1705318245000" address="5551112222">
+    <parts><part seq="0" ct="image/jpeg" cl="a.jpg" text="null" data="` + mustEncode("B") + `"/></parts>
+  </mms>
+</smses>`
+
+	dir := t.TempDir()
+	var planned []Planned
+	err := PlanFile(strings.NewReader(doc), "test.xml", Options{SaveText: true}, func(p Planned) {
+		planned = append(planned, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(planned) != 2 {
+		t.Fatalf("got %d planned files, want 2: %+v", len(planned), planned)
+	}
+	if p := planned[0]; !strings.HasPrefix(doc[p.Offset:], "<mms ") || p.PartIndex != 1 || p.Name != ts1Prefix+"-a.jpg" {
+		t.Errorf("first = %+v", p)
+	}
+	if p := planned[1]; p.Offset <= planned[0].Offset || p.PartIndex != 0 || p.Name == planned[0].Name {
+		t.Errorf("second = %+v", p)
+	}
+
+	// The plan names the files ProcessFile writes.
+	ProcessFile(strings.NewReader(doc), "test.xml", dir, Options{})
+	for _, p := range planned {
+		if _, err := os.Stat(filepath.Join(dir, p.Name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestPlanFile_Error(t *testing.T) {
+	doc := `<smses>
+  <mms date="1705318245000" address="5551112222">
+    <parts><part seq="0" ct="image/jpeg" cl="a.jpg" text="null" data="` + mustEncode("A") + `"/></parts>
+  </mms>
+  <mms date="1705318245000" unclosed`
+	var planned []Planned
+	opts := Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	err := PlanFile(strings.NewReader(doc), "test.xml", opts, func(p Planned) {
+		planned = append(planned, p)
+	})
+	if err == nil {
+		t.Error("no error for a truncated file")
+	}
+	if len(planned) != 1 {
+		t.Errorf("got %d planned files before the error, want 1", len(planned))
+	}
+}
@@ -2,21 +2,26 @@
 package processor
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/xml"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/contact"
+	"github.com/junkblocker/sbr/rcs"
 	"github.com/junkblocker/sbr/types"
 )
 
@@ -40,6 +45,57 @@ type workItem struct {
 	// always produce the same hash regardless of which file they come from or
 	// what position in the file the MMS element occupies.
 	disambigHash string
+	// content, when non-nil, marks this item as a file generated by sbr rather
+	// than a decoded attachment - the MMS text written by the SaveText option,
+	// or a bot message and its renderings. It is written verbatim to name.
+	content []byte
+	name    string
+	// mms is the message the part or text belongs to, for Options.OnSaved
+	// and MetaSink, and offset the position of its start tag in the backup, for PlanFile.
+	mms    *mmsRecord
+	offset int64
+	// source is the backup file the item comes from, for
+	// Options.OnProgress.
+	source string
+	// template, if non-nil, names the attachment instead of the default
+	// convention (see Options.Template), with subSecond digits in {time}.
+	// hash is the attachment's contentHash when the template uses it.
+	template  *Template
+	subSecond int
+	hash      string
+	// norm is Options.Normaliser, for the template's conversation fields,
+	// and slide the number of the SMIL slide the part is on, or 0.
+	norm  *contact.Normaliser
+	slide int
+	// naming is Options.Naming.
+	naming Naming
+}
+
+// filename returns the output filename for the item.
+func (w workItem) filename() string {
+	if w.content != nil {
+		return w.name
+	}
+	if w.naming != NamingCurrent {
+		return legacyFilename(w)
+	}
+	if w.template != nil {
+		return w.template.render(w, w.disambigHash)
+	}
+	return buildFilenameInternal(w.part, w.datePrefix, w.partIndex, w.disambigHash)
+}
+
+// payload returns the bytes to write for the item, decoding the attachment's
+// base64 data if necessary.
+func (w workItem) payload() ([]byte, error) {
+	if w.content != nil {
+		return w.content, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(w.part.Data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding attachment data: %w", err)
+	}
+	return data, nil
 }
 
 // ---------------------------------------------------------------------------
@@ -54,14 +110,43 @@ type mmsPart struct {
 	ContentType string `xml:"ct,attr"`
 	Filename    string `xml:"cl,attr"` // "Content-Location" maps to filename
 	Name        string `xml:"name,attr"`
+	Text        string `xml:"text,attr"`
+	Charset     string `xml:"chset,attr"`
+	ContentID   string `xml:"cid,attr"`
 }
 
 // mmsRecord is the minimal representation of an <mms> element.
-// Skipping ReadableDate, ContactName, Addresses, Body, FromAddress, etc.
-// reduces per-MMS allocation significantly on large backups.
+// Skipping ReadableDate, FromAddress, etc. reduces per-MMS
+// allocation significantly on large backups.
 type mmsRecord struct {
-	Date  string    `xml:"date,attr"`
-	Parts []mmsPart `xml:"parts>part"`
+	Date        string           `xml:"date,attr"`
+	Address     string           `xml:"address,attr"`
+	ContactName string           `xml:"contact_name,attr"`
+	MessageBox  types.MessageBox `xml:"msg_box,attr"`
+	Parts       []mmsPart        `xml:"parts>part"`
+	Addrs       []mmsAddr        `xml:"addrs>addr"`
+	Body        string           `xml:"body"`
+}
+
+// mmsAddr is the minimal representation of an <addr> element.
+type mmsAddr struct {
+	Address string `xml:"address,attr"`
+	Type    int    `xml:"type,attr"`
+}
+
+// sender returns the address an MMS came from and whether the owner sent it.
+// The sender is the "from" <addr>, falling back to the address attribute.
+func (m *mmsRecord) sender() (address string, sent bool) {
+	switch m.MessageBox {
+	case types.MessageBoxSent, types.MessageBoxDrafts, types.MessageBoxOutbox:
+		sent = true
+	}
+	for _, a := range m.Addrs {
+		if a.Type == types.MMSAddrFrom && types.PhoneNumber(a.Address).Usable() {
+			return a.Address, sent
+		}
+	}
+	return m.Address, sent
 }
 
 // windowsReservedNames is the set of base names (without extension) that are
@@ -123,6 +208,13 @@ func sanitiseLeafName(s string) string {
 	return out
 }
 
+// SanitiseFilename applies the same cross-platform filename rules used for
+// attachment leaf names (see sanitiseLeafName) to an arbitrary string, for use
+// by other packages that write files alongside extracted attachments.
+func SanitiseFilename(s string) string {
+	return sanitiseLeafName(s)
+}
+
 // buildFilenameInternal derives the output filename for one MMS part.
 //
 // Priority for the leaf name:
@@ -130,7 +222,8 @@ func sanitiseLeafName(s string) string {
 //  2. name attribute, if non-empty and not "null"
 //  3. Synthesised from partIndex + content-type extension
 //
-// The leaf name is passed through sanitiseLeafName before use so that URL
+// A leaf name written in a legacy charset is decoded using the part's chset
+// (see decodeName), then passed through sanitiseLeafName so that URL
 // values in the cl attribute (which contain slashes) never create accidental
 // subdirectory paths in the output filename.
 //
@@ -140,14 +233,8 @@ func sanitiseLeafName(s string) string {
 // stable across full and incremental backup files: the same image always hashes
 // to the same prefix, so the disambiguated name is idempotent across runs.
 func buildFilenameInternal(part mmsPart, datePrefix string, partIndex int, disambigHash string) string {
-	var leafName string
-	if part.Filename != "" && part.Filename != "null" {
-		leafName = sanitiseLeafName(part.Filename)
-	} else if part.Name != "" && part.Name != "null" {
-		leafName = sanitiseLeafName(part.Name)
-	}
-
-	if leafName == "" || leafName == "null" {
+	leafName := partLeafName(part)
+	if leafName == "" {
 		// No usable name - always include partIndex for uniqueness within the message.
 		if disambigHash != "" {
 			return fmt.Sprintf("%s-%s-%d%s", datePrefix, disambigHash, partIndex, ExtForContentType(strings.ToLower(part.ContentType)))
@@ -161,6 +248,20 @@ func buildFilenameInternal(part mmsPart, datePrefix string, partIndex int, disam
 	return datePrefix + "-" + leafName
 }
 
+// partLeafName returns the sanitised, decoded cl or name of a part, or "" if
+// it has neither.
+func partLeafName(part mmsPart) string {
+	name := partName(part.Filename, part.Name, part.Charset)
+	if name == "" {
+		return ""
+	}
+	leafName := sanitiseLeafName(name)
+	if leafName == "null" {
+		return ""
+	}
+	return leafName
+}
+
 // contentHash returns the first 8 hex characters of the SHA-256 of raw
 // (already base64-decoded) attachment bytes. Used as a stable disambiguator
 // when two MMS messages would otherwise produce the same output filename.
@@ -171,7 +272,110 @@ func contentHash(data []byte) string {
 
 // Options controls processor behaviour.
 type Options struct {
+	// DebugLevel selects how much a nil Logger logs (see DebugLogLevel).
 	DebugLevel uint
+	// Logger receives the processor's diagnostics, with the backup file, MMS
+	// date, part index, output path and error as attributes. If nil, they
+	// are logged as text to standard output.
+	Logger *slog.Logger
+	// SaveText writes the text of each MMS (its text/plain parts followed by
+	// its body) to "<datePrefix>.txt" next to the attachments, so captions
+	// stay with their photos.
+	SaveText bool
+	// SlideNumbers inserts the SMIL slide number of each attachment after the
+	// date prefix ("<datePrefix>-slide02-<leaf>"), so attachments sort in the
+	// order they were presented in the message. A Template places the slide
+	// number with its {slide} field instead, and ignores SlideNumbers.
+	SlideNumbers bool
+	// OnSaved, if non-nil, is called for every attachment once it is on disk,
+	// whether it was written by this run or already existed. It is called
+	// from worker goroutines and must be safe for concurrent use.
+	OnSaved func(Saved)
+	// OnProgress, if non-nil, receives progress events (see Progress) as
+	// files are parsed and attachments written. Like OnSaved, it is called
+	// from several goroutines at once.
+	OnProgress func(Progress)
+	// Ledger, if non-nil, makes ProcessFileFromPath skip input files it
+	// records as already processed, and record those it processes
+	// completely. ProcessDirectory uses the output directory's ledger when
+	// Ledger is nil.
+	Ledger *Ledger
+	// Force processes input files even when the ledger shows them unchanged.
+	Force bool
+	// Location is the time zone of the date prefix of output names. Nil
+	// means the host's local zone, which names the same message differently
+	// on hosts in different zones; set it (to time.UTC, say) for names that
+	// do not depend on the host.
+	Location *time.Location
+	// SubSecondDigits adds that many digits of the fraction of a second to
+	// the date prefix ("2006-01-02-150405.000"), so messages sent within the
+	// same second sort in order. Backups record milliseconds, so at most 3
+	// digits are used.
+	SubSecondDigits int
+	// Template, if non-nil, names attachments instead of the default
+	// "<datePrefix>-<leaf>" convention; a name it gives twice in one file
+	// gets the attachment's content hash before its extension. The files
+	// SaveText and bot messages generate keep their default names.
+	Template *Template
+	// Normaliser normalises the addresses a Template's {contact}, {address}
+	// and {thread} fields are made from. Nil is the zero Normaliser, which
+	// has no default country.
+	Normaliser *contact.Normaliser
+	// Naming selects an earlier release's rules for naming attachments, for
+	// migrating trees extracted with them (see MigrateFile). It overrides
+	// Template.
+	Naming Naming
+	// Sink, if non-nil, stores the files written instead of the output
+	// directory, which then only prefixes the paths reported to OnSaved and
+	// OnProgress. ProcessDirectory keeps no ledger for a Sink.
+	Sink Sink
+	// Lenient recovers from damaged input instead of stopping at the first
+	// error: characters XML does not allow are replaced with spaces, and
+	// after an error decoding resumes at the next <sms> or <mms>. What was
+	// skipped is logged.
+	Lenient bool
+}
+
+// namingVersion is raised whenever a release names the attachments of the
+// same input differently, so that the ledger does not skip files extracted
+// under the old names. 2: cl and name are decoded using chset.
+const namingVersion = 2
+
+// outputSignature summarises the options that change which files are written
+// or what they are called, for the ledger. Lenient is included because it
+// recovers messages a strict run loses.
+func (o Options) outputSignature() string {
+	loc := "Local"
+	if o.Location != nil {
+		loc = o.Location.String()
+	}
+	var tmpl, country string
+	if o.Template != nil {
+		tmpl = o.Template.String()
+		if o.Normaliser != nil {
+			country = o.Normaliser.Country()
+		}
+	}
+	return fmt.Sprintf("naming=%d/%s tz=%s subsecond=%d template=%q country=%s text=%t slides=%t lenient=%t",
+		namingVersion, o.Naming, loc, o.SubSecondDigits, tmpl, country, o.SaveText, o.SlideNumbers, o.Lenient)
+}
+
+// Saved describes one attachment on disk, as reported to Options.OnSaved.
+type Saved struct {
+	// Path is the attachment's path, under the output directory.
+	Path string
+	// ContentType is the part's lowercased MIME type.
+	ContentType string
+	// Time is the MMS timestamp.
+	Time time.Time
+	// Sender is the raw address the MMS came from. Sent is true when the
+	// backup owner sent it.
+	Sender string
+	Sent   bool
+	// Address and ContactName are the MMS's address and contact_name
+	// attributes, for resolving Sender to a contact (see contact.Resolver).
+	Address     string
+	ContactName string
 }
 
 // ExtForContentType returns the file extension for a given MIME content type.
@@ -202,6 +406,8 @@ func ExtForContentType(contentType string) string {
 		return ".pdf"
 	case "text/x-vcard", "text/v-card", "text/vcard":
 		return ".vcf"
+	case rcs.ContentType:
+		return ".json"
 	default:
 		return ".bin"
 	}
@@ -211,6 +417,11 @@ func ExtForContentType(contentType string) string {
 // datePrefix is a formatted timestamp string (e.g. "2006-01-02-150405").
 // The content type used for extension lookup should be the original (un-lowercased) value
 // from the part; this function lowercases it internally.
+//
+// Deprecated: BuildFilename does not name files as ProcessFile does: it
+// neither sanitises nor decodes names, and names unnamed parts without their
+// index, so parts of one message overwrite each other. Use Options.Filename.
+// MigrateFile renames trees named by BuildFilename (see NamingBuildFilename).
 func BuildFilename(part types.MMSPart, datePrefix string) string {
 	filename := ""
 	if part.Filename != "" && part.Filename != "null" {
@@ -227,81 +438,116 @@ func BuildFilename(part types.MMSPart, datePrefix string) string {
 }
 
 // DatePrefixFromMillis converts a Unix millisecond timestamp string into a
-// filename-safe date prefix of the form "2006-01-02-150405".
+// filename-safe date prefix of the form "2006-01-02-150405", in the host's
+// local time zone. It is the prefix of output names under the default
+// Options; see Options.Location and Options.SubSecondDigits.
 func DatePrefixFromMillis(dateMillis string) (string, time.Time, error) {
+	return Options{}.datePrefix(dateMillis)
+}
+
+// datePrefix converts a Unix millisecond timestamp string into the date
+// prefix of output names under o, and the time it denotes.
+func (o Options) datePrefix(dateMillis string) (string, time.Time, error) {
 	timestamp, err := strconv.ParseInt(dateMillis, 10, 64)
 	if err != nil {
 		return "", time.Time{}, fmt.Errorf("parsing date %q: %w", dateMillis, err)
 	}
+	layout := "2006-01-02-150405"
 	sentTime := time.Unix(timestamp/1000, 0)
-	return sentTime.Format("2006-01-02-150405"), sentTime, nil
+	if digits := o.SubSecondDigits; digits > 0 {
+		if digits > 3 {
+			digits = 3
+		}
+		layout += "." + strings.Repeat("0", digits)
+		sentTime = time.UnixMilli(timestamp)
+	}
+	loc := o.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	sentTime = sentTime.In(loc)
+	return sentTime.Format(layout), sentTime, nil
 }
 
-// saveAttachment is the core write routine that operates on the lean mmsPart
-// type and pre-computed time values (so the date string is not re-parsed per
-// part). It is called by both the internal goroutines and the public API.
-// partIndex is the 0-based index of the part within its parent MMS message and
-// is used to disambiguate unnamed parts that share a content type.
-func saveAttachment(part mmsPart, datePrefix string, sentTime time.Time, outPath string, partIndex int, disambigHash string, opts Options) error {
-	filename := buildFilenameInternal(part, datePrefix, partIndex, disambigHash)
-	oFile := filepath.Join(outPath, filename)
-
-	// Stat first - on incremental runs almost every file already exists and we
-	// want to skip the base64 decode and all subsequent work.
-	oStat, err := os.Stat(oFile)
+// saveAttachment is the core write routine. It operates on a fully planned
+// workItem (lean mmsPart, pre-computed time values and disambiguator) so the
+// date string is not re-parsed per part. It is called by both the internal
+// worker pool and the public API.
+func saveAttachment(item workItem, opts Options) error {
+	oFile := filepath.Join(item.outPath, item.filename())
+	written, err := writeItem(item, oFile, opts)
 	if err == nil {
-		if oStat.IsDir() {
-			return fmt.Errorf("output path %s is an existing directory", oFile)
+		kind := ProgressExisted
+		if written {
+			kind = ProgressWritten
 		}
-		if opts.DebugLevel > 1 {
-			fmt.Printf("DEBUG: Output path %s already exists\n", oFile)
+		opts.progress(Progress{Kind: kind, File: item.source, Offset: item.offset, Path: oFile})
+	}
+	if err == nil && opts.OnSaved != nil && item.content == nil {
+		saved := Saved{
+			Path:        oFile,
+			ContentType: strings.ToLower(item.part.ContentType),
+			Time:        item.sentTime,
 		}
-		return nil
+		if item.mms != nil {
+			saved.Sender, saved.Sent = item.mms.sender()
+			saved.Address, saved.ContactName = item.mms.Address, item.mms.ContactName
+		}
+		opts.OnSaved(saved)
 	}
+	return err
+}
 
-	data, err := base64.StdEncoding.DecodeString(part.Data)
-	if err != nil {
-		return fmt.Errorf("decoding attachment data: %w", err)
-	}
+// writeItem stores item in the output sink (see Options.Sink) unless it is
+// already there, and reports whether it stored it.
+func writeItem(item workItem, oFile string, opts Options) (bool, error) {
+	sink := opts.sink(item.outPath)
+	name := item.filename()
 
-	// Create a uniquely-named temp file in the same directory as the target so
-	// that os.Rename is always an atomic same-filesystem move. Using a unique
-	// name (rather than oFile+".tmp") means two concurrent goroutines writing
-	// to the same final path - e.g. two MMS messages that share a timestamp
-	// and filename - never stomp each other's temp file. The rename is
-	// last-writer-wins, which is safe because both goroutines hold identical
-	// content (truly duplicate attachments decode to the same bytes).
-	tmp, err := os.CreateTemp(outPath, ".sbr-*.tmp")
+	// Check first - on incremental runs almost every file already exists and
+	// we want to skip the base64 decode and all subsequent work.
+	exists, err := sink.Exists(name)
 	if err != nil {
-		return fmt.Errorf("creating temp file in %s: %w", outPath, err)
+		return false, err
+	}
+	if exists {
+		opts.logger().Log(context.Background(), LevelVerbose, "output path already exists", "path", oFile)
+		return false, nil
 	}
-	oTempfile := tmp.Name()
 
-	if _, err = tmp.Write(data); err != nil {
-		tmp.Close()
-		_ = os.Remove(oTempfile)
-		return fmt.Errorf("writing attachment to %s: %w", oTempfile, err)
+	data, err := item.payload()
+	if err != nil {
+		return false, err
 	}
-	if err = tmp.Close(); err != nil {
-		_ = os.Remove(oTempfile)
-		return fmt.Errorf("closing temp file %s: %w", oTempfile, err)
+	if ms, ok := sink.(MetaSink); ok {
+		meta := FileMeta{Time: item.sentTime}
+		if item.content == nil {
+			meta.ContentType = strings.ToLower(item.part.ContentType)
+		}
+		if item.mms != nil {
+			meta.Sender, meta.Sent = item.mms.sender()
+		}
+		err = ms.PutMeta(name, data, meta)
+	} else {
+		err = sink.Put(name, data, item.sentTime)
 	}
-
-	if err = os.Chtimes(oTempfile, sentTime, sentTime); err != nil {
-		_ = os.Remove(oTempfile)
-		return fmt.Errorf("setting file time on %s: %w", oTempfile, err)
+	if err != nil {
+		return false, err
 	}
+	return true, nil
+}
 
-	if err = os.Rename(oTempfile, oFile); err != nil {
-		_ = os.Remove(oTempfile)
-		return fmt.Errorf("renaming %s to %s: %w", oTempfile, oFile, err)
+// sink returns the sink of files for the output directory outPath.
+func (o Options) sink(outPath string) Sink {
+	if o.Sink != nil {
+		return o.Sink
 	}
-	return nil
+	return DirSink{Dir: outPath}
 }
 
 // naturalFilenameKey returns the collision-detection key for a part: the
-// case-folded form of the filename that buildFilenameInternal would produce
-// with no disambigHash.
+// case-folded form of the filename the item would have with no
+// disambigHash, under the default convention or Options.Template.
 //
 // Case-folding is required because the output directory may live on a
 // case-insensitive filesystem (NTFS, FAT32, exFAT - used on Windows and
@@ -310,29 +556,69 @@ func saveAttachment(part mmsPart, datePrefix string, sentTime time.Time, outPath
 // Using a case-folded key ensures the disambigHash is injected whenever two
 // parts would produce names that are case-insensitively identical, regardless
 // of the host OS running the tool.
-func naturalFilenameKey(part mmsPart, datePrefix string, partIndex int) string {
-	return strings.ToLower(buildFilenameInternal(part, datePrefix, partIndex, ""))
-}
-
-// SaveMMSAttachment is the public API that decodes and writes a single MMS
-// part. It accepts the exported types.MMSPart and a raw millisecond date
-// string, converting them into the internal representation before delegating.
-// partIndex is the 0-based index of this part within its parent MMS message;
-// pass the actual index when saving multiple parts from the same message so
-// that unnamed parts of the same content type receive distinct filenames.
-// mmsIndex and disambig follow the same semantics as buildFilenameInternal;
-// pass disambig=false when the caller has verified no cross-message collision.
-func SaveMMSAttachment(part types.MMSPart, date, outPath string, partIndex int, opts Options) error {
-	datePrefix, sentTime, err := DatePrefixFromMillis(date)
+func naturalFilenameKey(item workItem) string {
+	item.disambigHash = ""
+	return strings.ToLower(item.filename())
+}
+
+// partHash returns the contentHash of a part's decoded data.
+func partHash(part mmsPart) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(part.Data)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("decoding attachment data: %w", err)
+	}
+	return contentHash(raw), nil
+}
+
+// wantSlides reports whether naming attachments needs their slide numbers.
+func (o Options) wantSlides() bool {
+	return o.SlideNumbers || o.Template != nil && o.Template.slide
+}
+
+// attachmentItem returns the work item saving part i of mms, a message dated
+// datePrefix and sentTime whose parts appear on slides (nil unless
+// wantSlides), named as o says. With a Template using {hash8}, the item
+// carries the part's content hash, and an error if the part's data does not
+// decode. The caller sets the output path and any disambiguation hash.
+func (o Options) attachmentItem(mms *mmsRecord, i int, datePrefix string, sentTime time.Time, slides []int) (workItem, error) {
+	item := workItem{
+		part:       mms.Parts[i],
+		datePrefix: datePrefix,
+		sentTime:   sentTime,
+		partIndex:  i,
+		mms:        mms,
+		template:   o.Template,
+		subSecond:  o.SubSecondDigits,
+		norm:       o.Normaliser,
+		naming:     o.Naming,
+	}
+	if slides != nil {
+		item.slide = slides[i]
+		if o.SlideNumbers {
+			item.datePrefix = slidePrefix(datePrefix, item.slide)
+		}
 	}
-	return saveAttachment(mmsPart{
-		Data:        part.Data,
-		ContentType: part.ContentType,
-		Filename:    part.Filename,
-		Name:        part.Name,
-	}, datePrefix, sentTime, outPath, partIndex, "", opts)
+	var err error
+	if o.Template != nil && o.Template.hash {
+		item.hash, err = partHash(item.part)
+	}
+	return item, err
+}
+
+// SaveMMSAttachment decodes and writes part partIndex of an MMS dated date
+// (a Unix millisecond timestamp string) to outPath, named as ProcessFile
+// names it with opts, but without disambiguation.
+//
+// Deprecated: SaveMMSAttachment sees one part, not its message, so it cannot
+// number slides or fill the message fields of a Template, and it never
+// disambiguates colliding names. Use Options.SaveAttachment.
+func SaveMMSAttachment(part types.MMSPart, date, outPath string, partIndex int, opts Options) error {
+	if partIndex < 0 {
+		return fmt.Errorf("part index %d out of range", partIndex)
+	}
+	parts := make([]types.MMSPart, partIndex+1)
+	parts[partIndex] = part
+	return opts.SaveAttachment(&types.MMS{Date: date, Parts: parts}, partIndex, "", outPath)
 }
 
 // ProcessFile parses a single SMS/MMS backup XML file and saves attachments
@@ -345,27 +631,77 @@ func SaveMMSAttachment(part types.MMSPart, date, outPath string, partIndex int,
 // This avoids the TOCTOU race where wg.Wait() in the caller could observe a zero
 // count between the outer goroutine's Done() and ProcessFile's own wg.Add(1).
 func ProcessFile(r io.Reader, filePath, outPath string, opts Options) {
-	if opts.DebugLevel > 0 {
-		fmt.Printf("Processing file: %s\n", filePath)
+	_ = processFile(r, filePath, outPath, opts)
+}
+
+// processFile is ProcessFile reporting whether the file was processed
+// completely: it returns an error if decoding stopped early or any
+// attachment could not be written. The errors themselves have already been
+// logged.
+func processFile(r io.Reader, filePath, outPath string, opts Options) error {
+	opts = withFile(opts, filePath)
+	log := opts.Logger
+	log.Debug("processing file")
+	var size int64
+	if f, ok := r.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if info, err := f.Stat(); err == nil {
+			size = info.Size()
+		}
 	}
+	opts.progress(Progress{Kind: ProgressFileStarted, File: filePath, Size: size})
+	defer opts.progress(Progress{Kind: ProgressFileDone, File: filePath, Offset: size, Size: size})
 
 	// Spin up the bounded worker pool.
 	nWorkers := 2 * runtime.GOMAXPROCS(0)
 	ch := make(chan workItem, nWorkers*4)
 
-	var poolWg sync.WaitGroup
+	var (
+		poolWg   sync.WaitGroup
+		failures atomic.Int64
+	)
 	poolWg.Add(nWorkers)
 	for range nWorkers {
 		go func() {
 			defer poolWg.Done()
 			for item := range ch {
-				if saveErr := saveAttachment(item.part, item.datePrefix, item.sentTime, item.outPath, item.partIndex, item.disambigHash, opts); saveErr != nil {
-					fmt.Println("Error saving attachment:", saveErr)
+				if saveErr := saveAttachment(item, opts); saveErr != nil {
+					log.Error("saving attachment", "date", item.sentTime, "part", item.partIndex,
+						"path", filepath.Join(item.outPath, item.filename()), "err", saveErr)
+					failures.Add(1)
 				}
 			}
 		}()
 	}
 
+	err := planFile(r, filePath, outPath, opts, func(item workItem) {
+		ch <- item
+	})
+
+	// Signal workers to drain, then wait for all writes to complete before
+	// returning so the caller's WaitGroup.Done() is not called prematurely.
+	close(ch)
+	poolWg.Wait()
+	if err != nil {
+		return fmt.Errorf("decoding %s: %w", filePath, err)
+	}
+	if n := failures.Load(); n > 0 {
+		return fmt.Errorf("%s: %d attachment(s) not saved", filePath, n)
+	}
+	return nil
+}
+
+// planFile decodes a backup file and calls emit once for every attachment that
+// ProcessFile would save, in document order, with the output filename fully
+// determined (including any collision disambiguator). It is the single source
+// of truth for "which part goes to which path", shared by ProcessFile and
+// VerifyFile so the two can never disagree. It returns the error that stopped
+// decoding before the end of the file, if any; errors confined to one message
+// are reported and skipped. Diagnostics go to opts' logger, which callers tag
+// with filePath (see withFile).
+func planFile(r io.Reader, filePath, outPath string, opts Options, emit func(workItem)) error {
+	log := opts.logger()
+	ctx := context.Background()
+
 	// seenKeys tracks every natural filename key assigned so far in this file.
 	// The XML parser is single-threaded so no locking is needed. When a key is
 	// seen for the second time (a different MMS element that would produce the
@@ -376,96 +712,171 @@ func ProcessFile(r io.Reader, filePath, outPath string, opts Options) {
 	// entire full+incremental backup set.
 	seenKeys := make(map[string]bool)
 
-	decoder := xml.NewDecoder(r)
+	planned := emit
+	emit = func(item workItem) {
+		item.source = filePath
+		planned(item)
+	}
 
-	parse:
+	decoder := xml.NewDecoder(backup.NewFilter(r))
+	// With opts.Lenient, rc replaces decoder after an error with one that
+	// resumes at the next record, whose first byte is at base in the file.
+	var (
+		rc   *recovery
+		base int64
+	)
+	if opts.Lenient {
+		rc, decoder = newRecovery(r)
+		defer rc.report(log)
+	}
+	var reported int64
+
+parse:
 	for {
+		offset := base + decoder.InputOffset()
+		if offset-reported >= progressStep {
+			opts.progress(Progress{Kind: ProgressRead, File: filePath, Offset: offset})
+			reported = offset
+		}
 		token, err := decoder.Token()
 		if err != nil {
-			if token != nil {
-				fmt.Printf("Error decoding file %s: %s\n", filePath, err)
+			if err == io.EOF {
+				break
 			}
-			break
-		} else if opts.DebugLevel > 2 {
-			fmt.Printf("Decoded a token\n")
+			if rc != nil {
+				if decoder, base = rc.resume(offset, false, err, log); decoder == nil {
+					break
+				}
+				continue
+			}
+			log.Error("decoding file", "offset", offset, "err", err)
+			return err
 		}
+		log.Log(ctx, LevelTrace, "decoded a token", "offset", offset)
 
 		switch se := token.(type) {
 		case xml.StartElement:
 			switch se.Name.Local {
 			case "calls":
-				fmt.Println("Not an SMS backup:", filePath)
+				log.Warn("not an SMS backup")
 				break parse
 			case "sms":
 				// SMS elements carry no attachments; skip without allocating.
 				if err = decoder.Skip(); err != nil {
-					fmt.Println("Error skipping SMS:", err)
+					if rc != nil {
+						if decoder, base = rc.resume(offset, true, err, log); decoder == nil {
+							break parse
+						}
+						continue
+					}
+					log.Error("skipping SMS", "offset", offset, "err", err)
 				}
 			case "mms":
 				var mms mmsRecord
 				if err = decoder.DecodeElement(&mms, &se); err != nil {
-					fmt.Println("Error decoding MMS:", err)
+					if rc != nil {
+						if decoder, base = rc.resume(offset, true, err, log); decoder == nil {
+							break parse
+						}
+						continue
+					}
+					log.Error("decoding MMS", "offset", offset, "err", err)
 					continue
 				}
+				opts.progress(Progress{Kind: ProgressMMS, File: filePath, Offset: base + decoder.InputOffset()})
 				// Hoist timestamp parsing outside the parts loop - all parts
 				// of one MMS share the same date.
-				datePrefix, sentTime, dateErr := DatePrefixFromMillis(mms.Date)
+				datePrefix, sentTime, dateErr := opts.datePrefix(mms.Date)
 				if dateErr != nil {
-					fmt.Println("Error parsing MMS date:", dateErr)
+					log.Error("parsing MMS date", "offset", offset, "date", mms.Date, "err", dateErr)
 					continue
 				}
+				if opts.SaveText {
+					emitText(&mms, datePrefix, sentTime, outPath, seenKeys, log, emit)
+				}
+				var slides []int
+				if opts.wantSlides() {
+					var smilErr error
+					if slides, smilErr = partSlides(&mms); smilErr != nil {
+						log.Error("parsing MMS presentation", "date", sentTime, "err", smilErr)
+					}
+				}
 				for i, part := range mms.Parts {
 					contentType := strings.ToLower(part.ContentType)
 					if isSupportedAttachment(contentType) {
+						item, hashErr := opts.attachmentItem(&mms, i, datePrefix, sentTime, slides)
+						if hashErr != nil {
+							log.Error("decoding attachment for hash", "date", sentTime, "part", i, "err", hashErr)
+						}
+						item.outPath = outPath
+						item.offset = offset
+
 						// Compute the natural key to detect cross-MMS collisions.
-						naturalKey := naturalFilenameKey(part, datePrefix, i)
+						naturalKey := naturalFilenameKey(item)
 						collision := seenKeys[naturalKey]
 						seenKeys[naturalKey] = true
 
-						var disambigHash string
-						if collision {
+						// A template naming files by their content needs no
+						// more: different content never collides, and the same
+						// content rightly shares a file.
+						if collision && item.hash == "" {
 							// Eagerly decode to get the content hash. This is
 							// the rare path; the common case (no collision) pays
 							// no decode cost here.
-							raw, decErr := base64.StdEncoding.DecodeString(part.Data)
-							if decErr != nil {
-								fmt.Printf("Error decoding attachment for hash (%s): %v\n", naturalKey, decErr)
+							var decErr error
+							if item.disambigHash, decErr = partHash(part); decErr != nil {
+								log.Error("decoding attachment for hash", "date", sentTime, "part", i, "key", naturalKey, "err", decErr)
 								// Fall through with empty hash; saveAttachment
 								// will catch the decode error again and report it.
-							} else {
-								disambigHash = contentHash(raw)
 							}
 						}
 
-						ch <- workItem{
-							part:         part,
-							datePrefix:   datePrefix,
-							sentTime:     sentTime,
-							outPath:      outPath,
-							partIndex:    i,
-							disambigHash: disambigHash,
-						}
-					} else if contentType == "application/vnd.gsma.botmessage.v1.0+json" {
-						if opts.DebugLevel > 2 {
-							decoded, decErr := base64.StdEncoding.DecodeString(part.Data)
-							if decErr != nil {
-								fmt.Println("DEBUG: Error decoding attachment data:", decErr)
-							} else {
-								fmt.Printf("DEBUG: Data:\n%s\n", decoded)
-							}
+						emit(item)
+					} else if contentType == rcs.ContentType {
+						partPrefix := datePrefix
+						if slides != nil {
+							partPrefix = slidePrefix(datePrefix, slides[i])
 						}
-					} else if contentType != "text/plain" && contentType != "application/smil" {
-						fmt.Printf("  Unknown: %s\n", part.ContentType)
+						emitBotMessage(part, i, partPrefix, sentTime, outPath, seenKeys, log, emit)
+					} else if !KnownContentType(contentType) {
+						log.Warn("unknown content type", "date", sentTime, "part", i, "content_type", part.ContentType)
 					}
 				}
 			}
 		}
 	}
+	return nil
+}
 
-	// Signal workers to drain, then wait for all writes to complete before
-	// returning so the caller's WaitGroup.Done() is not called prematurely.
-	close(ch)
-	poolWg.Wait()
+// emitText plans the text file for one MMS when it has any text. The text file
+// shares the collision bookkeeping of attachments: a second message with the
+// same timestamp gets a content-hash disambiguator.
+func emitText(mms *mmsRecord, datePrefix string, sentTime time.Time, outPath string, seenKeys map[string]bool, log *slog.Logger, emit func(workItem)) {
+	text, err := messageText(mms)
+	if err != nil {
+		log.Error("reading MMS text", "date", sentTime, "err", err)
+		return
+	}
+	if text == nil {
+		return
+	}
+
+	naturalKey := strings.ToLower(textFilename(datePrefix, ""))
+	var disambigHash string
+	if seenKeys[naturalKey] {
+		disambigHash = contentHash(text)
+	}
+	seenKeys[naturalKey] = true
+
+	emit(workItem{
+		datePrefix:   datePrefix,
+		sentTime:     sentTime,
+		outPath:      outPath,
+		disambigHash: disambigHash,
+		content:      text,
+		name:         textFilename(datePrefix, disambigHash),
+		mms:          mms,
+	})
 }
 
 // isSupportedAttachment reports whether a (lowercased) content type should be
@@ -481,16 +892,85 @@ func isSupportedAttachment(ct string) bool {
 		ct == "application/octet-stream"
 }
 
+// KnownContentType reports whether a (lowercased) content type is one the
+// processor recognises: either a saved attachment type or one of the
+// structural MMS parts (text, SMIL layout, RCS bot message) that are handled
+// without being written out. Anything else is reported as "Unknown".
+func KnownContentType(ct string) bool {
+	return isSupportedAttachment(ct) ||
+		ct == "text/plain" ||
+		ct == "application/smil" ||
+		ct == rcs.ContentType
+}
+
 // ProcessFileFromPath opens filePath and calls ProcessFile. It blocks until all
-// attachments from the file have been written to disk.
-func ProcessFileFromPath(filePath, outPath string, opts Options) {
+// attachments from the file have been written to disk. With opts.Ledger set,
+// unchanged files are skipped (see Ledger).
+//
+// It returns an error if the file could not be opened, decoding stopped
+// early or any attachment could not be written; the error has already been
+// logged, so callers need only decide how to exit.
+func ProcessFileFromPath(filePath, outPath string, opts Options) error {
+	if opts.Ledger != nil {
+		return processWithLedger(opts.Ledger, filePath, outPath, opts)
+	}
 	file, err := os.Open(filePath)
 	if err != nil {
-		fmt.Printf("Error opening file %s: %s\n", filePath, err)
-		return
+		opts.logger().Error("opening file", "file", filePath, "err", err)
+		return fmt.Errorf("opening %s: %w", filePath, err)
 	}
 	defer file.Close()
-	ProcessFile(file, filePath, outPath, opts)
+	return processFile(file, filePath, outPath, opts)
+}
+
+// IsBackupFile reports whether a base filename follows the "sms-*.xml" naming
+// convention used by SMS Backup & Restore for message backups.
+func IsBackupFile(name string) bool {
+	return strings.HasPrefix(name, "sms-") && strings.HasSuffix(name, ".xml")
+}
+
+// IsCallsBackupFile reports whether a base filename follows the "calls-*.xml"
+// naming convention used by SMS Backup & Restore for call log backups.
+func IsCallsBackupFile(name string) bool {
+	return strings.HasPrefix(name, "calls-") && strings.HasSuffix(name, ".xml")
+}
+
+// FindBackupFiles returns the backup files designated by inPath: inPath itself
+// when it is a regular file, or every "sms-*.xml" file beneath it (in lexical
+// walk order) when it is a directory.
+func FindBackupFiles(inPath string) ([]string, error) {
+	return findFiles(inPath, IsBackupFile)
+}
+
+// FindCallsBackupFiles is FindBackupFiles for call log backups: it returns
+// inPath itself when it is a regular file, or every "calls-*.xml" file beneath
+// it.
+func FindCallsBackupFiles(inPath string) ([]string, error) {
+	return findFiles(inPath, IsCallsBackupFile)
+}
+
+func findFiles(inPath string, match func(name string) bool) ([]string, error) {
+	info, err := os.Stat(inPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{inPath}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(inPath, func(apath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && match(entry.Name()) {
+			files = append(files, apath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking directory %s: %w", inPath, err)
+	}
+	return files, nil
 }
 
 // ProcessDirectory walks inDirPath and processes every file matching the
@@ -499,29 +979,54 @@ func ProcessFileFromPath(filePath, outPath string, opts Options) {
 // its worker pool has drained, each goroutine here holds exactly one wg count
 // for the entire duration of its file processing, and wg.Wait() in main()
 // correctly waits for all writes to complete with no internal wg.Add races.
-func ProcessDirectory(wg *sync.WaitGroup, inDirPath, outDirPath string, opts Options) {
+//
+// Files recorded in the ledger (opts.Ledger, or the LedgerFile in outDirPath)
+// as already processed and unchanged since are skipped unless opts.Force is
+// set.
+//
+// The returned count is the number of files that were not processed
+// completely (see ProcessFileFromPath), plus one if the directory could not
+// be walked. It is final once wg is done.
+func ProcessDirectory(wg *sync.WaitGroup, inDirPath, outDirPath string, opts Options) *atomic.Int64 {
+	failures := new(atomic.Int64)
+	log := opts.logger()
+	opts.Logger = log
+	if opts.Ledger == nil && opts.Sink == nil {
+		ledger, err := OpenLedger(outDirPath)
+		if err != nil {
+			// Carry on without: every file is processed, as before there
+			// was a ledger.
+			log.Error("opening ledger", "err", err)
+		} else {
+			opts.Ledger = ledger
+		}
+	}
 	err := filepath.WalkDir(inDirPath, func(apath string, entry os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 		fname := entry.Name()
 		if !entry.IsDir() {
-			if strings.HasPrefix(fname, "sms-") && strings.HasSuffix(fname, ".xml") {
+			if IsBackupFile(fname) {
 				// wg.Add before launching so wg.Wait() in the caller cannot
 				// return before this goroutine has started and ProcessFile has
 				// completed all its writes.
 				wg.Add(1)
 				go func(path string) {
 					defer wg.Done()
-					ProcessFileFromPath(path, outDirPath, opts)
+					if ProcessFileFromPath(path, outDirPath, opts) != nil {
+						failures.Add(1)
+					}
 				}(apath)
-			} else if opts.DebugLevel > 1 {
-				fmt.Println("DEBUG: Skipping", entry)
+			} else {
+				log.Log(context.Background(), LevelVerbose, "skipping non-backup file", "file", apath)
 			}
 		}
 		return nil
 	})
 	if err != nil {
-		log.Printf("Failed to walk directory %s: %v\n", inDirPath, err)
+		log.Error("walking directory", "dir", inDirPath, "err", err)
+		failures.Add(1)
 	}
+	return failures
 }
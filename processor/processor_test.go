@@ -40,7 +40,8 @@ var (
 	ts2Prefix = pfx("1705318305000")
 )
 
-// readDir returns the sorted names of regular files in dir.
+// readDir returns the sorted names of the regular files in dir, except the
+// ledger.
 func readDir(t *testing.T, dir string) []string {
 	t.Helper()
 	entries, err := os.ReadDir(dir)
@@ -49,7 +50,8 @@ func readDir(t *testing.T, dir string) []string {
 	}
 	var names []string
 	for _, e := range entries {
-		if !e.IsDir() {
+		// The ledger is bookkeeping, not an extracted file.
+		if !e.IsDir() && e.Name() != LedgerFile {
 			names = append(names, e.Name())
 		}
 	}
@@ -333,13 +335,6 @@ func TestSanitiseLeafName(t *testing.T) {
 	}
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 // ---------------------------------------------------------------------------
 // buildFilenameInternal / contentHash - disambiguation
 // ---------------------------------------------------------------------------
@@ -1467,3 +1462,21 @@ func TestProcessDirectory(t *testing.T) {
 		}
 	})
 }
+
+func TestProcessFile_SurrogatePairs(t *testing.T) {
+	dir := t.TempDir()
+	xmlDoc := `<smses>
+  <mms date="1705318245000" address="+1">
+    <parts>
+      <part seq="0" ct="image/jpeg" cl="&#55357;&#56832;.jpg" data="` + mustEncode("a") + `"/>
+      <part seq="1" ct="image/png" cl="caf` + "\xe9" + `&#55357;.png" data="` + mustEncode("b") + `"/>
+    </parts>
+  </mms>
+</smses>`
+	ProcessFile(strings.NewReader(xmlDoc), "test.xml", dir, Options{})
+	// The invalid byte becomes '?', which sanitiseLeafName turns into '_'.
+	want := []string{ts1Prefix + "-caf_�.png", ts1Prefix + "-😀.jpg"}
+	if got := readDir(t, dir); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("saved %q, want %q", got, want)
+	}
+}
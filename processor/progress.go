@@ -0,0 +1,48 @@
+package processor
+
+// ProgressKind identifies what a Progress event reports.
+type ProgressKind int
+
+const (
+	// ProgressFileStarted: parsing of File has begun.
+	ProgressFileStarted ProgressKind = iota
+	// ProgressRead: the parser has read Offset bytes of File. It is sent
+	// about every progressStep bytes.
+	ProgressRead
+	// ProgressMMS: an MMS ending at Offset has been parsed.
+	ProgressMMS
+	// ProgressWritten: the attachment (or generated file) Path was written.
+	ProgressWritten
+	// ProgressExisted: Path was already on disk and was left alone.
+	ProgressExisted
+	// ProgressFileSkipped: File was not parsed because the ledger shows it
+	// unchanged since it was last processed.
+	ProgressFileSkipped
+	// ProgressFileDone: parsing of File has finished and every attachment
+	// from it has been handled.
+	ProgressFileDone
+)
+
+// progressStep is how many bytes the parser reads between ProgressRead events.
+const progressStep = 1 << 20
+
+// Progress is an event reported to Options.OnProgress.
+type Progress struct {
+	Kind ProgressKind
+	// File is the backup file the event concerns.
+	File string
+	// Offset is how far into File the parser has read.
+	Offset int64
+	// Size is the size of File when it is known, for ProgressFileStarted,
+	// ProgressFileSkipped and ProgressFileDone; otherwise it is 0.
+	Size int64
+	// Path is the output file, for ProgressWritten and ProgressExisted.
+	Path string
+}
+
+// progress reports p to o.OnProgress, if set.
+func (o Options) progress(p Progress) {
+	if o.OnProgress != nil {
+		o.OnProgress(p)
+	}
+}
@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestProcessFile_Progress(t *testing.T) {
+	in := filepath.Join(t.TempDir(), "sms-1.xml")
+	doc := `<smses>
+  <sms address="+1" date="1000" body="hi"/>
+  <mms date="1705318245000" address="+1">
+    <parts>
+      <part seq="0" ct="image/jpeg" cl="a.jpg" data="` + mustEncode("a") + `"/>
+      <part seq="1" ct="image/jpeg" cl="b.jpg" data="` + mustEncode("b") + `"/>
+    </parts>
+  </mms>
+</smses>`
+	if err := os.WriteFile(in, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+
+	run := func(opts Options) map[ProgressKind][]Progress {
+		var mu sync.Mutex
+		events := make(map[ProgressKind][]Progress)
+		opts.OnProgress = func(p Progress) {
+			mu.Lock()
+			events[p.Kind] = append(events[p.Kind], p)
+			mu.Unlock()
+		}
+		ProcessFileFromPath(in, out, opts)
+		return events
+	}
+
+	events := run(Options{})
+	if s := events[ProgressFileStarted]; len(s) != 1 || s[0].File != in || s[0].Size != int64(len(doc)) {
+		t.Errorf("started = %+v", s)
+	}
+	if m := events[ProgressMMS]; len(m) != 1 || m[0].Offset <= 0 || m[0].Offset > int64(len(doc)) {
+		t.Errorf("mms = %+v", m)
+	}
+	if w := events[ProgressWritten]; len(w) != 2 || w[0].File != in {
+		t.Errorf("written = %+v", w)
+	}
+	if d := events[ProgressFileDone]; len(d) != 1 || d[0].Offset != int64(len(doc)) {
+		t.Errorf("done = %+v", d)
+	}
+
+	events = run(Options{})
+	if len(events[ProgressWritten]) != 0 || len(events[ProgressExisted]) != 2 {
+		t.Errorf("second run: written %d, existed %d; want 0, 2", len(events[ProgressWritten]), len(events[ProgressExisted]))
+	}
+
+	ledger, err := OpenLedger(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(Options{Ledger: ledger})
+	events = run(Options{Ledger: ledger})
+	if s := events[ProgressFileSkipped]; len(s) != 1 || s[0].Size != int64(len(doc)) || len(events[ProgressFileStarted]) != 0 {
+		t.Errorf("unchanged file events = %+v", events)
+	}
+}
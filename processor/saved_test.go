@@ -0,0 +1,61 @@
+package processor
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProcessFile_OnSaved(t *testing.T) {
+	doc := `<smses>
+  <mms date="1705318245000" address="5551112222~5553334444" contact_name="Ann, Bob" msg_box="1">
+    <parts>
+      <part seq="0" ct="text/plain" text="hi" data="null"/>
+      <part seq="1" ct="IMAGE/JPEG" cl="a.jpg" text="null" data="` + mustEncode("A") + `"/>
+    </parts>
+    <addrs>
+      <addr address="5553334444" type="137"/>
+      <addr address="5551112222" type="151"/>
+    </addrs>
+  </mms>
+  <mms date="1705318246000" address="5551112222" msg_box="2">
+    <parts><part seq="0" ct="image/png" cl="b.png" text="null" data="` + mustEncode("B") + `"/></parts>
+  </mms>
+</smses>`
+
+	dir := t.TempDir()
+	var (
+		mu    sync.Mutex
+		saved []Saved
+	)
+	opts := Options{SaveText: true, OnSaved: func(s Saved) {
+		mu.Lock()
+		saved = append(saved, s)
+		mu.Unlock()
+	}}
+	run := func() {
+		saved = nil
+		ProcessFile(strings.NewReader(doc), "test.xml", dir, opts)
+		sort.Slice(saved, func(i, j int) bool { return saved[i].Path < saved[j].Path })
+	}
+
+	for _, pass := range []string{"first run", "files already exist"} {
+		run()
+		// The text file is generated, not an attachment, so it is not reported.
+		if len(saved) != 2 {
+			t.Fatalf("%s: got %d saved, want 2: %+v", pass, len(saved), saved)
+		}
+		a, b := saved[0], saved[1]
+		if a.Path != filepath.Join(dir, ts1Prefix+"-a.jpg") || a.ContentType != "image/jpeg" {
+			t.Errorf("%s: first = %+v", pass, a)
+		}
+		if a.Sender != "5553334444" || a.Sent || a.Address != "5551112222~5553334444" || a.ContactName != "Ann, Bob" {
+			t.Errorf("%s: received MMS sender = %+v", pass, a)
+		}
+		if !b.Sent || b.Time.UnixMilli() != 1705318246000 {
+			t.Errorf("%s: sent MMS = %+v", pass, b)
+		}
+	}
+}
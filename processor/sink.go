@@ -0,0 +1,187 @@
+package processor
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink stores the files ProcessFile writes. Names are '/'-separated paths
+// relative to the sink's root. Sinks are used from several goroutines at once.
+type Sink interface {
+	// Exists reports whether name is stored.
+	Exists(name string) (bool, error)
+	// Put stores data as name, with modification time mtime. A file is stored
+	// whole or not at all. ProcessFile only puts a name it found missing, and
+	// two puts of one name hold the same data, so a sink may keep either.
+	Put(name string, data []byte, mtime time.Time) error
+	// List returns the names stored, sorted.
+	List() ([]string, error)
+}
+
+// FileMeta describes the message a stored file comes from.
+type FileMeta struct {
+	// Time is the message timestamp, also the file's modification time.
+	Time time.Time
+	// ContentType is the part's lowercased MIME type; it is empty for files
+	// sbr generates, such as SaveText's.
+	ContentType string
+	// Sender is the raw address the message came from, and Sent whether the
+	// backup owner sent it.
+	Sender string
+	Sent   bool
+}
+
+// A MetaSink is a Sink that also records the FileMeta of each file, such as
+// an object store with per-object metadata. ProcessFile calls PutMeta
+// instead of Put.
+type MetaSink interface {
+	Sink
+	PutMeta(name string, data []byte, meta FileMeta) error
+}
+
+// DirSink is the Sink of a directory on the local filesystem, the default.
+// Each file is written to a temporary file beside it and renamed into place.
+type DirSink struct {
+	Dir string
+}
+
+func (s DirSink) path(name string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(name))
+}
+
+// Exists reports whether name exists; a directory of that name is an error.
+func (s DirSink) Exists(name string) (bool, error) {
+	oFile := s.path(name)
+	oStat, err := os.Stat(oFile)
+	if err != nil {
+		return false, nil
+	}
+	if oStat.IsDir() {
+		return false, fmt.Errorf("output path %s is an existing directory", oFile)
+	}
+	return true, nil
+}
+
+func (s DirSink) Put(name string, data []byte, mtime time.Time) error {
+	oFile := s.path(name)
+
+	// Create a uniquely-named temp file in the same directory as the target so
+	// that os.Rename is always an atomic same-filesystem move. Using a unique
+	// name (rather than oFile+".tmp") means two concurrent goroutines writing
+	// to the same final path - e.g. two MMS messages that share a timestamp
+	// and filename - never stomp each other's temp file. The rename is
+	// last-writer-wins, which is safe because both goroutines hold identical
+	// content (truly duplicate attachments decode to the same bytes).
+	dir := filepath.Dir(oFile)
+	if dir != filepath.Clean(s.Dir) {
+		// A template may put the file in a subdirectory.
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("creating directory %s: %w", dir, err)
+		}
+	}
+	tmp, err := os.CreateTemp(dir, ".sbr-*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temp file in %s: %w", dir, err)
+	}
+	oTempfile := tmp.Name()
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		_ = os.Remove(oTempfile)
+		return fmt.Errorf("writing attachment to %s: %w", oTempfile, err)
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(oTempfile)
+		return fmt.Errorf("closing temp file %s: %w", oTempfile, err)
+	}
+
+	if err = os.Chtimes(oTempfile, mtime, mtime); err != nil {
+		_ = os.Remove(oTempfile)
+		return fmt.Errorf("setting file time on %s: %w", oTempfile, err)
+	}
+
+	if err = os.Rename(oTempfile, oFile); err != nil {
+		_ = os.Remove(oTempfile)
+		return fmt.Errorf("renaming %s to %s: %w", oTempfile, oFile, err)
+	}
+	return nil
+}
+
+// List returns the regular files under the directory, leaving out sbr's own
+// bookkeeping: temporary files, the ledger and migration undo logs.
+func (s DirSink) List() ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(s.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".sbr-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Dir, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// MemSink is a Sink holding its files in memory, for tests and for programs
+// that post-process extracted files themselves.
+type MemSink struct {
+	mu    sync.Mutex
+	files map[string]memFile
+}
+
+type memFile struct {
+	data  []byte
+	mtime time.Time
+}
+
+// NewMemSink returns an empty MemSink.
+func NewMemSink() *MemSink {
+	return &MemSink{files: make(map[string]memFile)}
+}
+
+func (s *MemSink) Exists(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.files[name]
+	return ok, nil
+}
+
+// Put stores a copy of data.
+func (s *MemSink) Put(name string, data []byte, mtime time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = memFile{data: append([]byte(nil), data...), mtime: mtime}
+	return nil
+}
+
+func (s *MemSink) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Get returns the data and modification time stored as name.
+func (s *MemSink) Get(name string) ([]byte, time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[name]
+	return f.data, f.mtime, ok
+}
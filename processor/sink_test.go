@@ -0,0 +1,122 @@
+package processor
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sinkDoc has two attachments, one of them twice.
+var sinkDoc = `<smses>
+  <mms date="1705318245000" address="+1"><parts>
+    <part seq="0" ct="image/jpeg" cl="a.jpg" data="` + mustEncode("A") + `"/>
+    <part seq="1" ct="image/png" data="` + mustEncode("P") + `"/>
+  </parts></mms>
+  <mms date="1705318245000" address="+1"><parts>
+    <part seq="0" ct="image/jpeg" cl="a.jpg" data="` + mustEncode("A") + `"/>
+  </parts></mms>
+</smses>`
+
+func TestDirSink(t *testing.T) {
+	dir := t.TempDir()
+	s := DirSink{Dir: dir}
+	mtime := time.Date(2024, 1, 15, 11, 30, 45, 0, time.UTC)
+	if err := s.Put("2024/a.jpg", []byte("A"), mtime); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.Exists("2024/a.jpg"); !ok || err != nil {
+		t.Errorf("Exists = %v, %v", ok, err)
+	}
+	if ok, _ := s.Exists("b.jpg"); ok {
+		t.Error("Exists(b.jpg) = true")
+	}
+	if _, err := s.Exists("2024"); err == nil {
+		t.Error("a directory in the way is not an error")
+	}
+	info, err := os.Stat(filepath.Join(dir, "2024", "a.jpg"))
+	if err != nil || !info.ModTime().Equal(mtime) {
+		t.Errorf("stat = %v, %v", info, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, LedgerFile), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if names, err := s.List(); err != nil || strings.Join(names, " ") != "2024/a.jpg" {
+		t.Errorf("List = %q, %v", names, err)
+	}
+}
+
+func TestProcessFile_MemSink(t *testing.T) {
+	sink := NewMemSink()
+	opts := Options{Sink: sink, Location: time.UTC, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	var written int
+	opts.OnProgress = func(p Progress) {
+		if p.Kind == ProgressWritten {
+			written++
+		}
+	}
+	dir := t.TempDir()
+	ProcessFile(strings.NewReader(sinkDoc), "sms-1.xml", dir, opts)
+
+	names, _ := sink.List()
+	want := []string{"2024-01-15-113045-1.png", "2024-01-15-113045-" + contentHash([]byte("A")) + "-a.jpg", "2024-01-15-113045-a.jpg"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("sink holds %q, want %q", names, want)
+	}
+	data, mtime, ok := sink.Get("2024-01-15-113045-a.jpg")
+	if !ok || string(data) != "A" || mtime.UnixMilli() != 1705318245000 {
+		t.Errorf("Get = %q, %v, %v", data, mtime, ok)
+	}
+	if written != 3 {
+		t.Errorf("%d written, want 3", written)
+	}
+	if got := readDir(t, dir); len(got) != 0 {
+		t.Errorf("the output directory was written to: %q", got)
+	}
+
+	// What the sink holds is not written again.
+	written = 0
+	ProcessFile(strings.NewReader(sinkDoc), "sms-1.xml", dir, opts)
+	if written != 0 {
+		t.Errorf("second run wrote %d", written)
+	}
+}
+
+// metaSink is a MemSink recording the FileMeta of each file.
+type metaSink struct {
+	*MemSink
+	mu    sync.Mutex
+	metas map[string]FileMeta
+}
+
+func (s *metaSink) PutMeta(name string, data []byte, meta FileMeta) error {
+	s.mu.Lock()
+	s.metas[name] = meta
+	s.mu.Unlock()
+	return s.Put(name, data, meta.Time)
+}
+
+func TestProcessFile_MetaSink(t *testing.T) {
+	sink := &metaSink{MemSink: NewMemSink(), metas: make(map[string]FileMeta)}
+	opts := Options{Sink: sink, SaveText: true, Location: time.UTC, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	doc := `<smses>
+  <mms date="1705318245000" msg_box="2" address="+1"><parts>
+    <part seq="0" ct="Image/JPEG" cl="a.jpg" data="` + mustEncode("A") + `"/>
+    <part seq="1" ct="text/plain" text="hi"/>
+  </parts></mms>
+</smses>`
+	ProcessFile(strings.NewReader(doc), "sms-1.xml", t.TempDir(), opts)
+
+	jpg := sink.metas["2024-01-15-113045-a.jpg"]
+	if jpg.ContentType != "image/jpeg" || !jpg.Sent || jpg.Time.UnixMilli() != 1705318245000 {
+		t.Errorf("attachment meta = %+v", jpg)
+	}
+	txt, ok := sink.metas["2024-01-15-113045.txt"]
+	if !ok || txt.ContentType != "" || !txt.Sent {
+		t.Errorf("text meta = %+v, %v (stored %v)", txt, ok, sink.metas)
+	}
+}
@@ -0,0 +1,45 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/junkblocker/sbr/smil"
+)
+
+// partSlides returns, for each part of mms, the 1-based number of the SMIL
+// slide it appears on, or 0 when the message has no usable presentation or
+// the part is not on any slide.
+func partSlides(mms *mmsRecord) ([]int, error) {
+	ids := make([]smil.PartID, len(mms.Parts))
+	var doc []byte
+	for i, p := range mms.Parts {
+		ids[i] = smil.PartID{ContentLocation: p.Filename, ContentID: p.ContentID, Name: p.Name}
+		if doc == nil && strings.ToLower(p.ContentType) == smil.ContentType {
+			var err error
+			if doc, err = smil.Document(p.Text, p.Data); err != nil {
+				return nil, fmt.Errorf("decoding SMIL part: %w", err)
+			}
+		}
+	}
+	if doc == nil {
+		return make([]int, len(mms.Parts)), nil
+	}
+	slides, err := smil.Parse(doc)
+	if err != nil {
+		return nil, err
+	}
+	smil.Match(slides, ids)
+	return smil.SlideOf(slides, len(mms.Parts)), nil
+}
+
+// slidePrefix extends a message's datePrefix with the slide number of one of
+// its parts ("<datePrefix>-slide02"), so that a directory listing shows the
+// attachments in the order they appeared on the phone. Parts on no slide keep
+// the plain datePrefix.
+func slidePrefix(datePrefix string, slide int) string {
+	if slide == 0 {
+		return datePrefix
+	}
+	return fmt.Sprintf("%s-slide%02d", datePrefix, slide)
+}
@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessFile_SlideNumbers(t *testing.T) {
+	smilText := `&lt;smil&gt;&lt;body&gt;&lt;par&gt;&lt;img src=&quot;cid:second&quot;/&gt;&lt;/par&gt;&lt;par&gt;&lt;img src=&quot;a.jpg&quot;/&gt;&lt;/par&gt;&lt;/body&gt;&lt;/smil&gt;`
+	doc := `<smses><mms date="1705318245000" address="+1">
+    <parts>
+      <part seq="0" ct="application/smil" cl="smil.xml" text="` + smilText + `" data="null"/>
+      <part seq="1" ct="image/jpeg" cl="a.jpg" text="null" data="` + mustEncode("A") + `"/>
+      <part seq="2" ct="image/jpeg" cl="b.jpg" cid="&lt;second&gt;" text="null" data="` + mustEncode("B") + `"/>
+      <part seq="3" ct="image/png" cl="extra.png" text="null" data="` + mustEncode("C") + `"/>
+    </parts>
+  </mms></smses>`
+
+	t.Run("slide numbers in names", func(t *testing.T) {
+		dir := t.TempDir()
+		opts := Options{SlideNumbers: true}
+		ProcessFile(strings.NewReader(doc), "test.xml", dir, opts)
+
+		assertFile(t, filepath.Join(dir, ts1Prefix+"-slide01-b.jpg"), []byte("B"))
+		assertFile(t, filepath.Join(dir, ts1Prefix+"-slide02-a.jpg"), []byte("A"))
+		// A part on no slide keeps the plain name.
+		assertFile(t, filepath.Join(dir, ts1Prefix+"-extra.png"), []byte("C"))
+
+		if report := VerifyFile(strings.NewReader(doc), "test.xml", dir, opts); !report.Clean() || report.OK != 3 {
+			t.Errorf("verify report = %+v, want 3 ok", report)
+		}
+	})
+
+	t.Run("slide field of a template", func(t *testing.T) {
+		tmpl, err := ParseTemplate("{slide}-{leaf}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		ProcessFile(strings.NewReader(doc), "test.xml", dir, Options{Template: tmpl})
+		assertFile(t, filepath.Join(dir, "01-b.jpg"), []byte("B"))
+		assertFile(t, filepath.Join(dir, "02-a.jpg"), []byte("A"))
+		assertFile(t, filepath.Join(dir, "00-extra.png"), []byte("C"))
+	})
+
+	t.Run("plain names by default", func(t *testing.T) {
+		dir := t.TempDir()
+		ProcessFile(strings.NewReader(doc), "test.xml", dir, Options{})
+		assertFile(t, filepath.Join(dir, ts1Prefix+"-a.jpg"), []byte("A"))
+		assertFile(t, filepath.Join(dir, ts1Prefix+"-b.jpg"), []byte("B"))
+	})
+}
@@ -0,0 +1,252 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/junkblocker/sbr/contact"
+	"github.com/junkblocker/sbr/types"
+)
+
+// Template is a pattern for attachment names, such as
+// "{date:2006}/{contact}/{date}-{time}-{leaf}". Text in braces is a field,
+// replaced by a property of the attachment; "{{" and "}}" stand for literal
+// braces, and '/' separates directories. The fields are:
+//
+//	{date}       the MMS date, formatted with a Go time layout given after a
+//	             colon, by default "2006-01-02"
+//	{time}       the MMS time, likewise, by default "150405" plus the
+//	             Options.SubSecondDigits fraction
+//	{contact}    the conversation's contact names (", " between group
+//	             members), or {address} if it has none
+//	{address}    the conversation's normalised addresses, sorted, with '~'
+//	             between group members
+//	{direction}  "in" for received messages, "out" for sent ones
+//	{thread}     8 hex digits identifying the conversation by {address}
+//	{leaf}       the name the default convention gives after its date
+//	{index}      the 0-based position of the part in its message
+//	{slide}      the 2-digit number of the SMIL slide the part is on, or
+//	             "00" if none
+//	{hash8}      the first 8 hex digits of the SHA-256 of the attachment
+//	{ext}        the extension of {leaf}, with its dot
+//
+// Dates and times are in Options.Location, and addresses are normalised
+// with Options.Normaliser. Each directory and file name of
+// the result is sanitised as the default names are (see SanitiseFilename).
+type Template struct {
+	src string
+	// dirs holds the elements of each '/'-separated directory and file name,
+	// the file name last.
+	dirs  [][]tmplElem
+	hash  bool // uses {hash8}
+	slide bool // uses {slide}
+}
+
+// tmplElem is literal text, or a field with its argument.
+type tmplElem struct {
+	lit   string
+	field string
+	arg   string
+}
+
+// templateFields lists the fields a Template accepts, and whether they take
+// an argument.
+var templateFields = map[string]bool{
+	"date": true, "time": true,
+	"contact": false, "address": false, "direction": false, "thread": false,
+	"leaf": false, "index": false, "slide": false, "hash8": false, "ext": false,
+}
+
+// ParseTemplate parses a Template.
+func ParseTemplate(s string) (*Template, error) {
+	t := &Template{src: s}
+	var (
+		elems []tmplElem
+		lit   strings.Builder
+	)
+	flush := func() {
+		if lit.Len() > 0 {
+			elems = append(elems, tmplElem{lit: lit.String()})
+			lit.Reset()
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '{' && strings.HasPrefix(s[i:], "{{"), c == '}' && strings.HasPrefix(s[i:], "}}"):
+			lit.WriteByte(c)
+			i++
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("template %q: unclosed {", s)
+			}
+			field, arg, hasArg := strings.Cut(s[i+1:i+end], ":")
+			takesArg, ok := templateFields[field]
+			switch {
+			case !ok:
+				return nil, fmt.Errorf("template %q: unknown field {%s}", s, field)
+			case hasArg && !takesArg:
+				return nil, fmt.Errorf("template %q: {%s} takes no argument", s, field)
+			case hasArg && arg == "":
+				return nil, fmt.Errorf("template %q: empty layout in {%s:}", s, field)
+			}
+			flush()
+			elems = append(elems, tmplElem{field: field, arg: arg})
+			t.hash = t.hash || field == "hash8"
+			t.slide = t.slide || field == "slide"
+			i += end
+		case c == '}':
+			return nil, fmt.Errorf("template %q: unmatched }", s)
+		case c == '/':
+			flush()
+			if len(elems) > 0 {
+				t.dirs = append(t.dirs, elems)
+				elems = nil
+			}
+		default:
+			lit.WriteByte(c)
+		}
+	}
+	flush()
+	if len(elems) == 0 {
+		return nil, fmt.Errorf("template %q: no file name", s)
+	}
+	t.dirs = append(t.dirs, elems)
+	return t, nil
+}
+
+// String returns the template's source.
+func (t *Template) String() string { return t.src }
+
+// render returns the path, relative to the output directory and
+// '/'-separated, of the attachment item under t. A non-empty disambigHash is
+// added before the file name's extension.
+func (t *Template) render(item workItem, disambigHash string) string {
+	names := make([]string, len(t.dirs))
+	for i, elems := range t.dirs {
+		var b strings.Builder
+		for _, e := range elems {
+			if e.field == "" {
+				b.WriteString(e.lit)
+				continue
+			}
+			b.WriteString(t.field(item, e))
+		}
+		name := sanitiseLeafName(b.String())
+		if name == "" {
+			name = "_"
+		}
+		names[i] = name
+	}
+	if disambigHash != "" {
+		last := names[len(names)-1]
+		ext := path.Ext(last)
+		names[len(names)-1] = strings.TrimSuffix(last, ext) + "-" + disambigHash + ext
+	}
+	return strings.Join(names, "/")
+}
+
+// field returns the value of one field for item. Values never contain '/',
+// so they cannot add directories.
+func (t *Template) field(item workItem, e tmplElem) string {
+	var v string
+	switch e.field {
+	case "date":
+		layout := e.arg
+		if layout == "" {
+			layout = "2006-01-02"
+		}
+		v = item.sentTime.Format(layout)
+	case "time":
+		layout := e.arg
+		if layout == "" {
+			layout = "150405"
+			if digits := min(item.subSecond, 3); digits > 0 {
+				layout += "." + strings.Repeat("0", digits)
+			}
+		}
+		v = item.sentTime.Format(layout)
+	case "contact":
+		var names []string
+		for _, id := range item.participants() {
+			if id.Name != "" {
+				names = append(names, id.Name)
+			}
+		}
+		v = strings.Join(names, ", ")
+		if v == "" {
+			v = t.field(item, tmplElem{field: "address"})
+		}
+	case "address":
+		v = item.conversationAddress()
+		if v == "" {
+			v = "unknown"
+		}
+	case "direction":
+		v = "in"
+		if item.mms != nil {
+			if _, sent := item.mms.sender(); sent {
+				v = "out"
+			}
+		}
+	case "thread":
+		sum := sha256.Sum256([]byte(item.conversationAddress()))
+		v = fmt.Sprintf("%x", sum[:4])
+	case "leaf":
+		v = partLeafName(item.part)
+		if v == "" {
+			v = strconv.Itoa(item.partIndex) + ExtForContentType(strings.ToLower(item.part.ContentType))
+		}
+	case "index":
+		v = strconv.Itoa(item.partIndex)
+	case "slide":
+		v = fmt.Sprintf("%02d", item.slide)
+	case "hash8":
+		v = item.hash
+	case "ext":
+		if v = path.Ext(partLeafName(item.part)); v == "" {
+			v = ExtForContentType(strings.ToLower(item.part.ContentType))
+		}
+	}
+	return strings.NewReplacer("/", "_", `\`, "_").Replace(v)
+}
+
+// participants returns the identities of the conversation of item's
+// message, as its address and contact_name attributes name them, sorted by
+// ID. Only the message itself is consulted, so that the same message is
+// named alike whichever backup it is found in.
+func (w workItem) participants() []*contact.Identity {
+	if w.mms == nil {
+		return nil
+	}
+	r := contact.NewResolver(w.norm)
+	address := types.PhoneNumber(w.mms.Address)
+	r.Observe(address, w.mms.ContactName)
+	return r.Participants(contact.SplitAddresses(address))
+}
+
+// conversationAddress returns the normalised addresses of the conversation
+// of w's message, sorted and joined with '~', or "" if it has none.
+func (w workItem) conversationAddress() string {
+	if w.mms == nil {
+		return ""
+	}
+	norm := w.norm
+	if norm == nil {
+		norm = &contact.Normaliser{}
+	}
+	seen := make(map[string]bool)
+	var addrs []string
+	for _, a := range contact.SplitAddresses(types.PhoneNumber(w.mms.Address)) {
+		if n := string(norm.Normalise(a)); n != "" && !seen[n] {
+			seen[n] = true
+			addrs = append(addrs, n)
+		}
+	}
+	sort.Strings(addrs)
+	return strings.Join(addrs, "~")
+}
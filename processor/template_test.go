@@ -0,0 +1,156 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/junkblocker/sbr/contact"
+	"github.com/junkblocker/sbr/types"
+)
+
+func TestParseTemplate_Errors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"{date}/",
+		"{nope}",
+		"{leaf",
+		"leaf}",
+		"{leaf:x}",
+		"{date:}",
+	} {
+		if _, err := ParseTemplate(s); err == nil {
+			t.Errorf("ParseTemplate(%q) succeeded", s)
+		}
+	}
+}
+
+func TestTemplate_Render(t *testing.T) {
+	sent := time.Date(2024, 1, 15, 11, 30, 45, 123e6, time.UTC)
+	mms := &mmsRecord{Address: "+2~+1", ContactName: "Ann, Bob/Jr", MessageBox: types.MessageBoxSent}
+	item := workItem{
+		part:      mmsPart{ContentType: "image/jpeg", Filename: "IMG 1.JPG"},
+		sentTime:  sent,
+		partIndex: 2,
+		mms:       mms,
+		hash:      "0123abcd",
+		subSecond: 3,
+		slide:     3,
+	}
+	unnamed := item
+	unnamed.part = mmsPart{ContentType: "image/png"}
+	unknown := item
+	unknown.mms = &mmsRecord{Address: "+1~+2", ContactName: "(Unknown)"}
+	thread := fmt.Sprintf("%x", sha256.Sum256([]byte("+1~+2")))[:8]
+
+	tests := []struct {
+		tmpl string
+		item workItem
+		hash string
+		want string
+	}{
+		{"{date}-{time}-{leaf}", item, "", "2024-01-15-113045.123-IMG 1.JPG"},
+		{"{date:2006}/{date:01}/{contact}-{index}{ext}", item, "", "2024/01/Bob_Jr, Ann-2.JPG"},
+		{"{direction}/{address}/{hash8}{ext}", item, "", "out/+1~+2/0123abcd.JPG"},
+		{"{contact}/{thread}-{leaf}", unknown, "", "+1~+2/" + thread + "-IMG 1.JPG"},
+		{"{slide}-{leaf}", item, "", "03-IMG 1.JPG"},
+		{"{leaf}", unnamed, "", "2.png"},
+		{"{date}-{leaf}", item, "deadbeef", "2024-01-15-IMG 1-deadbeef.JPG"},
+		{"{{{index}}}", item, "", "{2}"},
+		{"../{index}", item, "", "_/2"},
+		{"a//CON", item, "", "a/_CON"},
+	}
+	for _, tt := range tests {
+		tmpl, err := ParseTemplate(tt.tmpl)
+		if err != nil {
+			t.Fatalf("ParseTemplate(%q): %v", tt.tmpl, err)
+		}
+		if got := tmpl.render(tt.item, tt.hash); got != tt.want {
+			t.Errorf("%q renders %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestTemplate_Normalised(t *testing.T) {
+	n, err := contact.NewNormaliser("US")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ParseTemplate("{contact}/{address}/{thread}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := func(address, contactName string) string {
+		return tmpl.render(workItem{mms: &mmsRecord{Address: address, ContactName: contactName}, norm: n}, "")
+	}
+	// Every spelling of the same conversation is named alike.
+	want := render("+15551112222~+15553334444", "")
+	if !strings.HasPrefix(want, "+15551112222~+15553334444/+15551112222~+15553334444/") {
+		t.Errorf("rendered %q", want)
+	}
+	if got := render("(555) 333-4444 ~ 555-111-2222", "null"); got != want {
+		t.Errorf("rendered %q, want %q", got, want)
+	}
+	if got := render("555 111 2222", "Ann"); !strings.HasPrefix(got, "Ann/+15551112222/") {
+		t.Errorf("rendered %q, want Ann/+15551112222/...", got)
+	}
+}
+
+func TestProcessFile_Template(t *testing.T) {
+	doc := `<smses>
+  <mms date="1705318245000" address="+1" contact_name="Ann" msg_box="1"><parts>
+    <part seq="0" ct="image/jpeg" cl="a.jpg" data="` + mustEncode("A") + `"/>
+  </parts></mms>
+  <mms date="1705318245000" address="+1" contact_name="Ann" msg_box="1"><parts>
+    <part seq="0" ct="image/jpeg" cl="a.jpg" data="` + mustEncode("B") + `"/>
+  </parts></mms>
+</smses>`
+	quiet := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, tt := range []struct {
+		tmpl string
+		want []string
+	}{
+		// A name given twice gets the content hash before its extension.
+		{"{date:2006}/{contact}/{date}-{leaf}", []string{
+			"2024/Ann/2024-01-15-a-" + contentHash([]byte("B")) + ".jpg",
+			"2024/Ann/2024-01-15-a.jpg",
+		}},
+		// Names that already hold the hash need no more.
+		{"{direction}/{hash8}{ext}", []string{
+			"in/" + contentHash([]byte("A")) + ".jpg",
+			"in/" + contentHash([]byte("B")) + ".jpg",
+		}},
+	} {
+		tmpl, err := ParseTemplate(tt.tmpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		opts := Options{Template: tmpl, Location: time.UTC, Logger: quiet}
+		ProcessFile(strings.NewReader(doc), "sms-1.xml", dir, opts)
+
+		var got []string
+		filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				rel, _ := filepath.Rel(dir, p)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			return err
+		})
+		sort.Strings(got)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%q wrote %q, want %q", tt.tmpl, got, tt.want)
+		}
+		if report := VerifyFile(strings.NewReader(doc), "sms-1.xml", dir, opts); !report.Clean() || report.OK != 2 {
+			t.Errorf("%q: verify = %+v", tt.tmpl, report)
+		}
+	}
+}
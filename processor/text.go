@@ -0,0 +1,220 @@
+package processor
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+
+	"github.com/junkblocker/sbr/types"
+)
+
+// textFilename returns the name of the file holding an MMS's text. It is the
+// bare datePrefix, so the text sorts immediately before the message's
+// attachments ("<datePrefix>-<leaf>") and can never collide with them.
+// disambigHash plays the same role as for attachments when two messages share
+// a timestamp.
+func textFilename(datePrefix, disambigHash string) string {
+	if disambigHash != "" {
+		return datePrefix + "-" + disambigHash + ".txt"
+	}
+	return datePrefix + ".txt"
+}
+
+// messageText gathers the human-readable text of an MMS: every text/plain part
+// in document order followed by the message body, separated by newlines. It
+// returns nil if the message has no text.
+//
+// The app stores most text in the part's text attribute, already converted to
+// Unicode; a part that instead carries base64 data is decoded using its chset.
+func messageText(mms *mmsRecord) ([]byte, error) {
+	var texts []string
+	for _, part := range mms.Parts {
+		if strings.ToLower(part.ContentType) != "text/plain" {
+			continue
+		}
+		text, err := partText(part.Text, part.Data, part.Charset)
+		if err != nil {
+			return nil, err
+		}
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+	if body := strings.TrimSpace(mms.Body); body != "" && body != "null" {
+		texts = append(texts, body)
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	return []byte(strings.Join(texts, "\n") + "\n"), nil
+}
+
+// PartText returns the text of an MMS text part: its text attribute, or else
+// its base64 data decoded using its chset. It returns "" for a part with
+// neither.
+func PartText(p types.MMSPart) (string, error) {
+	return partText(p.Text, p.Data, p.Charset)
+}
+
+func partText(text, data, mib string) (string, error) {
+	switch {
+	case text != "" && text != "null":
+		return text, nil
+	case data != "" && data != "null":
+		raw, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return "", fmt.Errorf("decoding text part data: %w", err)
+		}
+		return decodeCharset(raw, mib)
+	}
+	return "", nil
+}
+
+// PartName returns the name an MMS part was sent under, decoded using its
+// chset: the cl attribute, or else the name attribute, or "" if it has
+// neither. Unlike the names extracted files are given, it is not sanitised.
+func PartName(p types.MMSPart) string {
+	return partName(p.Filename, p.Name, p.Charset)
+}
+
+func partName(cl, name, mib string) string {
+	for _, s := range []string{cl, name} {
+		if s != "" && s != "null" {
+			return decodeName(s, mib)
+		}
+	}
+	return ""
+}
+
+// decodeCharset converts raw text in the charset identified by an IANA MIBenum
+// (the form MMS uses for chset) to a UTF-8 string. A missing or "null" charset
+// is treated as UTF-8, the MMS default.
+func decodeCharset(raw []byte, mib string) (string, error) {
+	switch mib {
+	case "", "null", "106": // UTF-8
+		return strings.ToValidUTF8(string(raw), string(utf8.RuneError)), nil
+	case "3": // US-ASCII
+		return strings.ToValidUTF8(string(raw), string(utf8.RuneError)), nil
+	case "1013": // UTF-16BE
+		return decodeUTF16(raw, true), nil
+	case "1014": // UTF-16LE
+		return decodeUTF16(raw, false), nil
+	case "1000", "1015": // UCS-2, or UTF-16 with optional BOM; big-endian by default.
+		if len(raw) >= 2 && raw[0] == 0xff && raw[1] == 0xfe {
+			return decodeUTF16(raw[2:], false), nil
+		}
+		if len(raw) >= 2 && raw[0] == 0xfe && raw[1] == 0xff {
+			raw = raw[2:]
+		}
+		return decodeUTF16(raw, true), nil
+	}
+	enc, ok := mibEncodings[mib]
+	if !ok {
+		return "", fmt.Errorf("unsupported charset MIBenum %s", mib)
+	}
+	text, err := enc.NewDecoder().Bytes(raw)
+	if err != nil {
+		return "", fmt.Errorf("decoding charset MIBenum %s: %w", mib, err)
+	}
+	return string(text), nil
+}
+
+// mibEncodings maps the IANA MIBenum of each legacy charset phones are known
+// to use to its encoding.
+var mibEncodings = map[string]encoding.Encoding{
+	"4":    charmap.ISO8859_1,
+	"5":    charmap.ISO8859_2,
+	"6":    charmap.ISO8859_3,
+	"7":    charmap.ISO8859_4,
+	"8":    charmap.ISO8859_5,
+	"9":    charmap.ISO8859_6,
+	"10":   charmap.ISO8859_7,
+	"11":   charmap.ISO8859_8,
+	"12":   charmap.ISO8859_9,
+	"13":   charmap.ISO8859_10,
+	"17":   japanese.ShiftJIS,
+	"18":   japanese.EUCJP,
+	"38":   korean.EUCKR,
+	"39":   japanese.ISO2022JP,
+	"109":  charmap.ISO8859_13,
+	"110":  charmap.ISO8859_14,
+	"111":  charmap.ISO8859_15,
+	"112":  charmap.ISO8859_16,
+	"113":  simplifiedchinese.GBK,
+	"114":  simplifiedchinese.GB18030,
+	"2025": simplifiedchinese.GBK, // GB2312, of which GBK is a superset
+	"2026": traditionalchinese.Big5,
+	"2084": charmap.KOI8R,
+	"2088": charmap.KOI8U,
+	"2250": charmap.Windows1250,
+	"2251": charmap.Windows1251,
+	"2252": charmap.Windows1252,
+	"2253": charmap.Windows1253,
+	"2254": charmap.Windows1254,
+	"2255": charmap.Windows1255,
+	"2256": charmap.Windows1256,
+	"2257": charmap.Windows1257,
+	"2258": charmap.Windows1258,
+}
+
+// decodeName recovers a cl or name attribute written in the part's charset.
+// Android stores those headers byte for byte as ISO-8859-1, so a name in any
+// other charset reaches the backup as one character per byte. When every
+// character of s fits in a byte, some are not ASCII and the bytes decode
+// cleanly in charset mib, the decoded name is returned; otherwise s is
+// returned unchanged.
+func decodeName(s, mib string) string {
+	if mib == "3" || mib == "4" { // ASCII and ISO-8859-1 need no decoding
+		return s
+	}
+	raw := make([]byte, 0, len(s))
+	ascii := true
+	for _, r := range s {
+		if r > 0xff {
+			return s
+		}
+		ascii = ascii && r < utf8.RuneSelf
+		raw = append(raw, byte(r))
+	}
+	if ascii {
+		return s
+	}
+	if mib == "" || mib == "null" || mib == "106" {
+		if !utf8.Valid(raw) {
+			return s
+		}
+		return string(raw)
+	}
+	name, err := decodeCharset(raw, mib)
+	if err != nil || strings.ContainsRune(name, utf8.RuneError) {
+		return s
+	}
+	return name
+}
+
+// DecodeCharset is decodeCharset for other packages that read MMS part
+// payloads, such as shared vCards.
+func DecodeCharset(raw []byte, mib string) (string, error) {
+	return decodeCharset(raw, mib)
+}
+
+func decodeUTF16(raw []byte, bigEndian bool) string {
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		hi, lo := raw[2*i], raw[2*i+1]
+		if !bigEndian {
+			hi, lo = lo, hi
+		}
+		units[i] = uint16(hi)<<8 | uint16(lo)
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,210 @@
+package processor
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/junkblocker/sbr/types"
+)
+
+// ---------------------------------------------------------------------------
+// SaveText
+// ---------------------------------------------------------------------------
+
+func TestProcessFile_SaveText(t *testing.T) {
+	imageData := mustEncode("jpeg")
+	mmsXML := func(date, caption string) string {
+		return `<mms date="` + date + `" address="+1">
+    <parts>
+      <part seq="0" ct="application/smil" cl="smil.xml" text="&lt;smil/&gt;" data="null"/>
+      <part seq="1" ct="image/jpeg" cl="photo.jpg" text="null" data="` + imageData + `"/>
+      <part seq="2" ct="text/plain" chset="106" cl="text_0.txt" text="` + caption + `" data="null"/>
+    </parts>
+  </mms>`
+	}
+
+	t.Run("caption saved next to attachment", func(t *testing.T) {
+		dir := t.TempDir()
+		doc := `<smses>` + mmsXML("1705318245000", "happy birthday grandpa!") + `</smses>`
+		ProcessFile(strings.NewReader(doc), "test.xml", dir, Options{SaveText: true})
+
+		assertFile(t, filepath.Join(dir, ts1Prefix+".txt"), []byte("happy birthday grandpa!\n"))
+		assertFile(t, filepath.Join(dir, ts1Prefix+"-photo.jpg"), []byte("jpeg"))
+	})
+
+	t.Run("text not saved by default", func(t *testing.T) {
+		dir := t.TempDir()
+		doc := `<smses>` + mmsXML("1705318245000", "caption") + `</smses>`
+		ProcessFile(strings.NewReader(doc), "test.xml", dir, Options{})
+
+		if names := readDir(t, dir); len(names) != 1 {
+			t.Errorf("expected only the attachment, got %v", names)
+		}
+	})
+
+	t.Run("same-second messages get disambiguated text files", func(t *testing.T) {
+		dir := t.TempDir()
+		doc := `<smses>` + mmsXML("1705318245000", "first") + mmsXML("1705318245000", "second") + `</smses>`
+		ProcessFile(strings.NewReader(doc), "test.xml", dir, Options{SaveText: true})
+
+		assertFile(t, filepath.Join(dir, ts1Prefix+".txt"), []byte("first\n"))
+		assertFile(t, filepath.Join(dir, ts1Prefix+"-"+hashOf(t, []byte("second\n"))+".txt"), []byte("second\n"))
+	})
+
+	t.Run("text parts and body are joined", func(t *testing.T) {
+		dir := t.TempDir()
+		utf16Data := base64.StdEncoding.EncodeToString(utf16BE("añ"))
+		doc := `<smses><mms date="1705318245000" address="+1">
+    <parts>
+      <part seq="0" ct="text/plain" text="one" data="null"/>
+      <part seq="1" ct="TEXT/PLAIN" chset="1015" text="null" data="` + utf16Data + `"/>
+    </parts>
+    <body>tail</body>
+  </mms></smses>`
+		ProcessFile(strings.NewReader(doc), "test.xml", dir, Options{SaveText: true})
+
+		assertFile(t, filepath.Join(dir, ts1Prefix+".txt"), []byte("one\nañ\ntail\n"))
+	})
+
+	t.Run("verify checks text files", func(t *testing.T) {
+		dir := t.TempDir()
+		doc := `<smses>` + mmsXML("1705318245000", "caption") + `</smses>`
+		opts := Options{SaveText: true}
+		ProcessFile(strings.NewReader(doc), "test.xml", dir, opts)
+		report := VerifyFile(strings.NewReader(doc), "test.xml", dir, opts)
+		if !report.Clean() || report.OK != 2 {
+			t.Errorf("report = %+v, want 2 ok", report)
+		}
+	})
+}
+
+func utf16BE(s string) []byte {
+	var out []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return out
+}
+
+func TestDecodeCharset(t *testing.T) {
+	cases := []struct {
+		name string
+		raw  []byte
+		mib  string
+		want string
+	}{
+		{"utf-8", []byte("héllo"), "106", "héllo"},
+		{"default utf-8", []byte("héllo"), "null", "héllo"},
+		{"latin-1", []byte{'c', 0xe9}, "4", "cé"},
+		{"utf-16be", utf16BE("日本"), "1013", "日本"},
+		{"utf-16 bom le", []byte{0xff, 0xfe, 'h', 0, 'i', 0}, "1015", "hi"},
+		{"invalid utf-8 replaced", []byte{'a', 0xff}, "106", "a�"},
+		{"shift_jis", []byte{0x93, 0xfa, 0x96, 0x7b}, "17", "日本"},
+		{"gb2312", []byte{0xd6, 0xd0, 0xce, 0xc4}, "2025", "中文"},
+		{"big5", []byte{0xa4, 0xa4, 0xa4, 0xe5}, "2026", "中文"},
+		{"iso-8859-7", []byte{0xe1, 0xe2}, "10", "αβ"},
+		{"windows-1251", []byte{0xcf, 0xf0}, "2251", "Пр"},
+	}
+	for _, tc := range cases {
+		got, err := decodeCharset(tc.raw, tc.mib)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+	if _, err := decodeCharset([]byte("x"), "999999"); err == nil {
+		t.Error("expected error for unsupported charset")
+	}
+}
+
+// latin1 spells raw bytes as Android stores cl and name: one character per
+// byte.
+func latin1(raw []byte) string {
+	runes := make([]rune, len(raw))
+	for i, b := range raw {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+func TestDecodeName(t *testing.T) {
+	cases := []struct {
+		name, s, mib, want string
+	}{
+		{"shift_jis", latin1([]byte{0x93, 0xfa, 0x96, 0x7b, '.', 'j', 'p', 'g'}), "17", "日本.jpg"},
+		{"utf-8 read as latin-1", latin1([]byte("café.jpg")), "106", "café.jpg"},
+		{"untagged utf-8", latin1([]byte("café.jpg")), "null", "café.jpg"},
+		{"already unicode", "日本.jpg", "17", "日本.jpg"},
+		{"genuine latin-1", "café.jpg", "106", "café.jpg"},
+		{"latin-1 charset", "café.jpg", "4", "café.jpg"},
+		{"ascii", "photo.jpg", "17", "photo.jpg"},
+		{"undecodable", latin1([]byte{0x85, 0x20}), "17", latin1([]byte{0x85, 0x20})},
+	}
+	for _, tc := range cases {
+		if got := decodeName(tc.s, tc.mib); got != tc.want {
+			t.Errorf("%s: decodeName(%q, %s) = %q, want %q", tc.name, tc.s, tc.mib, got, tc.want)
+		}
+	}
+}
+
+func TestPartName(t *testing.T) {
+	sjis := latin1([]byte{0x93, 0xfa, 0x96, 0x7b, '.', 'j', 'p', 'g'})
+	cases := []struct {
+		part types.MMSPart
+		want string
+	}{
+		{types.MMSPart{Filename: "a.jpg", Name: "b.jpg"}, "a.jpg"},
+		{types.MMSPart{Filename: "null", Name: "b.jpg"}, "b.jpg"},
+		{types.MMSPart{Filename: sjis, Charset: "17"}, "日本.jpg"},
+		{types.MMSPart{Name: sjis, Charset: "17"}, "日本.jpg"},
+		{types.MMSPart{Filename: "null", Name: "null"}, ""},
+	}
+	for _, tc := range cases {
+		if got := PartName(tc.part); got != tc.want {
+			t.Errorf("PartName(%+v) = %q, want %q", tc.part, got, tc.want)
+		}
+	}
+}
+
+func TestPartText(t *testing.T) {
+	cases := []struct {
+		part types.MMSPart
+		want string
+	}{
+		{types.MMSPart{Text: "hi", Data: base64.StdEncoding.EncodeToString([]byte("ignored"))}, "hi"},
+		{types.MMSPart{Text: "null", Data: base64.StdEncoding.EncodeToString([]byte("café"))}, "café"},
+		{types.MMSPart{Data: base64.StdEncoding.EncodeToString([]byte{0x93, 0xfa, 0x96, 0x7b}), Charset: "17"}, "日本"},
+		{types.MMSPart{Text: "null", Data: "null"}, ""},
+	}
+	for _, tc := range cases {
+		got, err := PartText(tc.part)
+		if err != nil || got != tc.want {
+			t.Errorf("PartText(%+v) = %q, %v; want %q", tc.part, got, err, tc.want)
+		}
+	}
+	if _, err := PartText(types.MMSPart{Data: "!!"}); err == nil {
+		t.Error("PartText accepted invalid base64")
+	}
+}
+
+func TestProcessFile_CharsetNames(t *testing.T) {
+	dir := t.TempDir()
+	cl := latin1([]byte{0x93, 0xfa, 0x96, 0x7b, '.', 'j', 'p', 'g'})
+	xmlDoc := `<smses>
+  <mms date="1705318245000" address="+1">
+    <parts>
+      <part seq="0" ct="image/jpeg" chset="17" cl="` + cl + `" data="` + mustEncode("a") + `"/>
+    </parts>
+  </mms>
+</smses>`
+	ProcessFile(strings.NewReader(xmlDoc), "test.xml", dir, Options{})
+	if got := readDir(t, dir); len(got) != 1 || got[0] != ts1Prefix+"-日本.jpg" {
+		t.Errorf("saved %q, want [%s-日本.jpg]", got, ts1Prefix)
+	}
+}
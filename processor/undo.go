@@ -0,0 +1,96 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// UndoLog records the renames a migration made in an output directory, so
+// that Undo can reverse them.
+type UndoLog struct {
+	// Dir is the output directory, as an absolute path.
+	Dir string `json:"dir"`
+	// Time is when the migration ran.
+	Time time.Time `json:"time"`
+	// Renames lists the renames made, with paths relative to Dir.
+	Renames []Rename `json:"renames"`
+}
+
+// UndoLogName returns the name of the undo log of a migration run at t, in
+// the output directory. The time has nanosecond digits, so that migrations
+// run in the same second do not overwrite each other's log.
+func UndoLogName(t time.Time) string {
+	return ".sbr-migrate-" + t.Format("20060102-150405.000000000") + ".json"
+}
+
+// WriteUndoLog writes an undo log of renames, made in outPath, to path.
+func WriteUndoLog(path, outPath string, renames []Rename) error {
+	dir, err := filepath.Abs(outPath)
+	if err != nil {
+		return err
+	}
+	undo := UndoLog{Dir: dir, Time: time.Now(), Renames: make([]Rename, 0, len(renames))}
+	for _, r := range renames {
+		oldRel, err1 := filepath.Rel(outPath, r.Old)
+		newRel, err2 := filepath.Rel(outPath, r.New)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("%s -> %s is not in %s", r.Old, r.New, outPath)
+		}
+		undo.Renames = append(undo.Renames, Rename{Old: filepath.ToSlash(oldRel), New: filepath.ToSlash(newRel)})
+	}
+	data, err := json.MarshalIndent(undo, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".sbr-*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temp file for %s: %w", path, err)
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("writing undo log %s: %w", path, err)
+	}
+	return nil
+}
+
+// Undo reverses the renames recorded in the undo log at path, with the same
+// care as MigrateFile: files no longer under their new name are ignored, and
+// a file whose old name has been taken since is reported as a conflict. With
+// dryRun, nothing is renamed.
+func Undo(path string, dryRun bool) MigrateReport {
+	var report MigrateReport
+	data, err := os.ReadFile(path)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("reading undo log: %w", err))
+		return report
+	}
+	var undo UndoLog
+	if err := json.Unmarshal(data, &undo); err != nil {
+		report.Errors = append(report.Errors, fmt.Errorf("reading undo log %s: %w", path, err))
+		return report
+	}
+
+	olds := make([]string, len(undo.Renames))
+	news := make([]string, len(undo.Renames))
+	for i, r := range undo.Renames {
+		olds[i] = filepath.Join(undo.Dir, filepath.FromSlash(r.New))
+		news[i] = filepath.Join(undo.Dir, filepath.FromSlash(r.Old))
+	}
+	report.Renamed, report.Conflicts = migrations(olds, news)
+	if dryRun || len(report.Renamed) == 0 {
+		return report
+	}
+	report.Renamed, report.Errors = ApplyRenames(report.Renamed, undo.Dir)
+	return report
+}
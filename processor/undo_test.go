@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUndo(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "sms-1.xml")
+	out := filepath.Join(dir, "out")
+	doc := `<smses><mms date="1705318245123" address="+1"><parts>
+  <part seq="0" ct="image/jpeg" data="` + mustEncode("A") + `"/>
+</parts></mms></smses>`
+	if err := os.WriteFile(in, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(out, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	from := Options{Naming: NamingBuildFilename, Location: time.UTC}
+	to, err := ParseTemplate("{date:2006}/{index}{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := filepath.Join(out, "2024-01-15-113045.jpg")
+	if err := os.WriteFile(old, []byte("A"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := MigrateFile(in, out, from, Options{Template: to, Location: time.UTC}, false)
+	if len(report.Renamed) != 1 || len(report.Errors) != 0 {
+		t.Fatalf("migrate = %+v", report)
+	}
+	logPath := filepath.Join(out, UndoLogName(time.Now()))
+	if err := WriteUndoLog(logPath, out, report.Renamed); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(logPath)
+	if !strings.Contains(string(data), `"old": "2024-01-15-113045.jpg"`) || !strings.Contains(string(data), `"new": "2024/0.jpg"`) {
+		t.Errorf("undo log = %s", data)
+	}
+
+	if dry := Undo(logPath, true); len(dry.Renamed) != 1 {
+		t.Fatalf("dry undo = %+v", dry)
+	}
+	if _, err := os.Stat(filepath.Join(out, "2024", "0.jpg")); err != nil {
+		t.Fatalf("dry undo moved the file: %v", err)
+	}
+	if undo := Undo(logPath, false); len(undo.Renamed) != 1 || len(undo.Errors) != 0 {
+		t.Fatalf("undo = %+v", undo)
+	}
+	if got, _ := os.ReadFile(old); string(got) != "A" {
+		t.Errorf("restored %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(out, "2024")); !os.IsNotExist(err) {
+		t.Errorf("emptied directory left behind: %v", err)
+	}
+	if again := Undo(logPath, false); len(again.Renamed) != 0 || len(again.Errors) != 0 {
+		t.Errorf("second undo = %+v", again)
+	}
+}
+
+func TestUndoLogName(t *testing.T) {
+	t0 := time.Date(2024, 1, 15, 11, 30, 45, 0, time.UTC)
+	a, b := UndoLogName(t0), UndoLogName(t0.Add(time.Millisecond))
+	if a == b {
+		t.Errorf("migrations a millisecond apart share the undo log %s", a)
+	}
+	if a != ".sbr-migrate-20240115-113045.000000000.json" {
+		t.Errorf("UndoLogName = %s", a)
+	}
+}
@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// VerifyReport summarises how an output directory compares with the
+// attachments a backup file would produce.
+type VerifyReport struct {
+	// OK counts attachments whose output file exists with identical content.
+	OK int
+	// Missing lists output paths that do not exist.
+	Missing []string
+	// Mismatched lists output paths that exist but whose content differs from
+	// the attachment bytes in the backup.
+	Mismatched []string
+	// Errors lists attachments that could not be checked (undecodable base64,
+	// unreadable output file, ...).
+	Errors []error
+}
+
+// Clean reports whether every attachment was found intact.
+func (r *VerifyReport) Clean() bool {
+	return len(r.Missing) == 0 && len(r.Mismatched) == 0 && len(r.Errors) == 0
+}
+
+// Merge folds other into r. It is used to aggregate per-file reports into a
+// single report for a whole backup set.
+func (r *VerifyReport) Merge(other VerifyReport) {
+	r.OK += other.OK
+	r.Missing = append(r.Missing, other.Missing...)
+	r.Mismatched = append(r.Mismatched, other.Mismatched...)
+	r.Errors = append(r.Errors, other.Errors...)
+}
+
+// VerifyFile parses a backup file exactly as ProcessFile would and checks that
+// every attachment it would save is present in outPath with the same content.
+// Nothing is written. Files are compared byte for byte against the decoded
+// attachment, so a truncated or corrupted output file is reported as
+// mismatched rather than silently accepted on the strength of its name.
+func VerifyFile(r io.Reader, filePath, outPath string, opts Options) VerifyReport {
+	opts = withFile(opts, filePath)
+	opts.Logger.Debug("verifying file")
+
+	var report VerifyReport
+	planFile(r, filePath, outPath, opts, func(item workItem) {
+		oFile := filepath.Join(item.outPath, item.filename())
+
+		got, err := os.ReadFile(oFile)
+		if os.IsNotExist(err) {
+			report.Missing = append(report.Missing, oFile)
+			return
+		} else if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("reading %s: %w", oFile, err))
+			return
+		}
+
+		want, err := item.payload()
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("%s: %w", oFile, err))
+			return
+		}
+		if !bytes.Equal(got, want) {
+			report.Mismatched = append(report.Mismatched, oFile)
+			return
+		}
+		report.OK++
+	})
+	return report
+}
+
+// VerifyFileFromPath opens filePath and calls VerifyFile.
+func VerifyFileFromPath(filePath, outPath string, opts Options) VerifyReport {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return VerifyReport{Errors: []error{fmt.Errorf("opening file %s: %w", filePath, err)}}
+	}
+	defer file.Close()
+	return VerifyFile(file, filePath, outPath, opts)
+}
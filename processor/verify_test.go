@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ---------------------------------------------------------------------------
+// VerifyFile
+// ---------------------------------------------------------------------------
+
+func TestVerifyFile(t *testing.T) {
+	xmlDoc := `<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>
+<smses count="2">
+  <mms date="1705318245000" address="+1">
+    <parts>
+      <part seq="0" ct="image/jpeg" cl="a.jpg" text="null" data="` + mustEncode("aaa") + `"/>
+      <part seq="1" ct="image/png" cl="null" name="null" text="null" data="` + mustEncode("bbb") + `"/>
+    </parts>
+  </mms>
+  <mms date="1705318245000" address="+2">
+    <parts>
+      <part seq="0" ct="image/jpeg" cl="a.jpg" text="null" data="` + mustEncode("ccc") + `"/>
+    </parts>
+  </mms>
+</smses>`
+
+	extract := func(t *testing.T) string {
+		t.Helper()
+		dir := t.TempDir()
+		ProcessFile(strings.NewReader(xmlDoc), "test.xml", dir, Options{})
+		return dir
+	}
+
+	t.Run("freshly extracted directory verifies clean", func(t *testing.T) {
+		dir := extract(t)
+		report := VerifyFile(strings.NewReader(xmlDoc), "test.xml", dir, Options{})
+		if !report.Clean() || report.OK != 3 {
+			t.Errorf("report = %+v, want 3 ok and clean", report)
+		}
+	})
+
+	t.Run("deleted file is reported missing", func(t *testing.T) {
+		dir := extract(t)
+		victim := filepath.Join(dir, ts1Prefix+"-1.png")
+		if err := os.Remove(victim); err != nil {
+			t.Fatal(err)
+		}
+		report := VerifyFile(strings.NewReader(xmlDoc), "test.xml", dir, Options{})
+		if len(report.Missing) != 1 || report.Missing[0] != victim {
+			t.Errorf("Missing = %v, want [%s]", report.Missing, victim)
+		}
+		if report.OK != 2 {
+			t.Errorf("OK = %d, want 2", report.OK)
+		}
+	})
+
+	t.Run("corrupted file is reported mismatched", func(t *testing.T) {
+		dir := extract(t)
+		victim := filepath.Join(dir, ts1Prefix+"-"+hashOf(t, []byte("ccc"))+"-a.jpg")
+		if err := os.WriteFile(victim, []byte("truncated"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		report := VerifyFile(strings.NewReader(xmlDoc), "test.xml", dir, Options{})
+		if len(report.Mismatched) != 1 || report.Mismatched[0] != victim {
+			t.Errorf("Mismatched = %v, want [%s]", report.Mismatched, victim)
+		}
+		if report.Clean() {
+			t.Error("report should not be clean")
+		}
+	})
+
+	t.Run("verify writes nothing", func(t *testing.T) {
+		dir := t.TempDir()
+		report := VerifyFile(strings.NewReader(xmlDoc), "test.xml", dir, Options{})
+		if len(report.Missing) != 3 {
+			t.Errorf("Missing = %v, want 3 entries", report.Missing)
+		}
+		if names := readDir(t, dir); len(names) != 0 {
+			t.Errorf("verify created files: %v", names)
+		}
+	})
+}
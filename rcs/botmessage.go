@@ -0,0 +1,226 @@
+// Package rcs decodes the RCS business messaging ("chatbot") payloads that
+// Android stores as MMS parts of type application/vnd.gsma.botmessage.v1.0+json:
+// rich cards, card carousels and the suggested replies and actions attached to
+// them, as specified by GSMA RCC.07.
+package rcs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ContentType is the MIME type of a bot message part.
+const ContentType = "application/vnd.gsma.botmessage.v1.0+json"
+
+// BotMessage is a decoded bot message. At most one of Card and Carousel is
+// set; a message may also carry a chip list of Suggestions on its own.
+type BotMessage struct {
+	Message struct {
+		Card     *Card     `json:"generalPurposeCard,omitempty"`
+		Carousel *Carousel `json:"generalPurposeCardCarousel,omitempty"`
+	} `json:"message"`
+	// Suggestions are the chips shown below the message, outside any card.
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+}
+
+// Card is a standalone rich card.
+type Card struct {
+	Layout  CardLayout  `json:"layout"`
+	Content CardContent `json:"content"`
+}
+
+// CardLayout describes how a standalone card is drawn.
+type CardLayout struct {
+	CardOrientation string `json:"cardOrientation,omitempty"` // VERTICAL or HORIZONTAL
+	ImageAlignment  string `json:"imageAlignment,omitempty"`  // LEFT or RIGHT
+}
+
+// Carousel is a horizontally scrolling list of cards.
+type Carousel struct {
+	Layout struct {
+		CardWidth string `json:"cardWidth,omitempty"` // SMALL_WIDTH or MEDIUM_WIDTH
+	} `json:"layout"`
+	Content []CardContent `json:"content"`
+}
+
+// CardContent is what one card shows.
+type CardContent struct {
+	Media       *Media       `json:"media,omitempty"`
+	Title       string       `json:"title,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+}
+
+// Media is the image or video at the top of a card. The payload is not part of
+// the message: it is fetched from MediaURL, which may since have expired.
+type Media struct {
+	MediaURL             string `json:"mediaUrl"`
+	MediaContentType     string `json:"mediaContentType,omitempty"`
+	MediaFileSize        int64  `json:"mediaFileSize,omitempty"`
+	ThumbnailURL         string `json:"thumbnailUrl,omitempty"`
+	ThumbnailContentType string `json:"thumbnailContentType,omitempty"`
+	ThumbnailFileSize    int64  `json:"thumbnailFileSize,omitempty"`
+	Height               string `json:"height,omitempty"` // SHORT_HEIGHT, MEDIUM_HEIGHT or TALL_HEIGHT
+}
+
+// Suggestion is a suggested reply or action. Exactly one field is set.
+type Suggestion struct {
+	Reply  *Reply  `json:"reply,omitempty"`
+	Action *Action `json:"action,omitempty"`
+}
+
+// Postback is the opaque data returned to the bot when a suggestion is tapped.
+type Postback struct {
+	Data string `json:"data"`
+}
+
+// Reply is a suggested reply: tapping it sends DisplayText back to the bot.
+type Reply struct {
+	DisplayText string    `json:"displayText"`
+	Postback    *Postback `json:"postback,omitempty"`
+}
+
+// Action is a suggested action performed on the phone. One of the *Action
+// fields is set.
+type Action struct {
+	DisplayText    string          `json:"displayText"`
+	Postback       *Postback       `json:"postback,omitempty"`
+	URLAction      *URLAction      `json:"urlAction,omitempty"`
+	DialerAction   *DialerAction   `json:"dialerAction,omitempty"`
+	MapAction      *MapAction      `json:"mapAction,omitempty"`
+	CalendarAction *CalendarAction `json:"calendarAction,omitempty"`
+}
+
+// URLAction opens a web page.
+type URLAction struct {
+	OpenURL struct {
+		URL string `json:"url"`
+	} `json:"openUrl"`
+}
+
+// DialerAction places a call.
+type DialerAction struct {
+	DialPhoneNumber *struct {
+		PhoneNumber string `json:"phoneNumber"`
+	} `json:"dialPhoneNumber,omitempty"`
+}
+
+// MapAction shows a location.
+type MapAction struct {
+	ShowLocation *struct {
+		Location struct {
+			Latitude  float64 `json:"latitude"`
+			Longitude float64 `json:"longitude"`
+			Label     string  `json:"label,omitempty"`
+		} `json:"location"`
+		FallbackURL string `json:"fallbackUrl,omitempty"`
+	} `json:"showLocation,omitempty"`
+}
+
+// CalendarAction adds an event to the calendar.
+type CalendarAction struct {
+	CreateCalendarEvent *struct {
+		StartTime   string `json:"startTime"`
+		EndTime     string `json:"endTime"`
+		Title       string `json:"title"`
+		Description string `json:"description,omitempty"`
+	} `json:"createCalendarEvent,omitempty"`
+}
+
+// Parse decodes a bot message. Unknown fields are ignored so that newer
+// message kinds still yield whatever cards they contain.
+func Parse(data []byte) (*BotMessage, error) {
+	var m BotMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing bot message: %w", err)
+	}
+	return &m, nil
+}
+
+// Cards returns the message's cards in display order: the standalone card or
+// the carousel's cards.
+func (m *BotMessage) Cards() []CardContent {
+	switch {
+	case m.Message.Card != nil:
+		return []CardContent{m.Message.Card.Content}
+	case m.Message.Carousel != nil:
+		return m.Message.Carousel.Content
+	}
+	return nil
+}
+
+// Summary returns the titles and descriptions of the message's cards, one per
+// line, for use where only the text of a message is shown.
+func (m *BotMessage) Summary() string {
+	var lines []string
+	for _, c := range m.Cards() {
+		if c.Title != "" {
+			lines = append(lines, c.Title)
+		}
+		if c.Description != "" {
+			lines = append(lines, c.Description)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Label returns the text shown on the suggestion's chip.
+func (s Suggestion) Label() string {
+	switch {
+	case s.Reply != nil:
+		return s.Reply.DisplayText
+	case s.Action != nil:
+		return s.Action.DisplayText
+	}
+	return ""
+}
+
+// Target describes what tapping the suggestion does: a URL, a phone number, a
+// location, a calendar event, or "" for a plain reply.
+func (s Suggestion) Target() string {
+	a := s.Action
+	if a == nil {
+		return ""
+	}
+	switch {
+	case a.URLAction != nil:
+		return a.URLAction.OpenURL.URL
+	case a.DialerAction != nil && a.DialerAction.DialPhoneNumber != nil:
+		return "tel:" + a.DialerAction.DialPhoneNumber.PhoneNumber
+	case a.MapAction != nil && a.MapAction.ShowLocation != nil:
+		loc := a.MapAction.ShowLocation.Location
+		target := fmt.Sprintf("geo:%g,%g", loc.Latitude, loc.Longitude)
+		if loc.Label != "" {
+			target += " (" + loc.Label + ")"
+		}
+		return target
+	case a.CalendarAction != nil && a.CalendarAction.CreateCalendarEvent != nil:
+		ev := a.CalendarAction.CreateCalendarEvent
+		return fmt.Sprintf("calendar: %s, %s – %s", ev.Title, ev.StartTime, ev.EndTime)
+	}
+	return ""
+}
+
+// URL returns a link performing the suggestion's action where one exists: the
+// web page, a tel: or geo: URI, or the map action's fallback URL. It returns ""
+// for replies and calendar events.
+func (s Suggestion) URL() string {
+	a := s.Action
+	if a == nil {
+		return ""
+	}
+	switch {
+	case a.URLAction != nil:
+		return a.URLAction.OpenURL.URL
+	case a.DialerAction != nil && a.DialerAction.DialPhoneNumber != nil:
+		return "tel:" + a.DialerAction.DialPhoneNumber.PhoneNumber
+	case a.MapAction != nil && a.MapAction.ShowLocation != nil:
+		loc := a.MapAction.ShowLocation
+		if loc.FallbackURL != "" {
+			return loc.FallbackURL
+		}
+		return fmt.Sprintf("geo:%g,%g", loc.Location.Latitude, loc.Location.Longitude)
+	}
+	return ""
+}
@@ -0,0 +1,122 @@
+package rcs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const carouselJSON = `{"message":{"generalPurposeCardCarousel":{"layout":{"cardWidth":"MEDIUM_WIDTH"},"content":[
+{"media":{"mediaUrl":"https://example.com/pass.png","mediaContentType":"image/png","height":"MEDIUM_HEIGHT"},
+ "title":"Boarding pass","description":"Flight XY123 to LIS\nGate 12",
+ "suggestions":[{"action":{"displayText":"Open","urlAction":{"openUrl":{"url":"https://example.com/b"}}}},
+                {"reply":{"displayText":"Thanks","postback":{"data":"t"}}}]},
+{"title":"Seat 14C",
+ "suggestions":[{"action":{"displayText":"Call","dialerAction":{"dialPhoneNumber":{"phoneNumber":"+15550001111"}}}},
+                {"action":{"displayText":"Evil","urlAction":{"openUrl":{"url":"javascript:alert(1)"}}}}]}]}}}`
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(carouselJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cards := m.Cards()
+	if len(cards) != 2 {
+		t.Fatalf("got %d cards, want 2", len(cards))
+	}
+	if cards[0].Media == nil || cards[0].Media.MediaURL != "https://example.com/pass.png" {
+		t.Errorf("card 1 media = %+v", cards[0].Media)
+	}
+	if got := m.Summary(); got != "Boarding pass\nFlight XY123 to LIS\nGate 12\nSeat 14C" {
+		t.Errorf("Summary = %q", got)
+	}
+	if s := cards[1].Suggestions[0]; s.Label() != "Call" || s.Target() != "tel:+15550001111" {
+		t.Errorf("dialer suggestion = %q -> %q", s.Label(), s.Target())
+	}
+
+	single, err := Parse([]byte(`{"message":{"generalPurposeCard":{"layout":{"cardOrientation":"VERTICAL"},"content":{"title":"Parcel delivered"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := single.Summary(); got != "Parcel delivered" {
+		t.Errorf("single card Summary = %q", got)
+	}
+
+	if _, err = Parse([]byte(`{"message":`)); err == nil {
+		t.Error("Parse accepted truncated JSON")
+	}
+}
+
+func TestSuggestionTarget(t *testing.T) {
+	m, err := Parse([]byte(`{"suggestions":[
+{"action":{"displayText":"Map","mapAction":{"showLocation":{"location":{"latitude":38.7,"longitude":-9.1,"label":"Gate"}}}}},
+{"action":{"displayText":"Save","calendarAction":{"createCalendarEvent":{"startTime":"2024-01-01T10:00:00Z","endTime":"2024-01-01T11:00:00Z","title":"Flight"}}}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Suggestions[0].Target(); got != "geo:38.7,-9.1 (Gate)" {
+		t.Errorf("map Target = %q", got)
+	}
+	if got := m.Suggestions[0].URL(); got != "geo:38.7,-9.1" {
+		t.Errorf("map URL = %q", got)
+	}
+	if got := m.Suggestions[1].Target(); !strings.HasPrefix(got, "calendar: Flight") {
+		t.Errorf("calendar Target = %q", got)
+	}
+	if got := m.Suggestions[1].URL(); got != "" {
+		t.Errorf("calendar URL = %q, want none", got)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	m, err := Parse([]byte(carouselJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = WriteText(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	want := `Card 1 of 2
+Boarding pass
+Flight XY123 to LIS
+Gate 12
+Media: https://example.com/pass.png (image/png)
+[Open] https://example.com/b
+[Thanks]
+
+Card 2 of 2
+Seat 14C
+[Call] tel:+15550001111
+[Evil] javascript:alert(1)
+`
+	if buf.String() != want {
+		t.Errorf("WriteText =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	m, err := Parse([]byte(carouselJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = WriteHTML(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`<img src="https://example.com/pass.png"`,
+		`<h2>Boarding pass</h2>`,
+		`<a class="chip" href="https://example.com/b">Open</a>`,
+		`<a class="chip" href="tel:&#43;15550001111">Call</a>`,
+		`<span class="chip" title="">Thanks</span>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("HTML missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `href="javascript:`) {
+		t.Error("HTML contains a javascript: link")
+	}
+}
@@ -0,0 +1,100 @@
+package rcs
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// WriteText renders m as plain text: each card's title, description and media
+// URL, followed by its suggestions.
+func WriteText(w io.Writer, m *BotMessage) error {
+	var b strings.Builder
+	cards := m.Cards()
+	for i, c := range cards {
+		if len(cards) > 1 {
+			fmt.Fprintf(&b, "Card %d of %d\n", i+1, len(cards))
+		}
+		if c.Title != "" {
+			fmt.Fprintf(&b, "%s\n", c.Title)
+		}
+		if c.Description != "" {
+			fmt.Fprintf(&b, "%s\n", c.Description)
+		}
+		if c.Media != nil && c.Media.MediaURL != "" {
+			fmt.Fprintf(&b, "Media: %s", c.Media.MediaURL)
+			if c.Media.MediaContentType != "" {
+				fmt.Fprintf(&b, " (%s)", c.Media.MediaContentType)
+			}
+			b.WriteByte('\n')
+		}
+		writeSuggestions(&b, c.Suggestions)
+		b.WriteByte('\n')
+	}
+	writeSuggestions(&b, m.Suggestions)
+	_, err := io.WriteString(w, strings.TrimRight(b.String(), "\n")+"\n")
+	return err
+}
+
+func writeSuggestions(b *strings.Builder, suggestions []Suggestion) {
+	for _, s := range suggestions {
+		fmt.Fprintf(b, "[%s]", s.Label())
+		if t := s.Target(); t != "" {
+			fmt.Fprintf(b, " %s", t)
+		}
+		b.WriteByte('\n')
+	}
+}
+
+var htmlTemplate = template.Must(template.New("botmessage").Funcs(template.FuncMap{
+	"isImage": func(m *Media) bool { return strings.HasPrefix(m.MediaContentType, "image/") },
+	"isVideo": func(m *Media) bool { return strings.HasPrefix(m.MediaContentType, "video/") },
+	"safeURL": safeURL,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{with .Cards}}{{(index . 0).Title}}{{else}}Business message{{end}}</title>
+<style>
+body { font-family: system-ui, sans-serif; background: #f4f4f6; color: #222; margin: 2rem; }
+.cards { display: flex; gap: 1rem; overflow-x: auto; }
+.card { background: #fff; border-radius: 1rem; width: 18rem; flex: none; overflow: hidden; box-shadow: 0 1px 3px #0002; }
+.card img, .card video { width: 100%; display: block; }
+.card h2 { font-size: 1.05rem; margin: .8rem .8rem .3rem; }
+.card p { margin: 0 .8rem .8rem; white-space: pre-wrap; }
+.chips { margin: .6rem .8rem; display: flex; flex-wrap: wrap; gap: .4rem; }
+.chip { border: 1px solid #0b84ff; color: #0b84ff; border-radius: 1rem; padding: .2rem .7rem; font-size: .85rem; text-decoration: none; }
+</style>
+</head>
+<body>
+<div class="cards">
+{{range .Cards}}<div class="card">
+{{with .Media}}{{if isImage .}}<img src="{{safeURL .MediaURL}}" alt="">{{else if isVideo .}}<video controls src="{{safeURL .MediaURL}}"></video>{{else}}<p><a href="{{safeURL .MediaURL}}">{{.MediaURL}}</a></p>{{end}}
+{{end}}{{with .Title}}<h2>{{.}}</h2>
+{{end}}{{with .Description}}<p>{{.}}</p>
+{{end}}{{template "chips" .Suggestions}}</div>
+{{end}}</div>
+{{template "chips" .Suggestions}}</body>
+</html>
+{{define "chips"}}{{with .}}<div class="chips">{{range $s := .}}{{with safeURL $s.URL}}<a class="chip" href="{{.}}">{{$s.Label}}</a>{{else}}<span class="chip" title="{{$s.Target}}">{{$s.Label}}</span>{{end}}{{end}}</div>
+{{end}}{{end}}`))
+
+// WriteHTML renders m as a self-contained HTML page showing its cards side by
+// side, as a carousel is shown on the phone. Media are linked from their
+// original URLs, which bots only keep alive for a limited time.
+func WriteHTML(w io.Writer, m *BotMessage) error {
+	return htmlTemplate.Execute(w, m)
+}
+
+// safeURL passes through http(s), tel and geo links and drops anything else
+// (notably javascript:), since the URLs come from a third party.
+func safeURL(s string) template.URL {
+	lower := strings.ToLower(s)
+	for _, scheme := range []string{"http://", "https://", "tel:", "geo:"} {
+		if strings.HasPrefix(lower, scheme) {
+			return template.URL(s)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,269 @@
+// Package s3 stores sbr's output in an S3-compatible object store, such as
+// Amazon S3 or MinIO. It speaks the small part of the S3 REST API it needs
+// over net/http, signing requests with AWS Signature Version 4.
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRegion is the signing region used when Config.Region is empty.
+	DefaultRegion = "us-east-1"
+	// DefaultPartSize is the multipart part size used when Config.PartSize is
+	// zero. Objects larger than the part size are uploaded in parts.
+	DefaultPartSize = 16 << 20
+	// MinPartSize is the smallest part S3 accepts but for an upload's last.
+	MinPartSize = 5 << 20
+)
+
+// Config configures a Client.
+type Config struct {
+	// Endpoint is the service's base URL, such as https://s3.amazonaws.com
+	// or http://localhost:9000 for a local MinIO.
+	Endpoint string
+	// Region is the signing region; empty means DefaultRegion.
+	Region string
+	Bucket string
+	// AccessKey and SecretKey are the credentials requests are signed with.
+	AccessKey string
+	SecretKey string
+	// HTTPClient sends the requests; nil means http.DefaultClient.
+	HTTPClient *http.Client
+	// PartSize is the multipart part size in bytes; zero means
+	// DefaultPartSize. It must be at least MinPartSize.
+	PartSize int
+}
+
+// Client is a client of one bucket. Objects are addressed path-style, as
+// <endpoint>/<bucket>/<key>, which every S3-compatible store accepts.
+type Client struct {
+	base     *url.URL
+	bucket   string
+	signer   signer
+	http     *http.Client
+	partSize int
+	// now is the clock requests are signed with.
+	now func() time.Time
+}
+
+// New returns a Client for cfg.
+func New(cfg Config) (*Client, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3: no bucket")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("s3: no credentials")
+	}
+	base, err := url.Parse(cfg.Endpoint)
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("s3: invalid endpoint %q", cfg.Endpoint)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	c := &Client{
+		base:     base,
+		bucket:   cfg.Bucket,
+		signer:   signer{accessKey: cfg.AccessKey, secretKey: cfg.SecretKey, region: cfg.Region},
+		http:     cfg.HTTPClient,
+		partSize: cfg.PartSize,
+		now:      time.Now,
+	}
+	if c.signer.region == "" {
+		c.signer.region = DefaultRegion
+	}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	if c.partSize == 0 {
+		c.partSize = DefaultPartSize
+	}
+	if c.partSize < MinPartSize {
+		return nil, fmt.Errorf("s3: part size %d is below the minimum of %d", c.partSize, MinPartSize)
+	}
+	return c, nil
+}
+
+// Error is an error response from the service.
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: %s", http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+// responseError returns the Error of an unsuccessful response with body.
+func responseError(status int, body []byte) error {
+	e := &Error{StatusCode: status}
+	_ = xml.Unmarshal(body, e)
+	return e
+}
+
+// do sends a signed request for key, which is "" for the bucket itself, and
+// returns the response and its body. Responses other than 2xx are errors,
+// but for a HEAD's 404, which the caller checks.
+func (c *Client) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, []byte, error) {
+	u := *c.base
+	u.Path += "/" + c.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+	payloadHash := emptyHash
+	if len(body) > 0 {
+		payloadHash = hashHex(body)
+	}
+	c.signer.sign(req, payloadHash, c.now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("s3: reading response: %w", err)
+	}
+	if resp.StatusCode/100 != 2 && !(method == http.MethodHead && resp.StatusCode == http.StatusNotFound) {
+		return nil, nil, responseError(resp.StatusCode, data)
+	}
+	return resp, data, nil
+}
+
+// Head reports whether the object key exists.
+func (c *Client) Head(key string) (bool, error) {
+	resp, _, err := c.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	return resp.StatusCode != http.StatusNotFound, nil
+}
+
+// Put stores data as the object key with the request headers header, such
+// as Content-Type and x-amz-meta-* metadata. Data larger than the part size
+// is uploaded in parts.
+func (c *Client) Put(key string, data []byte, header http.Header) error {
+	if len(data) > c.partSize {
+		return c.putMultipart(key, data, header)
+	}
+	_, _, err := c.do(http.MethodPut, key, nil, header, data)
+	return err
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+// putMultipart uploads data in parts, aborting the upload if any step fails
+// so that the store does not keep the parts.
+func (c *Client) putMultipart(key string, data []byte, header http.Header) error {
+	_, body, err := c.do(http.MethodPost, key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(body, &initiated); err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("s3: starting multipart upload of %s: no upload ID", key)
+	}
+	id := initiated.UploadID
+
+	if err := c.uploadParts(key, id, data); err != nil {
+		_, _, _ = c.do(http.MethodDelete, key, url.Values{"uploadId": {id}}, nil, nil)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) uploadParts(key, id string, data []byte) error {
+	var done completeMultipartUpload
+	for n := 1; len(data) > 0; n++ {
+		size := min(c.partSize, len(data))
+		query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {id}}
+		resp, _, err := c.do(http.MethodPut, key, query, nil, data[:size])
+		if err != nil {
+			return err
+		}
+		done.Parts = append(done.Parts, completedPart{PartNumber: n, ETag: resp.Header.Get("ETag")})
+		data = data[size:]
+	}
+	complete, err := xml.Marshal(done)
+	if err != nil {
+		return err
+	}
+	_, body, err := c.do(http.MethodPost, key, url.Values{"uploadId": {id}}, nil, complete)
+	if err != nil {
+		return err
+	}
+	// Completion can fail after the 200 status is sent, in which case the
+	// body is an error document.
+	var root struct{ XMLName xml.Name }
+	if xml.Unmarshal(body, &root) == nil && root.XMLName.Local == "Error" {
+		return responseError(http.StatusOK, body)
+	}
+	return nil
+}
+
+// List returns the keys of the objects whose keys begin with prefix, in the
+// store's order, which is sorted.
+func (c *Client) List(prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		_, body, err := c.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("s3: listing %s: %w", prefix, err)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, obj.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
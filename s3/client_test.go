@@ -0,0 +1,351 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/junkblocker/sbr/processor"
+)
+
+const (
+	testAccessKey = "AKIDTEST"
+	testSecretKey = "secret"
+)
+
+// fakeObject is an object stored by fakeS3.
+type fakeObject struct {
+	data   []byte
+	header http.Header
+}
+
+// fakeS3 is an in-process S3 of one bucket. It checks every request's
+// signature and supports what Client uses.
+type fakeS3 struct {
+	bucket  string
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	// uploads maps an upload ID to its headers and parts.
+	uploads map[string]*fakeUpload
+	nextID  int
+	// pageSize limits the keys of a list response.
+	pageSize int
+	// requests counts requests by method.
+	requests map[string]int
+}
+
+type fakeUpload struct {
+	header http.Header
+	parts  map[int][]byte
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *Client) {
+	f := &fakeS3{
+		bucket:   "media",
+		objects:  make(map[string]fakeObject),
+		uploads:  make(map[string]*fakeUpload),
+		pageSize: 1000,
+		requests: make(map[string]int),
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	c, err := New(Config{Endpoint: srv.URL, Bucket: f.bucket, AccessKey: testAccessKey, SecretKey: testSecretKey, PartSize: MinPartSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, c
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+// verify checks the signature of r, rebuilding the request from the headers
+// it claims to sign.
+func (f *fakeS3) verify(r *http.Request, body []byte) bool {
+	auth := r.Header.Get("Authorization")
+	i := strings.Index(auth, "SignedHeaders=")
+	j := strings.Index(auth, ", Signature=")
+	if i < 0 || j < i {
+		return false
+	}
+	now, err := time.Parse(amzDate, r.Header.Get("X-Amz-Date"))
+	if err != nil || hashHex(body) != r.Header.Get("X-Amz-Content-Sha256") {
+		return false
+	}
+	req := &http.Request{Method: r.Method, URL: r.URL, Host: r.Host, Header: make(http.Header)}
+	for _, name := range strings.Split(auth[i+len("SignedHeaders="):j], ";") {
+		if name != "host" {
+			req.Header[http.CanonicalHeaderKey(name)] = r.Header.Values(name)
+		}
+	}
+	s := signer{accessKey: testAccessKey, secretKey: testSecretKey, region: DefaultRegion}
+	_, sig := s.signature(req, hashHex(body), now)
+	return auth[j+len(", Signature="):] == sig
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !f.verify(r, body) {
+		f.error(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		f.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	q := r.URL.Query()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[r.Method]++
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, q)
+	case r.Method == http.MethodHead:
+		if _, ok := f.objects[key]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodGet:
+		obj, ok := f.objects[key]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		for name, values := range obj.header {
+			w.Header()[name] = values
+		}
+		w.Write(obj.data)
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		up, ok := f.uploads[q.Get("uploadId")]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var n int
+		fmt.Sscan(q.Get("partNumber"), &n)
+		up.parts[n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"%d-%s"`, n, hashHex(body)[:8]))
+	case r.Method == http.MethodPut:
+		f.objects[key] = fakeObject{data: body, header: objectHeader(r.Header)}
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.nextID++
+		id := fmt.Sprint("upload", f.nextID)
+		f.uploads[id] = &fakeUpload{header: objectHeader(r.Header), parts: make(map[int][]byte)}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		up, ok := f.uploads[q.Get("uploadId")]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var done completeMultipartUpload
+		if err := xml.Unmarshal(body, &done); err != nil {
+			f.error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var data []byte
+		for i, p := range done.Parts {
+			part, ok := up.parts[p.PartNumber]
+			if !ok || p.PartNumber != i+1 || !strings.Contains(p.ETag, hashHex(part)[:8]) {
+				f.error(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			if i < len(done.Parts)-1 && len(part) < MinPartSize {
+				f.error(w, http.StatusBadRequest, "EntityTooSmall")
+				return
+			}
+			data = append(data, part...)
+		}
+		delete(f.uploads, q.Get("uploadId"))
+		f.objects[key] = fakeObject{data: data, header: up.header}
+		fmt.Fprint(w, "<CompleteMultipartUploadResult/>")
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		delete(f.uploads, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// list answers a ListObjectsV2 request, continuing after the token's key.
+func (f *fakeS3) list(w http.ResponseWriter, q url.Values) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, q.Get("prefix")) && key > q.Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	fmt.Fprint(w, "<ListBucketResult>")
+	if len(keys) > f.pageSize {
+		keys = keys[:f.pageSize]
+		fmt.Fprintf(w, "<IsTruncated>true</IsTruncated><NextContinuationToken>%s</NextContinuationToken>", keys[len(keys)-1])
+	}
+	for _, key := range keys {
+		fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", key)
+	}
+	fmt.Fprint(w, "</ListBucketResult>")
+}
+
+// objectHeader returns the headers of a request that S3 stores with the
+// object.
+func objectHeader(h http.Header) http.Header {
+	kept := make(http.Header)
+	for name, values := range h {
+		if name == "Content-Type" || strings.HasPrefix(name, "X-Amz-Meta-") {
+			kept[name] = values
+		}
+	}
+	return kept
+}
+
+func TestNew(t *testing.T) {
+	good := Config{Endpoint: "http://localhost:9000", Bucket: "b", AccessKey: "a", SecretKey: "s"}
+	if _, err := New(good); err != nil {
+		t.Errorf("New(%+v) = %v", good, err)
+	}
+	for _, mod := range []func(*Config){
+		func(c *Config) { c.Bucket = "" },
+		func(c *Config) { c.SecretKey = "" },
+		func(c *Config) { c.Endpoint = "localhost:9000" },
+		func(c *Config) { c.PartSize = 1 << 20 },
+	} {
+		cfg := good
+		mod(&cfg)
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) succeeded", cfg)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	f, c := newFakeS3(t)
+	key := "2024/01/a b+c ü.jpg"
+	if ok, err := c.Head(key); ok || err != nil {
+		t.Errorf("Head before Put = %v, %v", ok, err)
+	}
+	if err := c.Put(key, []byte("A"), http.Header{"Content-Type": {"image/jpeg"}}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.Head(key); !ok || err != nil {
+		t.Errorf("Head after Put = %v, %v", ok, err)
+	}
+	if got := f.objects[key]; string(got.data) != "A" || got.header.Get("Content-Type") != "image/jpeg" {
+		t.Errorf("stored %q with %v", got.data, got.header)
+	}
+
+	c.signer.secretKey = "wrong"
+	_, err := c.Head(key)
+	if err == nil {
+		t.Fatal("a bad signature is not an error")
+	}
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusForbidden {
+		t.Errorf("err = %#v", err)
+	}
+}
+
+func TestClient_Multipart(t *testing.T) {
+	f, c := newFakeS3(t)
+	data := []byte(strings.Repeat("0123456789", MinPartSize/10*2+1))
+	if err := c.Put("video.mp4", data, http.Header{MetaSender: {"+1"}}); err != nil {
+		t.Fatal(err)
+	}
+	got := f.objects["video.mp4"]
+	if string(got.data) != string(data) || got.header.Get(MetaSender) != "+1" {
+		t.Errorf("stored %d bytes with %v, want %d", len(got.data), got.header, len(data))
+	}
+	if f.requests[http.MethodPut] != 3 {
+		t.Errorf("%d parts uploaded, want 3", f.requests[http.MethodPut])
+	}
+	if len(f.uploads) != 0 {
+		t.Errorf("%d uploads left open", len(f.uploads))
+	}
+}
+
+func TestClient_MultipartAbort(t *testing.T) {
+	f, c := newFakeS3(t)
+	// A part size below S3's minimum makes completion fail.
+	c.partSize = 1 << 20
+	if err := c.Put("video.mp4", make([]byte, 3<<20), nil); err == nil {
+		t.Fatal("a rejected upload is not an error")
+	}
+	if len(f.uploads) != 0 || f.requests[http.MethodDelete] != 1 {
+		t.Errorf("the upload was not aborted: %d open, %d deletes", len(f.uploads), f.requests[http.MethodDelete])
+	}
+	if _, ok := f.objects["video.mp4"]; ok {
+		t.Error("the object was stored")
+	}
+}
+
+func TestClient_List(t *testing.T) {
+	f, c := newFakeS3(t)
+	f.pageSize = 2
+	for _, key := range []string{"p/c", "p/a", "q/x", "p/b", "p/d/e"} {
+		if err := c.Put(key, []byte(key), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys, err := c.List("p/")
+	if err != nil || strings.Join(keys, " ") != "p/a p/b p/c p/d/e" {
+		t.Errorf("List = %q, %v", keys, err)
+	}
+}
+
+func TestSink(t *testing.T) {
+	f, c := newFakeS3(t)
+	s := NewSink(c, "backup/")
+	doc := `<smses>
+  <mms date="1705318245000" msg_box="1" address="+15551234567"><parts>
+    <part seq="0" ct="Image/JPEG" cl="a.jpg" data="QQ=="/>
+  </parts></mms>
+</smses>`
+	opts := processor.Options{Sink: s, Location: time.UTC, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	processor.ProcessFile(strings.NewReader(doc), "sms-1.xml", t.TempDir(), opts)
+
+	names, err := s.List()
+	if err != nil || strings.Join(names, " ") != "2024-01-15-113045-a.jpg" {
+		t.Fatalf("List = %q, %v", names, err)
+	}
+	obj := f.objects["backup/2024-01-15-113045-a.jpg"]
+	want := http.Header{
+		"Content-Type": {"image/jpeg"},
+		MetaTime:       {"2024-01-15T11:30:45.000Z"},
+		MetaSender:     {"+15551234567"},
+	}
+	for name := range want {
+		if obj.header.Get(name) != want.Get(name) {
+			t.Errorf("%s = %q, want %q", name, obj.header.Get(name), want.Get(name))
+		}
+	}
+	if obj.header.Get(MetaSent) != "" {
+		t.Errorf("a received message is marked sent")
+	}
+
+	// A second run finds the object and uploads nothing.
+	puts := f.requests[http.MethodPut]
+	processor.ProcessFile(strings.NewReader(doc), "sms-1.xml", t.TempDir(), opts)
+	if f.requests[http.MethodPut] != puts {
+		t.Error("an existing object was uploaded again")
+	}
+}
+
+func TestHeaderValue(t *testing.T) {
+	if got := headerValue("+1 555"); got != "+1 555" {
+		t.Errorf("headerValue(ascii) = %q", got)
+	}
+	if got := headerValue("Zoë"); got != "=?utf-8?q?Zo=C3=AB?=" {
+		t.Errorf("headerValue(Zoë) = %q", got)
+	}
+}
@@ -0,0 +1,130 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Signature Version 4 constants.
+const (
+	sigAlgorithm = "AWS4-HMAC-SHA256"
+	sigService   = "s3"
+	amzDate      = "20060102T150405Z"
+	// emptyHash is the SHA-256 of an empty payload.
+	emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// signer signs requests with AWS Signature Version 4.
+type signer struct {
+	accessKey, secretKey, region string
+}
+
+// sign adds the x-amz-date, x-amz-content-sha256 and Authorization headers
+// to req, whose payload has the hex SHA-256 payloadHash, signing the host and
+// every header already set.
+func (s signer) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(amzDate))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signed, sig := s.signature(req, payloadHash, now)
+	req.Header.Set("Authorization", sigAlgorithm+
+		" Credential="+s.accessKey+"/"+s.scope(now)+
+		", SignedHeaders="+signed+
+		", Signature="+sig)
+}
+
+// scope returns the credential scope of a request made at now.
+func (s signer) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/" + sigService + "/aws4_request"
+}
+
+// signature returns the signed header list and the signature of req.
+func (s signer) signature(req *http.Request, payloadHash string, now time.Time) (signed, sig string) {
+	headers := map[string]string{"host": req.Host}
+	if req.Host == "" {
+		headers["host"] = req.URL.Host
+	}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "authorization" {
+			continue
+		}
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[name] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canon strings.Builder
+	canon.WriteString(req.Method + "\n")
+	canon.WriteString(uriEncode(req.URL.Path, false) + "\n")
+	canon.WriteString(canonicalQuery(req) + "\n")
+	for _, name := range names {
+		canon.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed = strings.Join(names, ";")
+	canon.WriteString("\n" + signed + "\n" + payloadHash)
+
+	toSign := sigAlgorithm + "\n" + now.Format(amzDate) + "\n" + s.scope(now) + "\n" + hashHex([]byte(canon.String()))
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, sigService)
+	key = hmacSHA256(key, "aws4_request")
+	return signed, hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+// canonicalQuery returns the query of req with its parameters sorted and
+// encoded as the signature requires.
+func canonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, v := range values {
+			params = append(params, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// uriEncode percent-encodes every byte of s but the unreserved characters,
+// and '/' unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,95 @@
+package s3
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/junkblocker/sbr/processor"
+)
+
+// Metadata headers PutMeta sets on each object. S3 returns them with the
+// object, and as x-amz-meta-* headers they survive copies within the store.
+const (
+	// MetaTime holds the message timestamp in RFC 3339 form, with
+	// milliseconds.
+	MetaTime = "X-Amz-Meta-Sbr-Time"
+	// MetaSender holds the raw address the message came from, and MetaSent
+	// "true" when the backup owner sent it.
+	MetaSender = "X-Amz-Meta-Sbr-Sender"
+	MetaSent   = "X-Amz-Meta-Sbr-Sent"
+)
+
+// Sink is a processor.MetaSink storing each file as the object <prefix><name>
+// of a bucket.
+type Sink struct {
+	client *Client
+	prefix string
+}
+
+// NewSink returns a Sink writing through c under prefix, which normally ends
+// in '/'; an empty prefix stores files at the bucket's top level.
+func NewSink(c *Client, prefix string) *Sink {
+	return &Sink{client: c, prefix: prefix}
+}
+
+var _ processor.MetaSink = (*Sink)(nil)
+
+// Exists reports whether the object of name exists.
+func (s *Sink) Exists(name string) (bool, error) {
+	return s.client.Head(s.prefix + name)
+}
+
+// Put stores data as name, recording mtime as its message time.
+func (s *Sink) Put(name string, data []byte, mtime time.Time) error {
+	return s.PutMeta(name, data, processor.FileMeta{Time: mtime})
+}
+
+// PutMeta stores data as name with meta as its content type and metadata.
+func (s *Sink) PutMeta(name string, data []byte, meta processor.FileMeta) error {
+	header := make(http.Header)
+	if meta.ContentType != "" {
+		header.Set("Content-Type", meta.ContentType)
+	}
+	if !meta.Time.IsZero() {
+		header.Set(MetaTime, meta.Time.Format("2006-01-02T15:04:05.000Z07:00"))
+	}
+	if meta.Sender != "" {
+		header.Set(MetaSender, headerValue(meta.Sender))
+	}
+	if meta.Sent {
+		header.Set(MetaSent, strconv.FormatBool(meta.Sent))
+	}
+	return s.client.Put(s.prefix+name, data, header)
+}
+
+// List returns the names stored under the prefix, sorted.
+func (s *Sink) List() ([]string, error) {
+	keys, err := s.client.List(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, strings.TrimPrefix(key, s.prefix))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// headerValue returns v fit for a metadata header, which S3 restricts to
+// printable ASCII: anything else is RFC 2047 encoded, as S3 itself does.
+func headerValue(v string) string {
+	ascii := utf8.ValidString(v)
+	for i := 0; ascii && i < len(v); i++ {
+		ascii = v[i] >= ' ' && v[i] <= '~'
+	}
+	if ascii {
+		return v
+	}
+	return mime.QEncoding.Encode("utf-8", strings.ToValidUTF8(v, "�"))
+}
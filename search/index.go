@@ -0,0 +1,273 @@
+// Package search finds messages by their text. Build streams backups into an
+// Index of every SMS body and MMS text (optionally shared contact cards and
+// RCS bot messages too), keyed by an inverted word index; Search matches
+// terms, phrases or a regular expression against it, filtered by date and
+// contact. An Index can be saved to disk and reloaded so repeated queries do
+// not rescan the backups.
+package search
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/contact"
+	"github.com/junkblocker/sbr/thread"
+)
+
+// Options choose which text, besides SMS bodies and MMS text parts, is
+// searchable.
+type Options struct {
+	// VCards includes the names, numbers, addresses and notes of shared
+	// contact cards.
+	VCards bool
+	// BotMessages includes the card titles and descriptions of RCS business
+	// messages.
+	BotMessages bool
+}
+
+// Doc is one message in an Index.
+type Doc struct {
+	Source string
+	Offset int64
+	Time   time.Time
+	Kind   backup.Kind
+	// Sender labels who sent the message: "Me", a contact label or
+	// "(Unknown)".
+	Sender string
+	// Thread is the index of the message's thread in Index.Threads, and Pos
+	// its position within that thread.
+	Thread, Pos int
+	Text        string
+	// Attachments names the message's non-text parts.
+	Attachments []string
+}
+
+// Thread is one conversation in an Index.
+type Thread struct {
+	Title string
+	// Contacts are the participants' labels and addresses, matched by
+	// Query.Contact.
+	Contacts []string
+	// Docs are the thread's messages in chronological order, as indices into
+	// Index.Docs.
+	Docs []int
+}
+
+// FileStamp identifies the version of a backup file an Index was built from.
+type FileStamp struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Index holds the searchable text of a set of backups.
+type Index struct {
+	Options Options
+	Files   []FileStamp
+	Threads []Thread
+	Docs    []Doc
+
+	// postings maps each lowercased word to the sorted indices of the docs
+	// containing it; vocab is its keys, sorted, for prefix lookups.
+	postings map[string][]int
+	vocab    []string
+}
+
+// Build scans the backup files at paths and indexes their messages. r
+// resolves participants; it may be nil.
+func Build(paths []string, r *contact.Resolver, opts Options) (*Index, error) {
+	type location struct {
+		source string
+		offset int64
+	}
+	ix := &Index{Options: opts}
+	b := thread.NewBuilder(r)
+	texts := make(map[location]string)
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		ix.Files = append(ix.Files, FileStamp{path, fi.Size(), fi.ModTime()})
+		err = backup.ScanFile(path, func(rec backup.Record) {
+			b.Add(rec)
+			if text := recordText(rec, opts); text != "" {
+				texts[location{rec.Source, rec.Offset}] = text
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("decoding file %s: %w", path, err)
+		}
+	}
+
+	for ti, t := range b.Threads() {
+		it := Thread{Title: t.Title()}
+		for _, p := range t.Participants {
+			it.Contacts = append(it.Contacts, p.Label())
+			for _, a := range p.Addresses {
+				it.Contacts = append(it.Contacts, string(a))
+			}
+		}
+		for pos, m := range t.Messages {
+			d := Doc{
+				Source: m.Source,
+				Offset: m.Offset,
+				Time:   m.Time,
+				Kind:   m.Kind,
+				Sender: senderLabel(m),
+				Thread: ti,
+				Pos:    pos,
+				Text:   texts[location{m.Source, m.Offset}],
+			}
+			for _, p := range m.Parts {
+				name := p.Name
+				if name == "" {
+					name = p.ContentType
+				}
+				d.Attachments = append(d.Attachments, name)
+			}
+			it.Docs = append(it.Docs, len(ix.Docs))
+			ix.Docs = append(ix.Docs, d)
+		}
+		ix.Threads = append(ix.Threads, it)
+	}
+	ix.buildPostings()
+	return ix, nil
+}
+
+func senderLabel(m *thread.Message) string {
+	switch {
+	case m.Direction == thread.Sent:
+		return "Me"
+	case m.Sender != nil:
+		return m.Sender.Label()
+	}
+	return "(Unknown)"
+}
+
+func (ix *Index) buildPostings() {
+	ix.postings = make(map[string][]int)
+	for i, d := range ix.Docs {
+		for _, w := range words(d.Text) {
+			// Docs are visited in order, so a repeated word can only
+			// repeat the last entry.
+			if p := ix.postings[w]; len(p) == 0 || p[len(p)-1] != i {
+				ix.postings[w] = append(p, i)
+			}
+		}
+	}
+	ix.buildVocab()
+}
+
+func (ix *Index) buildVocab() {
+	ix.vocab = make([]string, 0, len(ix.postings))
+	for w := range ix.postings {
+		ix.vocab = append(ix.vocab, w)
+	}
+	sort.Strings(ix.vocab)
+}
+
+// words splits text into lowercased runs of letters and digits.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Current reports whether ix was built from exactly the files at paths, in
+// their present state, with opts.
+func (ix *Index) Current(paths []string, opts Options) bool {
+	if ix.Options != opts || len(ix.Files) != len(paths) {
+		return false
+	}
+	for i, path := range paths {
+		fi, err := os.Stat(path)
+		f := ix.Files[i]
+		if err != nil || f.Path != path || f.Size != fi.Size() || !f.ModTime.Equal(fi.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexVersion is bumped whenever the saved format changes; Load rejects
+// files of any other version.
+const indexVersion = 1
+
+// indexFile is the on-disk form of an Index: gob, gzip-compressed.
+type indexFile struct {
+	Version  int
+	Options  Options
+	Files    []FileStamp
+	Threads  []Thread
+	Docs     []Doc
+	Postings map[string][]int
+}
+
+// Save writes ix to path atomically.
+func (ix *Index) Save(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".sbr-*.tmp")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(tmp)
+	err = gob.NewEncoder(zw).Encode(indexFile{
+		Version:  indexVersion,
+		Options:  ix.Options,
+		Files:    ix.Files,
+		Threads:  ix.Threads,
+		Docs:     ix.Docs,
+		Postings: ix.postings,
+	})
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("writing index %s: %w", path, err)
+	}
+	return nil
+}
+
+// Load reads an index written by Save.
+func Load(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading index %s: %w", path, err)
+	}
+	var file indexFile
+	if err = gob.NewDecoder(zr).Decode(&file); err != nil {
+		return nil, fmt.Errorf("reading index %s: %w", path, err)
+	}
+	if file.Version != indexVersion {
+		return nil, fmt.Errorf("index %s has version %d, want %d", path, file.Version, indexVersion)
+	}
+	ix := &Index{
+		Options:  file.Options,
+		Files:    file.Files,
+		Threads:  file.Threads,
+		Docs:     file.Docs,
+		postings: file.Postings,
+	}
+	ix.buildVocab()
+	return ix, nil
+}
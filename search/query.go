@@ -0,0 +1,202 @@
+package search
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Query selects messages. A message matches when its text contains every
+// term and phrase and matches Regexp, and it passes every filter. A Query
+// with no terms, phrases or Regexp matches every message that passes the
+// filters.
+type Query struct {
+	// Terms must each appear as a word or the start of a word,
+	// case-insensitively: "addr" matches "Address" but not "mailaddress".
+	Terms []string
+	// Phrases must each appear as consecutive words, case-insensitively,
+	// whatever the punctuation or spacing between them.
+	Phrases []string
+	// Regexp, if non-nil, must match the message text.
+	Regexp *regexp.Regexp
+	// Since and Until bound the message time; a zero value leaves that side
+	// open. Until is exclusive.
+	Since, Until time.Time
+	// Contact, if not empty, restricts the search to conversations with a
+	// participant whose label or address contains it, case-insensitively.
+	// For phone numbers only the digits are compared.
+	Contact string
+}
+
+// ParseQuery splits s into terms and "double-quoted phrases". A bare word
+// that contains punctuation between letters, such as "o'brien", is treated as
+// a phrase.
+func ParseQuery(s string) Query {
+	var q Query
+	for {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return q
+		}
+		if s[0] == '"' {
+			phrase, rest, _ := strings.Cut(s[1:], `"`)
+			if len(words(phrase)) > 0 {
+				q.Phrases = append(q.Phrases, phrase)
+			}
+			s = rest
+			continue
+		}
+		end := strings.IndexFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+		if end < 0 {
+			end = len(s)
+		}
+		switch ws := words(s[:end]); len(ws) {
+		case 0:
+		case 1:
+			q.Terms = append(q.Terms, ws[0])
+		default:
+			q.Phrases = append(q.Phrases, s[:end])
+		}
+		s = s[end:]
+	}
+}
+
+// Match is one message found by Search.
+type Match struct {
+	// Doc is the message's index in Index.Docs.
+	Doc int
+	// Spans are the byte ranges of the doc's text that matched, in order.
+	// They are empty for a query without terms, phrases or Regexp.
+	Spans [][2]int
+}
+
+// Search returns the messages matching q, oldest first.
+func (ix *Index) Search(q Query) []Match {
+	var patterns []*regexp.Regexp
+	var lookups []string
+	for _, t := range q.Terms {
+		patterns = append(patterns, wordsPattern(words(t)))
+		lookups = append(lookups, words(t)...)
+	}
+	for _, p := range q.Phrases {
+		patterns = append(patterns, wordsPattern(words(p)))
+		lookups = append(lookups, words(p)...)
+	}
+	if q.Regexp != nil {
+		patterns = append(patterns, q.Regexp)
+	}
+
+	threadOK := make([]bool, len(ix.Threads))
+	for i, t := range ix.Threads {
+		threadOK[i] = q.Contact == "" || matchContact(t.Contacts, q.Contact)
+	}
+
+	var matches []Match
+	for _, i := range ix.candidates(lookups) {
+		d := ix.Docs[i]
+		if !threadOK[d.Thread] || !q.Since.IsZero() && d.Time.Before(q.Since) || !q.Until.IsZero() && !d.Time.Before(q.Until) {
+			continue
+		}
+		m := Match{Doc: i}
+		ok := true
+		for _, re := range patterns {
+			spans := re.FindAllStringSubmatchIndex(d.Text, -1)
+			if len(spans) == 0 {
+				ok = false
+				break
+			}
+			for _, s := range spans {
+				// Word patterns capture the words without the boundary
+				// before them; a user regexp's whole match is the span.
+				if len(s) >= 4 && s[2] >= 0 && re != q.Regexp {
+					m.Spans = append(m.Spans, [2]int{s[2], s[3]})
+				} else {
+					m.Spans = append(m.Spans, [2]int{s[0], s[1]})
+				}
+			}
+		}
+		if !ok {
+			continue
+		}
+		sort.Slice(m.Spans, func(a, b int) bool { return m.Spans[a][0] < m.Spans[b][0] })
+		matches = append(matches, m)
+	}
+	sort.SliceStable(matches, func(a, b int) bool {
+		return ix.Docs[matches[a].Doc].Time.Before(ix.Docs[matches[b].Doc].Time)
+	})
+	return matches
+}
+
+// candidates returns the docs that contain a word starting with each of ws,
+// or every doc if ws is empty. It only narrows the search: the patterns
+// decide whether a doc matches.
+func (ix *Index) candidates(ws []string) []int {
+	if len(ws) == 0 {
+		all := make([]int, len(ix.Docs))
+		for i := range all {
+			all[i] = i
+		}
+		return all
+	}
+	var result []int
+	for n, w := range ws {
+		set := make(map[int]bool)
+		for i := sort.SearchStrings(ix.vocab, w); i < len(ix.vocab) && strings.HasPrefix(ix.vocab[i], w); i++ {
+			for _, d := range ix.postings[ix.vocab[i]] {
+				set[d] = true
+			}
+		}
+		if n == 0 {
+			for d := range set {
+				result = append(result, d)
+			}
+			continue
+		}
+		kept := result[:0]
+		for _, d := range result {
+			if set[d] {
+				kept = append(kept, d)
+			}
+		}
+		result = kept
+	}
+	sort.Ints(result)
+	return result
+}
+
+// wordsPattern matches ws as consecutive words, the first starting at a word
+// boundary and the last possibly continuing (so terms match word prefixes).
+// Group 1 is the matched words.
+func wordsPattern(ws []string) *regexp.Regexp {
+	quoted := make([]string, len(ws))
+	for i, w := range ws {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	return regexp.MustCompile(`(?i)(?:^|[^\pL\pN])(` + strings.Join(quoted, `[^\pL\pN]+`) + `)`)
+}
+
+func matchContact(contacts []string, want string) bool {
+	want = strings.ToLower(strings.TrimSpace(want))
+	digits := onlyDigits(want)
+	for _, c := range contacts {
+		if strings.Contains(strings.ToLower(c), want) {
+			return true
+		}
+		// "555 1234" should find "+15551234".
+		if len(digits) >= 3 && len(digits)*2 > len(want) && strings.Contains(onlyDigits(c), digits) {
+			return true
+		}
+	}
+	return false
+}
+
+func onlyDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,162 @@
+package search
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBackup = `<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>
+<smses count="5">
+  <sms address="+15550001" date="1483228800000" type="1" body="The new address is 12 Elm St, Springfield" contact_name="Dad"/>
+  <sms address="+15550001" date="1483228860000" type="2" body="Thanks, see you Sunday" contact_name="Dad"/>
+  <sms address="+15550002" date="1514764800000" type="1" body="Addresses are on the list" contact_name="Ann"/>
+  <mms date="1514764900000" address="+15550002" contact_name="Ann" msg_box="1">
+    <parts>
+      <part seq="0" ct="text/plain" text="Here is Bob"/>
+      <part seq="1" ct="text/x-vcard" cl="bob.vcf" data="VCARD"/>
+      <part seq="2" ct="image/jpeg" cl="cat.jpg" data="eA=="/>
+    </parts>
+    <addrs><addr address="+15550002" type="137"/></addrs>
+  </mms>
+  <sms address="+15550001" date="1483228920000" type="1" body="Bring the o'brien book" contact_name="Dad"/>
+</smses>`
+
+func writeBackup(t *testing.T) string {
+	t.Helper()
+	card := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Bob Smith\r\nTEL:+15559999\r\nEND:VCARD\r\n"
+	doc := strings.Replace(testBackup, "VCARD", base64.StdEncoding.EncodeToString([]byte(card)), 1)
+	path := filepath.Join(t.TempDir(), "sms-1.xml")
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func texts(ix *Index, matches []Match) []string {
+	var out []string
+	for _, m := range matches {
+		out = append(out, ix.Docs[m.Doc].Text)
+	}
+	return out
+}
+
+func TestParseQuery(t *testing.T) {
+	q := ParseQuery(`Elm "new  address" o'brien , `)
+	if strings.Join(q.Terms, "|") != "elm" || strings.Join(q.Phrases, "|") != "new  address|o'brien" {
+		t.Errorf("ParseQuery = %+v", q)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	path := writeBackup(t)
+	ix, err := Build([]string{path}, nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"prefix term", ParseQuery("addr"), []string{
+			"The new address is 12 Elm St, Springfield",
+			"Addresses are on the list",
+		}},
+		{"not mid-word", ParseQuery("dress"), nil},
+		{"phrase", ParseQuery(`"address is 12"`), []string{"The new address is 12 Elm St, Springfield"}},
+		{"punctuation in word", ParseQuery("O'Brien"), []string{"Bring the o'brien book"}},
+		{"all terms", ParseQuery("addr list"), []string{"Addresses are on the list"}},
+		{"contact", Query{Terms: []string{"addr"}, Contact: "dad"}, []string{"The new address is 12 Elm St, Springfield"}},
+		{"contact digits", Query{Terms: []string{"addr"}, Contact: "555 0002"}, []string{"Addresses are on the list"}},
+		{"since", Query{Terms: []string{"addr"}, Since: time.UnixMilli(1500000000000)}, []string{"Addresses are on the list"}},
+		{"until", Query{Terms: []string{"addr"}, Until: time.UnixMilli(1500000000000)}, []string{"The new address is 12 Elm St, Springfield"}},
+		{"regexp", Query{Regexp: regexp.MustCompile(`\d+ Elm`)}, []string{"The new address is 12 Elm St, Springfield"}},
+		{"mms text", ParseQuery("bob"), []string{"Here is Bob"}},
+		{"vcard off", ParseQuery("smith"), nil},
+	}
+	for _, tt := range tests {
+		if got := texts(ix, ix.Search(tt.q)); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	m := ix.Search(ParseQuery("elm"))
+	if len(m) != 1 || m[0].Spans[0] != [2]int{22, 25} {
+		t.Errorf("spans = %+v", m)
+	}
+}
+
+func TestSearch_VCards(t *testing.T) {
+	ix, err := Build([]string{writeBackup(t)}, nil, Options{VCards: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := texts(ix, ix.Search(ParseQuery("smith +1555")))
+	if len(got) != 1 || got[0] != "Here is Bob\nBob Smith, +15559999" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := writeBackup(t)
+	ix, err := Build([]string{path}, nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexPath := filepath.Join(t.TempDir(), "index.sbr")
+	if err = ix.Save(indexPath); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Current([]string{path}, Options{}) {
+		t.Error("loaded index is not current")
+	}
+	if loaded.Current([]string{path}, Options{VCards: true}) {
+		t.Error("index is current for different options")
+	}
+	if got := texts(loaded, loaded.Search(ParseQuery("springfield"))); len(got) != 1 {
+		t.Errorf("search of loaded index = %q", got)
+	}
+
+	if err = os.WriteFile(path, []byte(testBackup+" "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Current([]string{path}, Options{}) {
+		t.Error("index is current after the backup changed")
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	ix, err := Build([]string{writeBackup(t)}, nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = WriteText(&buf, ix, ix.Search(ParseQuery("elm")), 1); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"Dad\n",
+		"> 20",
+		"  Dad: The new address is 12 Elm St, Springfield\n",
+		"  Me: Thanks, see you Sunday\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "o'brien") || strings.Contains(got, "--") {
+		t.Errorf("output has more than one message of context:\n%s", got)
+	}
+}
@@ -0,0 +1,111 @@
+package search
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/rcs"
+	"github.com/junkblocker/sbr/vcard"
+)
+
+// recordText returns the searchable text of a record: an SMS body, or an
+// MMS's text parts and body, plus its contact cards and bot messages when opts
+// asks for them. Parts that cannot be decoded contribute nothing.
+func recordText(rec backup.Record, opts Options) string {
+	switch rec.Kind {
+	case backup.KindSMS:
+		return strings.TrimSpace(nonNull(rec.SMS.Body))
+	case backup.KindMMS:
+	default:
+		return ""
+	}
+
+	var texts []string
+	for _, p := range rec.MMS.Parts {
+		ct := strings.ToLower(p.ContentType)
+		switch {
+		case ct == "text/plain":
+		case ct == rcs.ContentType && opts.BotMessages:
+		case vcard.IsContentType(ct) && opts.VCards:
+		default:
+			continue
+		}
+
+		text := nonNull(p.Text)
+		if text == "" && nonNull(p.Data) != "" {
+			raw, err := base64.StdEncoding.DecodeString(p.Data)
+			if err != nil {
+				continue
+			}
+			if ct == rcs.ContentType {
+				// JSON is UTF-8 by definition.
+				text = string(raw)
+			} else if text, err = processor.DecodeCharset(raw, p.Charset); err != nil {
+				continue
+			}
+		}
+		if text == "" {
+			continue
+		}
+
+		switch {
+		case ct == rcs.ContentType:
+			m, err := rcs.Parse([]byte(text))
+			if err != nil {
+				continue
+			}
+			text = m.Summary()
+		case ct != "text/plain":
+			cards, err := vcard.Parse([]byte(text))
+			if err != nil {
+				continue
+			}
+			text = cardsText(cards)
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	if body := strings.TrimSpace(nonNull(rec.MMS.Body)); body != "" {
+		texts = append(texts, body)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// cardsText flattens contact cards to one line per card: the name followed
+// by every number, address and note.
+func cardsText(cards []*vcard.Card) string {
+	lines := make([]string, 0, len(cards))
+	for _, c := range cards {
+		fields := []string{c.DisplayName(), c.Org}
+		for _, t := range c.Phones {
+			fields = append(fields, t.Value)
+		}
+		for _, t := range c.Emails {
+			fields = append(fields, t.Value)
+		}
+		for _, a := range c.Addresses {
+			fields = append(fields, a.POBox, a.Extended, a.Street, a.Locality, a.Region, a.Postcode, a.Country)
+		}
+		fields = append(fields, c.URLs...)
+		fields = append(fields, c.Notes...)
+
+		var kept []string
+		for _, f := range fields {
+			if f = strings.TrimSpace(f); f != "" {
+				kept = append(kept, f)
+			}
+		}
+		lines = append(lines, strings.Join(kept, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func nonNull(s string) string {
+	if s == "null" {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,111 @@
+package search
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// snippetWidth is the number of characters of a message shown per line.
+const snippetWidth = 160
+
+// WriteText prints matches grouped by conversation, like grep: each matching
+// message on a line starting with "> ", preceded and followed by up to
+// context neighbouring messages of the same conversation. Blocks that touch
+// are merged; separate blocks are divided by "--".
+func WriteText(w io.Writer, ix *Index, matches []Match, context int) error {
+	ew := &errWriter{w: w}
+	matched := make(map[int]Match, len(matches))
+	for _, m := range matches {
+		matched[m.Doc] = m
+	}
+
+	lastThread, lastPos := -1, -1
+	for _, m := range matches {
+		d := ix.Docs[m.Doc]
+		t := ix.Threads[d.Thread]
+		lo, hi := max(d.Pos-context, 0), min(d.Pos+context, len(t.Docs)-1)
+		if d.Thread == lastThread && lo <= lastPos+1 {
+			// Continue the previous block.
+			lo = max(lo, lastPos+1)
+		} else {
+			if lastThread >= 0 {
+				ew.printf("--\n")
+			}
+			if d.Thread != lastThread {
+				ew.printf("%s\n", t.Title)
+			}
+		}
+		for pos := lo; pos <= hi; pos++ {
+			i := t.Docs[pos]
+			marker := "  "
+			m, ok := matched[i]
+			if ok {
+				marker = "> "
+			}
+			doc := ix.Docs[i]
+			ew.printf("%s%s  %s: %s\n", marker, doc.Time.Format("2006-01-02 15:04:05"), doc.Sender, snippet(doc, m.Spans))
+		}
+		if d.Thread != lastThread {
+			lastThread, lastPos = d.Thread, hi
+		} else {
+			lastPos = max(lastPos, hi)
+		}
+	}
+	return ew.err
+}
+
+// snippet returns d's text on one line, cut to snippetWidth characters around
+// the first span, followed by its attachments.
+func snippet(d Doc, spans [][2]int) string {
+	text := d.Text
+	start := 0
+	if len(spans) > 0 {
+		start = spans[0][0]
+	}
+	// Start a little before the match, at a character boundary.
+	if utf8.RuneCountInString(text[:start]) > snippetWidth/4 {
+		cut := start
+		for n := 0; n < snippetWidth/4; n++ {
+			_, size := utf8.DecodeLastRuneInString(text[:cut])
+			cut -= size
+		}
+		text = "…" + text[cut:]
+	}
+	if utf8.RuneCountInString(text) > snippetWidth {
+		n := 0
+		for i := range text {
+			if n == snippetWidth {
+				text = text[:i] + "…"
+				break
+			}
+			n++
+		}
+	}
+	text = strings.Join(strings.Fields(text), " ")
+
+	for _, a := range d.Attachments {
+		if text != "" {
+			text += " "
+		}
+		text += "[" + a + "]"
+	}
+	if text == "" {
+		return "(no text)"
+	}
+	return text
+}
+
+// errWriter latches the first write error so rendering code can print
+// unconditionally and check once at the end.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...any) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
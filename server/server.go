@@ -0,0 +1,176 @@
+// Package server implements "sbr serve": a web UI for browsing backups in
+// place. Backups are scanned once to build an index of threads and the byte
+// offset of every message; an attachment is then served by seeking to its
+// message and decoding only that record, so nothing is extracted to disk.
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/contact"
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/thread"
+)
+
+// Server is an http.Handler serving the threads of a set of backup files.
+type Server struct {
+	sources []string
+	// sourceIndex maps a source path to its position in sources, which
+	// identifies the file in part URLs.
+	sourceIndex map[string]int
+	threads     []*thread.Thread
+	// known holds the location of every indexed MMS, so that part URLs cannot
+	// be used to probe arbitrary offsets.
+	known map[location]bool
+
+	mu    sync.Mutex
+	files map[int]*os.File
+
+	mux *http.ServeMux
+}
+
+type location struct {
+	source int
+	offset int64
+}
+
+// New indexes the given backup files. r resolves participants; it may be nil.
+func New(paths []string, r *contact.Resolver) (*Server, error) {
+	s := &Server{
+		sources:     paths,
+		sourceIndex: make(map[string]int, len(paths)),
+		known:       make(map[location]bool),
+		files:       make(map[int]*os.File),
+	}
+	for i, p := range paths {
+		s.sourceIndex[p] = i
+	}
+	b := thread.NewBuilder(r)
+	for _, path := range paths {
+		if err := backup.ScanFile(path, b.Add); err != nil {
+			return nil, fmt.Errorf("indexing %s: %w", path, err)
+		}
+	}
+	s.threads = b.Threads()
+
+	for _, t := range s.threads {
+		for _, m := range t.Messages {
+			if m.Kind == backup.KindMMS {
+				s.known[location{s.sourceIndex[m.Source], m.Offset}] = true
+			}
+		}
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /{$}", s.handleIndex)
+	s.mux.HandleFunc("GET /thread/{n}", s.handleThread)
+	s.mux.HandleFunc("GET /part/{source}/{offset}/{index}", s.handlePart)
+	return s, nil
+}
+
+// Threads returns the indexed threads, newest first.
+func (s *Server) Threads() []*thread.Thread {
+	return s.threads
+}
+
+// Close closes the backup files opened to serve attachments.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var first error
+	for i, f := range s.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(s.files, i)
+	}
+	return first
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	render(w, indexTemplate, s.threads)
+}
+
+func (s *Server) handleThread(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil || n < 0 || n >= len(s.threads) {
+		http.NotFound(w, r)
+		return
+	}
+	render(w, threadTemplate, threadPage{Thread: s.threads[n], sourceIndex: s.sourceIndex})
+}
+
+func (s *Server) handlePart(w http.ResponseWriter, r *http.Request) {
+	source, err1 := strconv.Atoi(r.PathValue("source"))
+	offset, err2 := strconv.ParseInt(r.PathValue("offset"), 10, 64)
+	index, err3 := strconv.Atoi(r.PathValue("index"))
+	if err1 != nil || err2 != nil || err3 != nil || !s.known[location{source, offset}] {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := s.file(source)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// ReadRecordAt reads through its own SectionReader, so concurrent requests
+	// can share the file.
+	rec, err := backup.ReadRecordAt(f, offset)
+	if err != nil || rec.MMS == nil {
+		http.Error(w, fmt.Sprintf("reading message: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if index < 0 || index >= len(rec.MMS.Parts) {
+		http.NotFound(w, r)
+		return
+	}
+	part := rec.MMS.Parts[index]
+
+	ct := strings.ToLower(part.ContentType)
+	if _, _, err = mime.ParseMediaType(ct); err != nil {
+		ct = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ct)
+	// Attachments come from third parties: never let the browser sniff them
+	// into something executable.
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src 'self'; media-src 'self'; style-src 'unsafe-inline'")
+	if name := processor.PartName(part); name != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name}))
+	}
+	if part.Data == "" || part.Data == "null" {
+		_, _ = io.WriteString(w, part.Text)
+		return
+	}
+	_, _ = io.Copy(w, base64.NewDecoder(base64.StdEncoding, strings.NewReader(part.Data)))
+}
+
+// file returns the open backup file with the given index, opening it on
+// first use.
+func (s *Server) file(source int) (*os.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.files[source]; ok {
+		return f, nil
+	}
+	f, err := os.Open(s.sources[source])
+	if err != nil {
+		return nil, err
+	}
+	s.files[source] = f
+	return f, nil
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	doc := `<?xml version='1.0' encoding='UTF-8' standalone='yes' ?>
+<smses count="2">
+  <sms address="+15550001" date="1000" type="1" body="hello &lt;there&gt;" contact_name="Ann"/>
+  <mms date="2000" address="+15550001" contact_name="Ann" msg_box="1">
+    <parts>
+      <part seq="0" ct="text/plain" text="look"/>
+      <part seq="1" ct="image/png" cl="cat.png" data="aGVsbG8="/>
+    </parts>
+    <addrs><addr address="+15550001" type="137"/></addrs>
+  </mms>
+</smses>`
+	path := filepath.Join(t.TempDir(), "sms-1.xml")
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New([]string{path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if len(s.Threads()) != 1 {
+		t.Fatalf("got %d threads, want 1", len(s.Threads()))
+	}
+
+	get := func(url string) (int, http.Header, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		body, _ := io.ReadAll(w.Result().Body)
+		return w.Code, w.Result().Header, string(body)
+	}
+
+	code, _, body := get("/")
+	if code != http.StatusOK || !strings.Contains(body, `href="/thread/0"`) || !strings.Contains(body, "Ann") {
+		t.Errorf("index = %d %q", code, body)
+	}
+
+	code, _, body = get("/thread/0")
+	if code != http.StatusOK || !strings.Contains(body, "hello &lt;there&gt;") {
+		t.Errorf("thread = %d %q", code, body)
+	}
+	m := regexp.MustCompile(`<img src="(/part/0/\d+/1)"`).FindStringSubmatch(body)
+	if m == nil {
+		t.Fatalf("thread page has no image part: %q", body)
+	}
+
+	code, h, body := get(m[1])
+	if code != http.StatusOK || body != "hello" {
+		t.Errorf("part = %d %q", code, body)
+	}
+	if h.Get("Content-Type") != "image/png" || h.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("part headers = %v", h)
+	}
+
+	for _, url := range []string{"/thread/1", "/part/0/1/0", "/part/1/0/0", strings.TrimSuffix(m[1], "1") + "2"} {
+		if code, _, _ = get(url); code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", url, code)
+		}
+	}
+}
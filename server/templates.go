@@ -0,0 +1,115 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/junkblocker/sbr/thread"
+	"github.com/junkblocker/sbr/types"
+)
+
+// threadPage is the data for threadTemplate.
+type threadPage struct {
+	*thread.Thread
+	sourceIndex map[string]int
+}
+
+// partLink is the data for the "part" template.
+type partLink struct {
+	Part thread.Part
+	URL  string
+}
+
+// Part returns part p of message m with the URL serving it.
+func (t threadPage) Part(m *thread.Message, p thread.Part) partLink {
+	return partLink{p, fmt.Sprintf("/part/%d/%d/%d", t.sourceIndex[m.Source], m.Offset, p.Index)}
+}
+
+var funcs = template.FuncMap{
+	"formatTime": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"isSent":     func(m *thread.Message) bool { return m.Direction == thread.Sent },
+	"author": func(m *thread.Message) string {
+		if m.Direction == thread.Sent {
+			return "Me"
+		}
+		if m.Sender != nil {
+			return m.Sender.Label()
+		}
+		return "(Unknown)"
+	},
+	"mediaKind": func(p thread.Part) string {
+		kind, _, _ := strings.Cut(p.ContentType, "/")
+		return kind
+	},
+	"size": func(p thread.Part) string { return types.FormatBytes(p.Size) },
+	"last": func(t *thread.Thread) *thread.Message {
+		if len(t.Messages) == 0 {
+			return nil
+		}
+		return t.Messages[len(t.Messages)-1]
+	},
+}
+
+const style = `
+body { font-family: system-ui, sans-serif; max-width: 48rem; margin: 2rem auto; background: #f4f4f6; color: #222; }
+h1 { font-size: 1.3rem; }
+a { color: #0b64c0; }
+.msg { margin: .6rem 0; display: flex; flex-direction: column; }
+.msg.sent { align-items: flex-end; }
+.bubble { max-width: 75%; padding: .5rem .8rem; border-radius: 1rem; background: #fff; white-space: pre-wrap; word-wrap: break-word; }
+.sent .bubble { background: #0b84ff; color: #fff; }
+.sent .bubble a { color: #fff; }
+.meta { font-size: .75rem; color: #888; margin: 0 .5rem .15rem; }
+.bubble img, .bubble video { max-width: 100%; max-height: 20rem; border-radius: .5rem; display: block; margin: .3rem 0; }
+.part { font-size: .8rem; }
+.slide + .slide { border-top: 1px dashed #bbb; margin-top: .4rem; padding-top: .4rem; }
+table { border-collapse: collapse; width: 100%; }
+td { padding: .3rem .5rem; border-bottom: 1px solid #ddd; }
+`
+
+var indexTemplate = template.Must(template.New("index").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Conversations</title>
+<style>` + style + `</style>
+</head>
+<body>
+<h1>Conversations</h1>
+<table>
+{{range $i, $t := .}}<tr><td><a href="/thread/{{$i}}">{{$t.Title}}</a>{{if $t.Group}} (group){{end}}</td><td>{{len $t.Messages}} message(s)</td><td>{{with last $t}}{{formatTime .Time}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+var threadTemplate = template.Must(template.New("thread").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>` + style + `</style>
+</head>
+<body>
+<p><a href="/">← All conversations</a></p>
+<h1>{{.Title}}</h1>
+{{$page := .}}{{range .Messages}}{{$m := .}}<div class="msg{{if isSent .}} sent{{end}}">
+<div class="meta">{{author .}} · {{formatTime .Time}}</div>
+<div class="bubble">{{if .Slides}}{{range .Slides}}<div class="slide">Slide {{.Number}}
+{{.Text}}{{range .Parts}}{{template "part" $page.Part $m .}}{{end}}</div>{{end}}{{else}}{{.Body}}{{range .Parts}}{{template "part" $page.Part $m .}}{{end}}{{end}}</div>
+</div>
+{{end}}</body>
+</html>
+{{define "part"}}{{$kind := mediaKind .Part}}
+{{if eq $kind "image"}}<a href="{{.URL}}"><img src="{{.URL}}" loading="lazy" alt="{{.Part.Name}}"></a>{{else if eq $kind "video"}}<video controls preload="none" src="{{.URL}}"></video>{{else if eq $kind "audio"}}<audio controls preload="none" src="{{.URL}}"></audio>{{end}}
+<div class="part"><a href="{{.URL}}">📎 {{with .Part.Name}}{{.}}{{else}}{{.Part.ContentType}}{{end}}</a> ({{size .Part}})</div>{{end}}`))
+
+func render(w http.ResponseWriter, t *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := t.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
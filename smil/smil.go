@@ -0,0 +1,222 @@
+// Package smil decodes the SMIL presentation carried by every MMS, which
+// defines the order of the message's slides and which image, text, audio or
+// video part appears on each.
+package smil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/junkblocker/sbr/types"
+)
+
+// ContentType is the MIME type of the presentation part.
+const ContentType = "application/smil"
+
+// Ref is one media reference on a slide.
+type Ref struct {
+	// Kind is the SMIL element name: "img", "text", "audio", "video" or "ref".
+	Kind string
+	// Src is the src attribute as written in the SMIL.
+	Src string
+	// Region is the layout region the media is placed in, if any.
+	Region string
+	// Part is the 0-based index of the MMS part Src refers to, or -1 if it
+	// could not be matched.
+	Part int
+}
+
+// Slide is one <par> of the presentation.
+type Slide struct {
+	// Number is the 1-based position of the slide.
+	Number int
+	// Duration is the slide's dur attribute, or 0 if absent.
+	Duration time.Duration
+	Refs     []Ref
+}
+
+// PartID carries the attributes of an MMS part that SMIL src values may refer
+// to.
+type PartID struct {
+	ContentLocation string // cl
+	ContentID       string // cid, usually wrapped in angle brackets
+	Name            string // name
+}
+
+// Parse decodes a SMIL document into its slides. Ref.Part is left at -1; use
+// Match to resolve it.
+func Parse(doc []byte) ([]Slide, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(doc))
+	// SMIL written by handsets is often sloppy (unquoted attributes, HTML
+	// entities); be forgiving.
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	var slides []Slide
+	// cur indexes the open <par>, or is -1 outside one. An index rather than a
+	// pointer, since appending to slides may move it.
+	cur := -1
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			// Keep whatever was parsed before a trailing syntax error.
+			if len(slides) > 0 {
+				break
+			}
+			return nil, fmt.Errorf("parsing SMIL: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch name := strings.ToLower(t.Name.Local); name {
+			case "par":
+				slides = append(slides, Slide{Number: len(slides) + 1, Duration: parseDur(attr(t, "dur"))})
+				cur = len(slides) - 1
+			case "img", "text", "audio", "video", "ref":
+				ref := Ref{Kind: name, Src: attr(t, "src"), Region: attr(t, "region"), Part: -1}
+				if cur < 0 {
+					// Media outside any <par> forms an implicit slide.
+					slides = append(slides, Slide{Number: len(slides) + 1})
+					cur = len(slides) - 1
+				}
+				slides[cur].Refs = append(slides[cur].Refs, ref)
+			}
+		case xml.EndElement:
+			if strings.ToLower(t.Name.Local) == "par" {
+				cur = -1
+			}
+		}
+	}
+	return slides, nil
+}
+
+// Match resolves each Ref.Part against parts. A src matches a part when it
+// equals the part's cl or name, or when it is a "cid:" URL (or bare content
+// id) equal to the part's cid without angle brackets. Exact matches are tried
+// before case-insensitive ones.
+func Match(slides []Slide, parts []PartID) {
+	for si := range slides {
+		for ri := range slides[si].Refs {
+			slides[si].Refs[ri].Part = matchPart(slides[si].Refs[ri].Src, parts)
+		}
+	}
+}
+
+func matchPart(src string, parts []PartID) int {
+	if src == "" {
+		return -1
+	}
+	cid, isCID := strings.CutPrefix(src, "cid:")
+	for _, fold := range []bool{false, true} {
+		eq := func(a, b string) bool {
+			if a == "" || a == "null" {
+				return false
+			}
+			if fold {
+				return strings.EqualFold(a, b)
+			}
+			return a == b
+		}
+		for i, p := range parts {
+			bare := strings.Trim(p.ContentID, "<>")
+			if isCID {
+				if eq(bare, cid) {
+					return i
+				}
+				continue
+			}
+			if eq(p.ContentLocation, src) || eq(p.Name, src) || eq(bare, src) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// SlideOf returns, for each part index, the 1-based number of the first slide
+// that references it (0 for parts on no slide).
+func SlideOf(slides []Slide, nParts int) []int {
+	out := make([]int, nParts)
+	for _, s := range slides {
+		for _, r := range s.Refs {
+			if r.Part >= 0 && r.Part < nParts && out[r.Part] == 0 {
+				out[r.Part] = s.Number
+			}
+		}
+	}
+	return out
+}
+
+// Document returns the SMIL source stored in an MMS part: its text attribute,
+// or its base64 data when the text attribute is empty.
+func Document(text, data string) ([]byte, error) {
+	if text != "" && text != "null" {
+		return []byte(text), nil
+	}
+	if data != "" && data != "null" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	return nil, nil
+}
+
+// ForMMS locates, parses and matches the presentation of m. It returns nil
+// slides (and no error) when the message has no SMIL part.
+func ForMMS(m *types.MMS) ([]Slide, error) {
+	ids := make([]PartID, len(m.Parts))
+	var doc []byte
+	for i, p := range m.Parts {
+		ids[i] = PartID{ContentLocation: p.Filename, ContentID: p.ContentID, Name: p.Name}
+		if doc == nil && strings.EqualFold(p.ContentType, ContentType) {
+			var err error
+			if doc, err = Document(p.Text, p.Data); err != nil {
+				return nil, fmt.Errorf("decoding SMIL part: %w", err)
+			}
+		}
+	}
+	if doc == nil {
+		return nil, nil
+	}
+	slides, err := Parse(doc)
+	if err != nil {
+		return nil, err
+	}
+	Match(slides, ids)
+	return slides, nil
+}
+
+func attr(se xml.StartElement, name string) string {
+	for _, a := range se.Attr {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// parseDur understands the clock values handsets write: "5000ms", "5s",
+// "5.5s" and bare seconds.
+func parseDur(s string) time.Duration {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	if ms, ok := strings.CutSuffix(s, "ms"); ok {
+		if n, err := strconv.ParseFloat(ms, 64); err == nil {
+			return time.Duration(n * float64(time.Millisecond))
+		}
+		return 0
+	}
+	s = strings.TrimSuffix(s, "s")
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(n * float64(time.Second))
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package smil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/junkblocker/sbr/types"
+)
+
+const sampleSMIL = `<smil><head><layout><region id="Image"/><region id="Text"/></layout></head>
+<body>
+<par dur="5000ms"><img src="cid:photo1" region="Image"/><text src="text_0.txt" region="Text"/></par>
+<par dur=3s><img src="Second.JPG" region="Image"/><audio src="clip.amr"/></par>
+</body></smil>`
+
+func TestParse(t *testing.T) {
+	slides, err := Parse([]byte(sampleSMIL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slides) != 2 {
+		t.Fatalf("got %d slides, want 2", len(slides))
+	}
+	if slides[0].Duration != 5*time.Second || slides[1].Duration != 3*time.Second {
+		t.Errorf("durations = %v, %v", slides[0].Duration, slides[1].Duration)
+	}
+	if got := slides[0].Refs; len(got) != 2 || got[0].Kind != "img" || got[0].Src != "cid:photo1" || got[0].Region != "Image" || got[0].Part != -1 {
+		t.Errorf("slide 1 refs = %+v", got)
+	}
+	if got := slides[1].Refs; len(got) != 2 || got[1].Kind != "audio" || got[1].Src != "clip.amr" {
+		t.Errorf("slide 2 refs = %+v", got)
+	}
+}
+
+func TestParse_MediaOutsidePar(t *testing.T) {
+	slides, err := Parse([]byte(`<smil><body><img src="a.jpg"/></body></smil>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slides) != 1 || slides[0].Number != 1 || len(slides[0].Refs) != 1 {
+		t.Errorf("slides = %+v, want one implicit slide", slides)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	slides, err := Parse([]byte(sampleSMIL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := []PartID{
+		{ContentLocation: "smil.xml"},
+		{ContentLocation: "second.jpg"},                       // matched case-insensitively
+		{ContentLocation: "IMG_1.jpg", ContentID: "<photo1>"}, // matched by cid:
+		{Name: "text_0.txt"},                                  // matched by name
+	}
+	Match(slides, parts)
+	if got := SlideOf(slides, len(parts)); got[0] != 0 || got[1] != 2 || got[2] != 1 || got[3] != 1 {
+		t.Errorf("SlideOf = %v, want [0 2 1 1]", got)
+	}
+	if slides[1].Refs[1].Part != -1 {
+		t.Errorf("unmatched audio ref resolved to part %d", slides[1].Refs[1].Part)
+	}
+}
+
+func TestForMMS(t *testing.T) {
+	m := &types.MMS{Parts: []types.MMSPart{
+		{ContentType: "application/smil", Text: `<smil><body><par><img src="b.jpg"/></par><par><img src="a.jpg"/></par></body></smil>`},
+		{ContentType: "image/jpeg", Filename: "a.jpg"},
+		{ContentType: "image/jpeg", Filename: "b.jpg"},
+	}}
+	slides, err := ForMMS(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := SlideOf(slides, len(m.Parts)); got[1] != 2 || got[2] != 1 {
+		t.Errorf("SlideOf = %v, want b.jpg on slide 1 and a.jpg on slide 2", got)
+	}
+
+	slides, err = ForMMS(&types.MMS{Parts: []types.MMSPart{{ContentType: "image/jpeg"}}})
+	if err != nil || slides != nil {
+		t.Errorf("ForMMS without SMIL = %v, %v; want nil, nil", slides, err)
+	}
+}
+
+func TestParseDur(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"":       0,
+		"5000ms": 5 * time.Second,
+		"5s":     5 * time.Second,
+		"2.5s":   2500 * time.Millisecond,
+		"7":      7 * time.Second,
+		"bogus":  0,
+	} {
+		if got := parseDur(in); got != want {
+			t.Errorf("parseDur(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
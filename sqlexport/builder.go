@@ -0,0 +1,221 @@
+package sqlexport
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/contact"
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/thread"
+	"github.com/junkblocker/sbr/types"
+)
+
+// Builder accumulates records and turns them into table rows. Like
+// thread.Builder it defers resolution until the end, so contact names seen
+// late in the backups still apply to early messages.
+type Builder struct {
+	resolver *contact.Resolver
+	threads  *thread.Builder
+	messages map[location]*message
+	calls    []backup.Record
+	paths    map[location]map[int]string
+}
+
+type location struct {
+	source string
+	offset int64
+}
+
+// message is what a record contributes beyond its thread.Message.
+type message struct {
+	id    string
+	addrs []address
+	parts []part
+}
+
+type address struct {
+	address types.PhoneNumber
+	role    string
+}
+
+type part struct {
+	seq               int
+	contentType, name string
+	size              int64
+}
+
+// NewBuilder returns a Builder that resolves participants with r. A nil r
+// normalises addresses without a default country.
+func NewBuilder(r *contact.Resolver) *Builder {
+	if r == nil {
+		r = contact.NewResolver(nil)
+	}
+	return &Builder{
+		resolver: r,
+		threads:  thread.NewBuilder(r),
+		messages: make(map[location]*message),
+		paths:    make(map[location]map[int]string),
+	}
+}
+
+// Add records one backup record.
+func (b *Builder) Add(rec backup.Record) {
+	loc := location{rec.Source, rec.Offset}
+	switch rec.Kind {
+	case backup.KindSMS:
+		b.threads.Add(rec)
+		m := &message{id: rec.ID()}
+		role := "from"
+		if rec.SMS.Type != types.SMSInbox {
+			role = "to"
+		}
+		for _, a := range contact.SplitAddresses(rec.SMS.Address) {
+			m.addrs = append(m.addrs, address{a, role})
+		}
+		b.messages[loc] = m
+	case backup.KindMMS:
+		b.threads.Add(rec)
+		m := &message{id: rec.ID()}
+		for _, a := range rec.MMS.Addresses {
+			if role := addrRole(a.Type); role != "" && a.Address.Usable() {
+				m.addrs = append(m.addrs, address{a.Address, role})
+			}
+		}
+		for i, p := range rec.MMS.Parts {
+			m.parts = append(m.parts, part{
+				seq:         i,
+				contentType: strings.ToLower(p.ContentType),
+				name:        processor.PartName(p),
+				size:        p.DecodedSize(),
+			})
+		}
+		b.messages[loc] = m
+	case backup.KindCall:
+		b.resolver.Observe(rec.Call.Number, rec.Call.ContactName)
+		b.calls = append(b.calls, rec)
+	}
+}
+
+// SetPath records the file, relative to the extract output directory, that
+// part index of the MMS at source and offset is extracted to.
+func (b *Builder) SetPath(source string, offset int64, index int, path string) {
+	loc := location{source, offset}
+	if b.paths[loc] == nil {
+		b.paths[loc] = make(map[int]string)
+	}
+	b.paths[loc][index] = path
+}
+
+// Upsert resolves the records added so far and merges them into db,
+// replacing the rows of messages and calls db already holds. It returns the
+// number of rows added.
+func (b *Builder) Upsert(db *DB) int {
+	// A message's addresses and parts are replaced as a whole, so that rows
+	// from an earlier export with, say, a different -country do not linger.
+	// Rows deleted and written back do not count as added.
+	ids := make(map[string]bool)
+	for _, m := range b.messages {
+		ids[m.id] = true
+	}
+	replaced := map[string]map[string]bool{
+		"addresses": db.tables["addresses"].deleteWhere(ids),
+		"parts":     db.tables["parts"].deleteWhere(ids),
+	}
+
+	added := 0
+	upsert := func(name string, row ...string) {
+		if key, isNew := db.tables[name].upsert(row); isNew && !replaced[name][key] {
+			added++
+		}
+	}
+
+	threads := b.threads.Threads()
+	for _, t := range threads {
+		upsert("threads", t.ID, t.Title(), boolInt(t.Group))
+		for _, tm := range t.Messages {
+			loc := location{tm.Source, tm.Offset}
+			m := b.messages[loc]
+			var sender string
+			if tm.Direction == thread.Received && tm.Sender != nil {
+				sender = b.senderAddress(m, tm.Sender)
+			}
+			upsert("messages", m.id, t.ID, tm.Kind.String(), millis(tm.Time.UnixMilli()),
+				tm.Direction.String(), sender, tm.Body, tm.Source)
+			for _, a := range m.addrs {
+				n := b.resolver.Normalise(a.address)
+				upsert("addresses", m.id, string(n), a.role, b.resolver.Resolve(n).Label())
+			}
+			for _, p := range m.parts {
+				upsert("parts", m.id, strconv.Itoa(p.seq), p.contentType, p.name,
+					strconv.FormatInt(p.size, 10), b.paths[loc][p.seq])
+			}
+		}
+	}
+	b.dropEmptyThreads(db)
+
+	for _, rec := range b.calls {
+		c := rec.Call
+		n := b.resolver.Normalise(c.Number)
+		duration, _ := strconv.ParseInt(strings.TrimSpace(c.Duration), 10, 64)
+		date, _ := strconv.ParseInt(strings.TrimSpace(c.Date), 10, 64)
+		upsert("calls", rec.ID(), string(n), b.resolver.Resolve(n).Label(), millis(date),
+			strconv.FormatInt(duration, 10), c.Type.String())
+	}
+	return added
+}
+
+// dropEmptyThreads deletes threads no message belongs to any more, as happens
+// when an earlier export's threads are joined by newly seen messages.
+func (b *Builder) dropEmptyThreads(db *DB) {
+	used := make(map[string]bool)
+	for _, row := range db.tables["messages"].rows {
+		used[row[1]] = true
+	}
+	unused := make(map[string]bool)
+	for _, row := range db.tables["threads"].rows {
+		if !used[row[0]] {
+			unused[row[0]] = true
+		}
+	}
+	db.tables["threads"].deleteWhere(unused)
+}
+
+// senderAddress returns the normalised address of a received message's
+// sender: its "from" address, or the first address of the sender's identity.
+func (b *Builder) senderAddress(m *message, sender *contact.Identity) string {
+	for _, a := range m.addrs {
+		if a.role == "from" {
+			return string(b.resolver.Normalise(a.address))
+		}
+	}
+	if len(sender.Addresses) > 0 {
+		return string(sender.Addresses[0])
+	}
+	return ""
+}
+
+func addrRole(t int) string {
+	switch t {
+	case types.MMSAddrFrom:
+		return "from"
+	case types.MMSAddrTo:
+		return "to"
+	case types.MMSAddrCC:
+		return "cc"
+	case types.MMSAddrBCC:
+		return "bcc"
+	}
+	return ""
+}
+
+func boolInt(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
+
+func millis(ms int64) string {
+	return strconv.FormatInt(ms, 10)
+}
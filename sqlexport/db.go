@@ -0,0 +1,279 @@
+// Package sqlexport exports backups as relational tables — messages, their
+// parts and addresses, threads and calls — for analysis with SQL. The tables
+// are written as CSV files (RFC 4180, with a header row) next to a schema.sql
+// that creates matching tables in SQLite or any other SQL database.
+//
+// Every row has a stable primary key derived from the record itself (see
+// backup.Record.ID), so exporting into an existing directory upserts: rows
+// already present are updated, new ones added and nothing is lost when a
+// later run only sees an incremental backup.
+package sqlexport
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SchemaFile is the name of the schema written by Save.
+const SchemaFile = "schema.sql"
+
+type column struct {
+	name, typ, comment string
+}
+
+// tableDef describes one table. The first keys columns are its primary key.
+type tableDef struct {
+	name    string
+	comment string
+	columns []column
+	keys    int
+}
+
+// Tables in dependency order: a table only references tables before it.
+var tableDefs = []*tableDef{
+	{
+		name:    "threads",
+		comment: "Conversations: messages exchanged with the same set of participants.",
+		columns: []column{
+			{"id", "TEXT NOT NULL", "participants' normalised addresses or names, joined with ~"},
+			{"title", "TEXT NOT NULL", "participants' names, joined with \", \""},
+			{"is_group", "INTEGER NOT NULL", "1 when there is more than one other participant"},
+		},
+		keys: 1,
+	},
+	{
+		name:    "messages",
+		comment: "SMS and MMS.",
+		columns: []column{
+			{"id", "TEXT NOT NULL", "stable across full and incremental backups"},
+			{"thread_id", "TEXT NOT NULL REFERENCES threads(id)", ""},
+			{"kind", "TEXT NOT NULL", "sms or mms"},
+			{"date", "INTEGER NOT NULL", "milliseconds since the Unix epoch"},
+			{"direction", "TEXT NOT NULL", "sent or received"},
+			{"sender", "TEXT NOT NULL", "normalised address of a received message's sender; '' when sent"},
+			{"body", "TEXT NOT NULL", "SMS body, or the MMS text parts joined with newlines"},
+			{"source", "TEXT NOT NULL", "backup file the message was last exported from"},
+		},
+		keys: 1,
+	},
+	{
+		name:    "addresses",
+		comment: "Participants of each message.",
+		columns: []column{
+			{"message_id", "TEXT NOT NULL REFERENCES messages(id)", ""},
+			{"address", "TEXT NOT NULL", "normalised address"},
+			{"role", "TEXT NOT NULL", "from, to, cc or bcc"},
+			{"contact", "TEXT NOT NULL", "contact name, or the address when unknown"},
+		},
+		keys: 3,
+	},
+	{
+		name:    "parts",
+		comment: "MMS parts. Payloads are not stored; path names the file `sbr extract` writes.",
+		columns: []column{
+			{"message_id", "TEXT NOT NULL REFERENCES messages(id)", ""},
+			{"seq", "INTEGER NOT NULL", "0-based position within the message"},
+			{"content_type", "TEXT NOT NULL", ""},
+			{"name", "TEXT NOT NULL", "cl or name attribute; '' when unnamed"},
+			{"size", "INTEGER NOT NULL", "decoded size in bytes"},
+			{"path", "TEXT NOT NULL", "relative to the extract output directory; '' when not extracted"},
+		},
+		keys: 2,
+	},
+	{
+		name:    "calls",
+		comment: "Call log entries.",
+		columns: []column{
+			{"id", "TEXT NOT NULL", "stable across full and incremental backups"},
+			{"number", "TEXT NOT NULL", "normalised number"},
+			{"contact", "TEXT NOT NULL", "contact name, or the number when unknown"},
+			{"date", "INTEGER NOT NULL", "milliseconds since the Unix epoch"},
+			{"duration", "INTEGER NOT NULL", "seconds"},
+			{"type", "TEXT NOT NULL", "incoming, outgoing, missed, voicemail, rejected or blocked"},
+		},
+		keys: 1,
+	},
+}
+
+// WriteSchema writes the CREATE TABLE statements for the exported tables.
+func WriteSchema(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("-- Schema of the tables exported by sbr sql. Each table is in <table>.csv.\n")
+	for _, t := range tableDefs {
+		fmt.Fprintf(&b, "\n-- %s\nCREATE TABLE IF NOT EXISTS %s (\n", t.comment, t.name)
+		for _, c := range t.columns {
+			fmt.Fprintf(&b, "  %s %s,", c.name, c.typ)
+			if c.comment != "" {
+				fmt.Fprintf(&b, " -- %s", c.comment)
+			}
+			b.WriteString("\n")
+		}
+		keys := make([]string, t.keys)
+		for i := range keys {
+			keys[i] = t.columns[i].name
+		}
+		fmt.Fprintf(&b, "  PRIMARY KEY (%s)\n);\n", strings.Join(keys, ", "))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// DB holds the rows of every table, keyed by primary key.
+type DB struct {
+	tables map[string]*table
+}
+
+type table struct {
+	def  *tableDef
+	rows map[string][]string
+}
+
+// NewDB returns an empty DB.
+func NewDB() *DB {
+	db := &DB{tables: make(map[string]*table, len(tableDefs))}
+	for _, def := range tableDefs {
+		db.tables[def.name] = &table{def: def, rows: make(map[string][]string)}
+	}
+	return db
+}
+
+// Len returns the number of rows in the named table.
+func (db *DB) Len(name string) int {
+	return len(db.tables[name].rows)
+}
+
+// upsert inserts row, replacing any row with the same primary key. It returns
+// the row's key and whether the row is new.
+func (t *table) upsert(row []string) (string, bool) {
+	key := strings.Join(row[:t.def.keys], "\x00")
+	_, exists := t.rows[key]
+	t.rows[key] = row
+	return key, !exists
+}
+
+// deleteWhere removes every row whose first column is in values and returns
+// their keys.
+func (t *table) deleteWhere(values map[string]bool) map[string]bool {
+	deleted := make(map[string]bool)
+	for key, row := range t.rows {
+		if values[row[0]] {
+			delete(t.rows, key)
+			deleted[key] = true
+		}
+	}
+	return deleted
+}
+
+// Load reads the tables a previous Save wrote to dir. Missing tables are
+// empty; a table whose columns do not match is an error.
+func Load(dir string) (*DB, error) {
+	db := NewDB()
+	for _, def := range tableDefs {
+		path := filepath.Join(dir, def.name+".csv")
+		f, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		err = db.tables[def.name].read(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+	return db, nil
+}
+
+func (t *table) read(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(t.def.columns)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for i, c := range t.def.columns {
+		if header[i] != c.name {
+			return fmt.Errorf("column %d is %q, want %q", i+1, header[i], c.name)
+		}
+	}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		t.upsert(row)
+	}
+}
+
+// Save writes schema.sql and one <table>.csv per table to dir. Rows are
+// sorted by primary key so that unchanged tables are rewritten identically.
+// Each file is replaced atomically.
+func (db *DB) Save(dir string) error {
+	if err := writeFile(dir, SchemaFile, WriteSchema); err != nil {
+		return err
+	}
+	for _, def := range tableDefs {
+		t := db.tables[def.name]
+		if err := writeFile(dir, def.name+".csv", t.write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *table) write(w io.Writer) error {
+	keys := make([]string, 0, len(t.rows))
+	for k := range t.rows {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	cw := csv.NewWriter(w)
+	header := make([]string, len(t.def.columns))
+	for i, c := range t.def.columns {
+		header[i] = c.name
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := cw.Write(t.rows[k]); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeFile creates dir/name through a temporary file renamed into place.
+func writeFile(dir, name string, render func(io.Writer) error) error {
+	path := filepath.Join(dir, name)
+	tmp, err := os.CreateTemp(dir, ".sbr-*.tmp")
+	if err != nil {
+		return err
+	}
+	err = render(tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package sqlexport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/junkblocker/sbr/backup"
+)
+
+func scan(t *testing.T, source, doc string, fn func(backup.Record)) {
+	t.Helper()
+	s := backup.NewScanner(strings.NewReader(doc))
+	s.Source = source
+	for s.Scan() {
+		fn(s.Record())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+const fullBackup = `<smses>
+  <sms address="+15550001" date="1000" type="1" body="hi, &quot;there&quot;" contact_name="Ann"/>
+  <mms date="2000" address="+15550001" contact_name="Ann" msg_box="1" m_id="m1">
+    <parts>
+      <part seq="0" ct="text/plain" text="look"/>
+      <part seq="1" ct="image/png" cl="cat.png" data="aGVsbG8="/>
+    </parts>
+    <addrs>
+      <addr address="+15550001" type="137"/>
+      <addr address="+15559999" type="151"/>
+    </addrs>
+  </mms>
+</smses>`
+
+const incrementalBackup = `<smses>
+  <sms address="+15550001" date="1000" type="1" body="hi, &quot;there&quot;" contact_name="Ann Lee"/>
+  <sms address="+15550002" date="3000" type="2" body="new" contact_name="Bob"/>
+</smses>`
+
+const callsBackup = `<calls>
+  <call number="+15550001" duration="65" date="4000" type="3" contact_name="Ann"/>
+</calls>`
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+
+	b := NewBuilder(nil)
+	scan(t, "sms-1.xml", fullBackup, b.Add)
+	scan(t, "calls-1.xml", callsBackup, b.Add)
+	b.SetPath("sms-1.xml", int64(strings.Index(fullBackup, "<mms")), 1, "1970-01-01-000002-cat.png")
+	db := NewDB()
+	if added := b.Upsert(db); added != 2+2+3+2+1 {
+		t.Errorf("first export added %d rows", added)
+	}
+	if err := db.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := readCSV(t, filepath.Join(dir, "messages.csv"))
+	if len(messages) != 3 || strings.Join(messages[0], ",") != "id,thread_id,kind,date,direction,sender,body,source" {
+		t.Fatalf("messages.csv = %q", messages)
+	}
+	var sms []string
+	for _, row := range messages[1:] {
+		if row[2] == "sms" {
+			sms = row
+		}
+	}
+	if sms == nil || sms[3] != "1000" || sms[4] != "received" || sms[5] != "+15550001" || sms[6] != `hi, "there"` {
+		t.Errorf("sms row = %q", sms)
+	}
+
+	parts := readCSV(t, filepath.Join(dir, "parts.csv"))
+	if len(parts) != 3 || parts[2][1] != "1" || parts[2][2] != "image/png" || parts[2][3] != "cat.png" || parts[2][4] != "5" || parts[2][5] != "1970-01-01-000002-cat.png" {
+		t.Errorf("parts.csv = %q", parts)
+	}
+	calls := readCSV(t, filepath.Join(dir, "calls.csv"))
+	if len(calls) != 2 || strings.Join(calls[1][1:], ",") != "+15550001,Ann,4000,65,missed" {
+		t.Errorf("calls.csv = %q", calls)
+	}
+
+	// A second run over an incremental backup updates the shared SMS and
+	// keeps everything else.
+	db, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = NewBuilder(nil)
+	scan(t, "sms-2.xml", incrementalBackup, b.Add)
+	if added := b.Upsert(db); added != 3 {
+		t.Errorf("second export added %d rows, want 3 (Bob's thread, message and address)", added)
+	}
+	if db.Len("messages") != 3 || db.Len("calls") != 1 || db.Len("parts") != 2 || db.Len("threads") != 3 {
+		t.Errorf("after upsert: %d messages, %d calls, %d parts, %d threads",
+			db.Len("messages"), db.Len("calls"), db.Len("parts"), db.Len("threads"))
+	}
+	if err = db.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad_WrongColumns(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "calls.csv"), []byte("a,b,c,d,e,f\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil {
+		t.Error("Load accepted a table with the wrong columns")
+	}
+}
+
+func TestWriteSchema(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSchema(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"CREATE TABLE IF NOT EXISTS messages (",
+		"  PRIMARY KEY (message_id, address, role)\n);",
+		"thread_id TEXT NOT NULL REFERENCES threads(id),",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("schema lacks %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// Package stats summarises the contents of SMS Backup & Restore files without
+// extracting anything: message counts, per-contact activity, attachment volume
+// by type and duplication.
+package stats
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/contact"
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/types"
+)
+
+// Report is the result of a statistics pass over one or more backup files.
+// It is designed to be marshalled to JSON as-is.
+type Report struct {
+	Files int `json:"files"`
+	SMS   int `json:"sms"`
+	MMS   int `json:"mms"`
+	// First and Last are the timestamps of the oldest and newest message. They
+	// are zero when no message carried a valid date.
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+
+	Contacts []ContactActivity `json:"contacts"`
+
+	// Attachments counts every MMS part that carries binary data, and
+	// UniqueAttachments those whose content had not been seen before.
+	Attachments       int     `json:"attachments"`
+	UniqueAttachments int     `json:"unique_attachments"`
+	DuplicateRate     float64 `json:"duplicate_rate"`
+	AttachmentBytes   int64   `json:"attachment_bytes"`
+
+	ContentTypes []ContentTypeTotal `json:"content_types"`
+	Largest      []Attachment       `json:"largest"`
+	// UnknownTypes lists content types the extractor does not recognise and
+	// would report as "Unknown".
+	UnknownTypes []ContentTypeTotal `json:"unknown_types"`
+}
+
+// ContactActivity counts the messages exchanged with one contact, per year.
+// Group conversations are reported as a single entry labelled with every
+// participant.
+type ContactActivity struct {
+	Contact   string              `json:"contact"`
+	Addresses []types.PhoneNumber `json:"addresses"`
+	Total     int                 `json:"total"`
+	ByYear    map[int]int         `json:"by_year"`
+}
+
+// ContentTypeTotal aggregates the parts of one (lowercased) content type.
+type ContentTypeTotal struct {
+	ContentType string `json:"content_type"`
+	Count       int    `json:"count"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// Attachment describes a single MMS part in the Largest list.
+type Attachment struct {
+	Date        time.Time `json:"date"`
+	Contact     string    `json:"contact"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Bytes       int64     `json:"bytes"`
+
+	// addrKey is the conversation key the attachment was counted under; the
+	// Contact label is filled in from it when the report is built.
+	addrKey string
+}
+
+// Collector accumulates records into a Report. It is not safe for concurrent
+// use; feed it from a single goroutine.
+type Collector struct {
+	topN     int
+	resolver *contact.Resolver
+	report   Report
+	// byAddr counts messages per conversation key (the sorted, normalised
+	// addresses joined with '~'). Keys are folded into identities only when
+	// the report is built, once every contact name has been observed.
+	byAddr  map[string]*ContactActivity
+	types   map[string]*ContentTypeTotal
+	unknown map[string]*ContentTypeTotal
+	seen    map[[sha256.Size]byte]struct{}
+}
+
+// NewCollector returns a Collector that keeps the topN largest attachments and
+// groups messages into contacts with resolver. A nil resolver normalises
+// addresses without a default country.
+func NewCollector(topN int, resolver *contact.Resolver) *Collector {
+	if resolver == nil {
+		resolver = contact.NewResolver(nil)
+	}
+	return &Collector{
+		topN:     topN,
+		resolver: resolver,
+		byAddr:   make(map[string]*ContactActivity),
+		types:    make(map[string]*ContentTypeTotal),
+		unknown:  make(map[string]*ContentTypeTotal),
+		seen:     make(map[[sha256.Size]byte]struct{}),
+	}
+}
+
+// AddFile records that one more input file has been scanned.
+func (c *Collector) AddFile() {
+	c.report.Files++
+}
+
+// Add folds one record into the statistics.
+func (c *Collector) Add(rec backup.Record) {
+	switch rec.Kind {
+	case backup.KindSMS:
+		c.report.SMS++
+		c.resolver.Observe(rec.SMS.Address, rec.SMS.ContactName)
+		c.addMessage(c.addrKey(rec.SMS.Address), rec.SMS.Date)
+	case backup.KindMMS:
+		c.report.MMS++
+		c.resolver.Observe(rec.MMS.Address, rec.MMS.ContactName)
+		key := c.addrKey(rec.MMS.Address)
+		when := c.addMessage(key, rec.MMS.Date)
+		for _, part := range rec.MMS.Parts {
+			c.addPart(key, when, part.ContentType, processor.PartName(part), part.Data)
+		}
+	}
+}
+
+// addrKey returns the conversation key for a message's address attribute.
+func (c *Collector) addrKey(address types.PhoneNumber) string {
+	var addrs []string
+	for _, a := range contact.SplitAddresses(address) {
+		if n := c.resolver.Normalise(a); n != "" && !c.resolver.IsOwner(n) {
+			addrs = append(addrs, string(n))
+		}
+	}
+	sort.Strings(addrs)
+	return strings.Join(addrs, "~")
+}
+
+// addMessage counts one message under key and returns its timestamp (zero if
+// the date attribute is unusable).
+func (c *Collector) addMessage(key, dateMillis string) time.Time {
+	ca := c.byAddr[key]
+	if ca == nil {
+		ca = &ContactActivity{ByYear: make(map[int]int)}
+		c.byAddr[key] = ca
+	}
+	ca.Total++
+
+	ms, err := strconv.ParseInt(dateMillis, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	when := time.UnixMilli(ms)
+	ca.ByYear[when.Year()]++
+	if c.report.First.IsZero() || when.Before(c.report.First) {
+		c.report.First = when
+	}
+	if when.After(c.report.Last) {
+		c.report.Last = when
+	}
+	return when
+}
+
+func (c *Collector) addPart(key string, when time.Time, contentType, name, data string) {
+	ct := strings.ToLower(contentType)
+	if !processor.KnownContentType(ct) {
+		total(c.unknown, ct).Count++
+	}
+	if data == "" || data == "null" {
+		return
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return
+	}
+	size := int64(len(raw))
+
+	t := total(c.types, ct)
+	t.Count++
+	t.Bytes += size
+	c.report.Attachments++
+	c.report.AttachmentBytes += size
+
+	sum := sha256.Sum256(raw)
+	if _, dup := c.seen[sum]; !dup {
+		c.seen[sum] = struct{}{}
+		c.report.UniqueAttachments++
+	}
+
+	c.considerLargest(Attachment{Date: when, Name: name, ContentType: ct, Bytes: size, addrKey: key})
+}
+
+// considerLargest inserts a into the Largest list if it ranks among the topN.
+func (c *Collector) considerLargest(a Attachment) {
+	largest := c.report.Largest
+	if c.topN <= 0 || (len(largest) == c.topN && a.Bytes <= largest[len(largest)-1].Bytes) {
+		return
+	}
+	i := sort.Search(len(largest), func(i int) bool { return largest[i].Bytes < a.Bytes })
+	largest = append(largest, Attachment{})
+	copy(largest[i+1:], largest[i:])
+	largest[i] = a
+	if len(largest) > c.topN {
+		largest = largest[:c.topN]
+	}
+	c.report.Largest = largest
+}
+
+// Report returns the statistics gathered so far. Contacts are ordered by
+// descending message count and content types by descending byte total.
+func (c *Collector) Report() Report {
+	r := c.report
+	if r.Attachments > 0 {
+		r.DuplicateRate = float64(r.Attachments-r.UniqueAttachments) / float64(r.Attachments)
+	}
+
+	// Fold conversation keys into identities: two keys whose addresses resolve
+	// to the same people are reported together.
+	byIdentity := make(map[string]*ContactActivity)
+	for key, counts := range c.byAddr {
+		id, label, addrs := c.identify(key)
+		ca := byIdentity[id]
+		if ca == nil {
+			ca = &ContactActivity{Contact: label, Addresses: addrs, ByYear: make(map[int]int)}
+			byIdentity[id] = ca
+		}
+		ca.Total += counts.Total
+		for y, n := range counts.ByYear {
+			ca.ByYear[y] += n
+		}
+	}
+	r.Contacts = make([]ContactActivity, 0, len(byIdentity))
+	for _, ca := range byIdentity {
+		r.Contacts = append(r.Contacts, *ca)
+	}
+	sort.Slice(r.Contacts, func(i, j int) bool {
+		if r.Contacts[i].Total != r.Contacts[j].Total {
+			return r.Contacts[i].Total > r.Contacts[j].Total
+		}
+		return r.Contacts[i].Contact < r.Contacts[j].Contact
+	})
+
+	r.Largest = make([]Attachment, len(c.report.Largest))
+	for i, a := range c.report.Largest {
+		_, a.Contact, _ = c.identify(a.addrKey)
+		r.Largest[i] = a
+	}
+
+	r.ContentTypes = sortedTotals(c.types)
+	r.UnknownTypes = sortedTotals(c.unknown)
+	return r
+}
+
+// identify resolves a conversation key into a stable identity key, a display
+// label and the addresses involved.
+func (c *Collector) identify(key string) (id, label string, addrs []types.PhoneNumber) {
+	if key == "" {
+		return "", "(Unknown)", nil
+	}
+	var ids, labels []string
+	for _, a := range strings.Split(key, "~") {
+		ident := c.resolver.Resolve(types.PhoneNumber(a))
+		ids = append(ids, ident.ID)
+		labels = append(labels, ident.Label())
+		addrs = append(addrs, ident.Addresses...)
+	}
+	return strings.Join(ids, "~"), strings.Join(labels, ", "), addrs
+}
+
+func total(m map[string]*ContentTypeTotal, ct string) *ContentTypeTotal {
+	t := m[ct]
+	if t == nil {
+		t = &ContentTypeTotal{ContentType: ct}
+		m[ct] = t
+	}
+	return t
+}
+
+func sortedTotals(m map[string]*ContentTypeTotal) []ContentTypeTotal {
+	out := make([]ContentTypeTotal, 0, len(m))
+	for _, t := range m {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Bytes != out[j].Bytes {
+			return out[i].Bytes > out[j].Bytes
+		}
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].ContentType < out[j].ContentType
+	})
+	return out
+}
@@ -0,0 +1,99 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/junkblocker/sbr/backup"
+)
+
+func enc(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+func collect(t *testing.T, doc string, topN int) Report {
+	t.Helper()
+	c := NewCollector(topN, nil)
+	c.AddFile()
+	s := backup.NewScanner(strings.NewReader(doc))
+	for s.Scan() {
+		c.Add(s.Record())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return c.Report()
+}
+
+func TestCollector(t *testing.T) {
+	// 2023-06-01 and 2024-01-15 (UTC); years are computed in local time, so
+	// keep the timestamps well away from New Year.
+	const y2023, y2024 = "1685620800000", "1705318245000"
+	doc := `<smses>
+  <sms address="+1" date="` + y2023 + `" body="a" contact_name="Ann"/>
+  <sms address="+1" date="` + y2024 + `" body="b" contact_name="Ann"/>
+  <sms address="+9" date="` + y2024 + `" body="c" contact_name="(Unknown)"/>
+  <mms date="` + y2024 + `" address="+1" contact_name="Ann">
+    <parts>
+      <part seq="0" ct="application/smil" data="null" text="&lt;smil/&gt;"/>
+      <part seq="1" ct="image/JPEG" cl="big.jpg" data="` + enc("0123456789") + `"/>
+      <part seq="2" ct="image/png" cl="small.png" data="` + enc("xy") + `"/>
+      <part seq="3" ct="text/x-vcalendar" data="` + enc("BEGIN") + `"/>
+    </parts>
+  </mms>
+  <mms date="` + y2024 + `" address="+1" contact_name="Ann">
+    <parts><part seq="0" ct="image/jpeg" cl="again.jpg" data="` + enc("0123456789") + `"/></parts>
+  </mms>
+</smses>`
+
+	r := collect(t, doc, 2)
+
+	if r.Files != 1 || r.SMS != 3 || r.MMS != 2 {
+		t.Errorf("counts = files %d sms %d mms %d, want 1/3/2", r.Files, r.SMS, r.MMS)
+	}
+	if !r.First.Equal(time.UnixMilli(1685620800000)) || !r.Last.Equal(time.UnixMilli(1705318245000)) {
+		t.Errorf("range = %v – %v", r.First, r.Last)
+	}
+
+	if len(r.Contacts) != 2 || r.Contacts[0].Contact != "Ann" || r.Contacts[0].Total != 4 {
+		t.Fatalf("contacts = %+v", r.Contacts)
+	}
+	if r.Contacts[0].ByYear[2023] != 1 || r.Contacts[0].ByYear[2024] != 3 {
+		t.Errorf("Ann by year = %v", r.Contacts[0].ByYear)
+	}
+	if r.Contacts[1].Contact != "+9" {
+		t.Errorf("unknown contact should fall back to address, got %q", r.Contacts[1].Contact)
+	}
+
+	if r.Attachments != 4 || r.UniqueAttachments != 3 {
+		t.Errorf("attachments = %d unique %d, want 4/3", r.Attachments, r.UniqueAttachments)
+	}
+	if r.DuplicateRate != 0.25 {
+		t.Errorf("DuplicateRate = %v, want 0.25", r.DuplicateRate)
+	}
+	if r.AttachmentBytes != 27 {
+		t.Errorf("AttachmentBytes = %d, want 27", r.AttachmentBytes)
+	}
+	if r.ContentTypes[0].ContentType != "image/jpeg" || r.ContentTypes[0].Count != 2 || r.ContentTypes[0].Bytes != 20 {
+		t.Errorf("top content type = %+v", r.ContentTypes[0])
+	}
+
+	if len(r.Largest) != 2 || r.Largest[0].Bytes != 10 || r.Largest[1].Bytes != 10 {
+		t.Errorf("largest = %+v", r.Largest)
+	}
+
+	if len(r.UnknownTypes) != 1 || r.UnknownTypes[0].ContentType != "text/x-vcalendar" {
+		t.Errorf("unknown types = %+v", r.UnknownTypes)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTable(&buf, r, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"image/jpeg", "big.jpg", "text/x-vcalendar", "Ann", "25.0%"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("table output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/junkblocker/sbr/types"
+)
+
+// WriteTable renders r as human-readable aligned tables. maxContacts limits the
+// per-contact section (0 means no limit).
+func WriteTable(w io.Writer, r Report, maxContacts int) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Files\t%d\n", r.Files)
+	fmt.Fprintf(tw, "SMS\t%d\n", r.SMS)
+	fmt.Fprintf(tw, "MMS\t%d\n", r.MMS)
+	if !r.First.IsZero() {
+		fmt.Fprintf(tw, "Date range\t%s – %s\n", r.First.Format(time.DateTime), r.Last.Format(time.DateTime))
+	}
+	fmt.Fprintf(tw, "Attachments\t%d (%s)\n", r.Attachments, types.FormatBytes(r.AttachmentBytes))
+	fmt.Fprintf(tw, "Unique attachments\t%d\n", r.UniqueAttachments)
+	fmt.Fprintf(tw, "Duplicate rate\t%.1f%%\n", r.DuplicateRate*100)
+
+	if len(r.ContentTypes) > 0 {
+		fmt.Fprintln(tw, "\nCONTENT TYPE\tCOUNT\tBYTES")
+		for _, t := range r.ContentTypes {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", t.ContentType, t.Count, types.FormatBytes(t.Bytes))
+		}
+	}
+
+	if len(r.Largest) > 0 {
+		fmt.Fprintln(tw, "\nLARGEST\tBYTES\tDATE\tCONTACT\tTYPE")
+		for _, a := range r.Largest {
+			name := a.Name
+			if name == "" {
+				name = "(unnamed)"
+			}
+			date := ""
+			if !a.Date.IsZero() {
+				date = a.Date.Format(time.DateTime)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", name, types.FormatBytes(a.Bytes), date, a.Contact, a.ContentType)
+		}
+	}
+
+	if len(r.UnknownTypes) > 0 {
+		fmt.Fprintln(tw, "\nUNKNOWN CONTENT TYPE\tCOUNT")
+		for _, t := range r.UnknownTypes {
+			fmt.Fprintf(tw, "%s\t%d\n", t.ContentType, t.Count)
+		}
+	}
+
+	if len(r.Contacts) > 0 {
+		years := contactYears(r.Contacts)
+		header := []string{"CONTACT", "TOTAL"}
+		for _, y := range years {
+			header = append(header, fmt.Sprint(y))
+		}
+		fmt.Fprintln(tw, "\n"+strings.Join(header, "\t"))
+		for i, ca := range r.Contacts {
+			if maxContacts > 0 && i == maxContacts {
+				fmt.Fprintf(tw, "… %d more\n", len(r.Contacts)-maxContacts)
+				break
+			}
+			row := []string{ca.Contact, fmt.Sprint(ca.Total)}
+			for _, y := range years {
+				row = append(row, fmt.Sprint(ca.ByYear[y]))
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+	}
+
+	return tw.Flush()
+}
+
+// contactYears returns every year that appears in any contact's activity, in
+// ascending order.
+func contactYears(contacts []ContactActivity) []int {
+	set := make(map[int]bool)
+	for _, ca := range contacts {
+		for y := range ca.ByYear {
+			set[y] = true
+		}
+	}
+	years := make([]int, 0, len(set))
+	for y := range set {
+		years = append(years, y)
+	}
+	sort.Ints(years)
+	return years
+}
@@ -0,0 +1,416 @@
+// Package thread reconstructs conversations from the flat list of SMS and MMS
+// records in a backup: which messages belong together, who took part, whether
+// it is a group chat, and which messages the owner sent.
+package thread
+
+import (
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/contact"
+	"github.com/junkblocker/sbr/processor"
+	"github.com/junkblocker/sbr/rcs"
+	"github.com/junkblocker/sbr/smil"
+	"github.com/junkblocker/sbr/types"
+)
+
+// Direction says whether a message was sent by the backup owner or received.
+type Direction int
+
+const (
+	Received Direction = iota
+	Sent
+)
+
+func (d Direction) String() string {
+	if d == Sent {
+		return "sent"
+	}
+	return "received"
+}
+
+// Part describes one MMS attachment. Only metadata is kept so that a whole
+// backup's worth of threads fits in memory; the payload stays in the backup.
+type Part struct {
+	// Index is the 0-based position of the part within its MMS.
+	Index       int
+	ContentType string
+	// Name is the cl or name attribute, or "" if the part is unnamed.
+	Name string
+	// Size is the decoded size of the payload in bytes.
+	Size int64
+}
+
+// Slide is one page of an MMS presentation, as laid out by its SMIL part.
+type Slide struct {
+	// Number is the 1-based position of the slide.
+	Number int
+	// Text is the text shown on the slide.
+	Text string
+	// Parts are the media shown or played on the slide.
+	Parts []Part
+}
+
+// Message is one SMS or MMS within a thread.
+type Message struct {
+	Kind      backup.Kind
+	Time      time.Time
+	Direction Direction
+	// Sender is the identity that sent a received message; nil for messages
+	// the owner sent.
+	Sender *contact.Identity
+	// Body is the SMS body, or the MMS text parts joined with newlines. RCS
+	// business messages contribute their card titles and descriptions.
+	Body  string
+	Parts []Part
+	// Slides is the MMS presentation in slide order, or nil when the message
+	// has no usable SMIL part. Every part on a slide is also listed in Parts.
+	Slides []Slide
+	// Source and Offset locate the record in its backup file.
+	Source string
+	Offset int64
+
+	// addrs holds the raw participant addresses until the thread is resolved.
+	addrs    []types.PhoneNumber
+	sender   types.PhoneNumber
+	threadID string
+}
+
+// Thread is a conversation: every message exchanged with the same set of
+// participants.
+type Thread struct {
+	// ID is a stable identifier derived from the participants' identity IDs.
+	ID           string
+	Participants []*contact.Identity
+	// Group is true when the conversation has more than one participant
+	// besides the owner.
+	Group    bool
+	Messages []*Message
+}
+
+// Title returns a display name for the thread: the participants' labels
+// joined with ", ".
+func (t *Thread) Title() string {
+	if len(t.Participants) == 0 {
+		return "(Unknown)"
+	}
+	labels := make([]string, len(t.Participants))
+	for i, p := range t.Participants {
+		labels[i] = p.Label()
+	}
+	return strings.Join(labels, ", ")
+}
+
+// Builder accumulates records and groups them into threads. Threads are only
+// resolved when Threads is called, so contact names seen late in the backup
+// still apply to early messages.
+type Builder struct {
+	resolver *contact.Resolver
+	messages []*Message
+	// seen holds the IDs of the records added, so that a message found in
+	// more than one backup is only listed once.
+	seen map[string]bool
+}
+
+// NewBuilder returns a Builder that resolves participants with r. A nil r
+// normalises addresses without a default country.
+func NewBuilder(r *contact.Resolver) *Builder {
+	if r == nil {
+		r = contact.NewResolver(nil)
+	}
+	return &Builder{resolver: r, seen: make(map[string]bool)}
+}
+
+// Add records one backup record. A record with the same ID as one already
+// added, such as a message in both a full and an incremental backup, is
+// skipped.
+func (b *Builder) Add(rec backup.Record) {
+	if rec.Kind != backup.KindSMS && rec.Kind != backup.KindMMS {
+		return
+	}
+	id := rec.ID()
+	if b.seen[id] {
+		return
+	}
+	b.seen[id] = true
+	switch rec.Kind {
+	case backup.KindSMS:
+		b.addSMS(rec)
+	case backup.KindMMS:
+		b.addMMS(rec)
+	}
+}
+
+func (b *Builder) addSMS(rec backup.Record) {
+	sms := rec.SMS
+	b.resolver.Observe(sms.Address, sms.ContactName)
+	m := &Message{
+		Kind:      backup.KindSMS,
+		Time:      parseMillis(sms.Date),
+		Direction: smsDirection(sms.Type),
+		Body:      sms.Body,
+		Source:    rec.Source,
+		Offset:    rec.Offset,
+		addrs:     contact.SplitAddresses(sms.Address),
+		threadID:  sms.ThreadID,
+	}
+	if m.Direction == Received {
+		m.sender = sms.Address
+	}
+	b.messages = append(b.messages, m)
+}
+
+func (b *Builder) addMMS(rec backup.Record) {
+	mms := rec.MMS
+	b.resolver.Observe(mms.Address, mms.ContactName)
+
+	m := &Message{
+		Kind:     backup.KindMMS,
+		Time:     parseMillis(mms.Date),
+		Source:   rec.Source,
+		Offset:   rec.Offset,
+		threadID: mms.ThreadID,
+	}
+
+	var from types.PhoneNumber
+	for _, a := range mms.Addresses {
+		if !a.Address.Usable() {
+			continue
+		}
+		m.addrs = append(m.addrs, a.Address)
+		if a.Type == types.MMSAddrFrom {
+			from = a.Address
+		}
+	}
+	if len(m.addrs) == 0 {
+		m.addrs = contact.SplitAddresses(mms.Address)
+	}
+
+	switch mms.MessageBox {
+	case types.MessageBoxSent, types.MessageBoxDrafts, types.MessageBoxOutbox:
+		m.Direction = Sent
+		// The "from" address of a sent message is the owner's own number.
+		if from != "" {
+			b.resolver.SetOwner(from)
+		}
+	case types.MessageBoxInbox:
+		m.Direction = Received
+	default:
+		if from != "" && b.resolver.IsOwner(from) {
+			m.Direction = Sent
+		}
+	}
+	if m.Direction == Received {
+		m.sender = from
+		if m.sender == "" {
+			m.sender = mms.Address
+		}
+	}
+
+	var texts []string
+	for i, p := range mms.Parts {
+		ct := strings.ToLower(p.ContentType)
+		switch {
+		case ct == "text/plain":
+			if text, err := processor.PartText(p); err == nil && text != "" {
+				texts = append(texts, text)
+			}
+		case ct == "application/smil":
+			// Layout only.
+		case ct == rcs.ContentType:
+			if summary := botSummary(p); summary != "" {
+				texts = append(texts, summary)
+			}
+		default:
+			m.Parts = append(m.Parts, Part{
+				Index:       i,
+				ContentType: ct,
+				Name:        processor.PartName(p),
+				Size:        p.DecodedSize(),
+			})
+		}
+	}
+	if body := strings.TrimSpace(mms.Body); body != "" && body != "null" {
+		texts = append(texts, body)
+	}
+	m.Body = strings.Join(texts, "\n")
+	m.Slides = buildSlides(mms, m.Parts)
+
+	b.messages = append(b.messages, m)
+}
+
+// buildSlides lays out an MMS's parts according to its SMIL presentation.
+// Presentations that cannot be parsed are ignored; the message is then shown
+// as a flat body and part list.
+func buildSlides(mms *types.MMS, parts []Part) []Slide {
+	presentation, err := smil.ForMMS(mms)
+	if err != nil || len(presentation) == 0 {
+		return nil
+	}
+	byIndex := make(map[int]Part, len(parts))
+	for _, p := range parts {
+		byIndex[p.Index] = p
+	}
+
+	slides := make([]Slide, 0, len(presentation))
+	for _, ps := range presentation {
+		slide := Slide{Number: ps.Number}
+		var texts []string
+		for _, ref := range ps.Refs {
+			if ref.Part < 0 {
+				continue
+			}
+			if p, ok := byIndex[ref.Part]; ok {
+				slide.Parts = append(slide.Parts, p)
+				continue
+			}
+			p := mms.Parts[ref.Part]
+			if !strings.EqualFold(p.ContentType, "text/plain") {
+				continue
+			}
+			if text, err := processor.PartText(p); err == nil && text != "" {
+				texts = append(texts, text)
+			}
+		}
+		slide.Text = strings.Join(texts, "\n")
+		slides = append(slides, slide)
+	}
+	return slides
+}
+
+// Threads groups the messages added so far into threads. Messages are joined
+// when they share a thread_id or resolve to the same set of participants.
+// Threads are ordered by their most recent message, newest first; messages
+// within a thread are in chronological order.
+func (b *Builder) Threads() []*Thread {
+	// Union-find over message indices, keyed by thread_id and participant set.
+	parent := make([]int, len(b.messages))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	firstByKey := make(map[string]int)
+	join := func(key string, i int) {
+		if j, ok := firstByKey[key]; ok {
+			parent[find(i)] = find(j)
+		} else {
+			firstByKey[key] = i
+		}
+	}
+
+	participants := make([][]*contact.Identity, len(b.messages))
+	for i, m := range b.messages {
+		participants[i] = b.resolver.Participants(m.addrs)
+		join("p:"+identityKey(participants[i]), i)
+		if m.threadID != "" && m.threadID != "null" {
+			join("t:"+m.threadID, i)
+		}
+		if m.Direction == Received && m.sender != "" && !b.resolver.IsOwner(m.sender) {
+			m.Sender = b.resolver.Resolve(m.sender)
+		}
+	}
+
+	byRoot := make(map[int]*Thread)
+	var threads []*Thread
+	for i, m := range b.messages {
+		root := find(i)
+		t := byRoot[root]
+		if t == nil {
+			t = &Thread{}
+			byRoot[root] = t
+			threads = append(threads, t)
+		}
+		t.Participants = mergeIdentities(t.Participants, participants[i])
+		t.Messages = append(t.Messages, m)
+	}
+
+	for _, t := range threads {
+		t.ID = identityKey(t.Participants)
+		t.Group = len(t.Participants) > 1
+		sort.SliceStable(t.Messages, func(i, j int) bool {
+			return t.Messages[i].Time.Before(t.Messages[j].Time)
+		})
+	}
+	sort.SliceStable(threads, func(i, j int) bool {
+		return threads[i].last().After(threads[j].last())
+	})
+	return threads
+}
+
+func (t *Thread) last() time.Time {
+	if len(t.Messages) == 0 {
+		return time.Time{}
+	}
+	return t.Messages[len(t.Messages)-1].Time
+}
+
+// identityKey joins the IDs of an ID-sorted identity list.
+func identityKey(ids []*contact.Identity) string {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = id.ID
+	}
+	return strings.Join(keys, "~")
+}
+
+// mergeIdentities returns the sorted union of two ID-sorted identity lists.
+func mergeIdentities(a, b []*contact.Identity) []*contact.Identity {
+	seen := make(map[string]bool, len(a))
+	out := append([]*contact.Identity(nil), a...)
+	for _, id := range a {
+		seen[id.ID] = true
+	}
+	for _, id := range b {
+		if !seen[id.ID] {
+			seen[id.ID] = true
+			out = append(out, id)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// smsDirection maps an SMS type to a direction: everything except the inbox
+// originated on the owner's phone.
+func smsDirection(t types.SMSMessageType) Direction {
+	if t == types.SMSInbox {
+		return Received
+	}
+	return Sent
+}
+
+// botSummary returns the card titles and descriptions of an RCS bot message
+// part, or "" if it has none or cannot be parsed.
+func botSummary(p types.MMSPart) string {
+	raw := []byte(p.Text)
+	if p.Text == "" || p.Text == "null" {
+		var err error
+		if raw, err = base64.StdEncoding.DecodeString(p.Data); err != nil {
+			return ""
+		}
+	}
+	m, err := rcs.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return m.Summary()
+}
+
+func parseMillis(s string) time.Time {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,184 @@
+package thread
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/junkblocker/sbr/backup"
+	"github.com/junkblocker/sbr/contact"
+)
+
+// build scans doc and returns the resulting threads.
+func build(t *testing.T, doc string) []*Thread {
+	t.Helper()
+	n, err := contact.NewNormaliser("US")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBuilder(contact.NewResolver(n))
+	s := backup.NewScanner(strings.NewReader(doc))
+	for s.Scan() {
+		b.Add(s.Record())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Threads()
+}
+
+const groupDoc = `<smses>
+<sms address="(555) 111-2222" date="1000" type="1" body="hi" contact_name="Ann"/>
+<sms address="5551112222" date="2000" type="2" body="hey" contact_name="Ann"/>
+<mms date="3000" address="5551112222~5553334444" msg_box="1" thread_id="7" contact_name="Ann, Bob">
+  <parts>
+    <part seq="0" ct="application/smil" text="&lt;smil/&gt;"/>
+    <part seq="1" ct="text/plain" text="look"/>
+    <part seq="2" ct="image/jpeg" cl="p.jpg" data="aGVsbG8="/>
+  </parts>
+  <addrs>
+    <addr address="5553334444" type="137"/>
+    <addr address="5551112222" type="151"/>
+    <addr address="5550000000" type="151"/>
+  </addrs>
+</mms>
+<mms date="4000" address="5551112222~5553334444" msg_box="2" thread_id="7">
+  <parts><part seq="0" ct="text/plain" text="nice"/></parts>
+  <addrs>
+    <addr address="5550000000" type="137"/>
+    <addr address="5551112222" type="151"/>
+    <addr address="5553334444" type="151"/>
+  </addrs>
+</mms>
+</smses>`
+
+func TestBuilder_GroupAndDirectThreads(t *testing.T) {
+	threads := build(t, groupDoc)
+	if len(threads) != 2 {
+		t.Fatalf("got %d threads, want 2", len(threads))
+	}
+
+	// Newest thread first: the group MMS conversation.
+	group, direct := threads[0], threads[1]
+	if !group.Group || group.Title() != "Ann, Bob" {
+		t.Errorf("group thread = %q group=%v", group.Title(), group.Group)
+	}
+	if direct.Group || direct.Title() != "Ann" || len(direct.Messages) != 2 {
+		t.Errorf("direct thread = %q group=%v msgs=%d", direct.Title(), direct.Group, len(direct.Messages))
+	}
+
+	// The owner's number, learned from the sent MMS, is not a participant.
+	for _, p := range group.Participants {
+		if p.ID == "+15550000000" {
+			t.Error("owner listed as participant")
+		}
+	}
+
+	recv, sent := group.Messages[0], group.Messages[1]
+	if recv.Direction != Received || recv.Sender == nil || recv.Sender.Label() != "Bob" {
+		t.Errorf("received MMS direction=%v sender=%+v", recv.Direction, recv.Sender)
+	}
+	if recv.Body != "look" || len(recv.Parts) != 1 || recv.Parts[0].Name != "p.jpg" || recv.Parts[0].Size != 5 {
+		t.Errorf("received MMS body=%q parts=%+v", recv.Body, recv.Parts)
+	}
+	if sent.Direction != Sent || sent.Sender != nil {
+		t.Errorf("sent MMS direction=%v sender=%+v", sent.Direction, sent.Sender)
+	}
+
+	if direct.Messages[0].Direction != Received || direct.Messages[1].Direction != Sent {
+		t.Error("SMS directions not derived from type")
+	}
+}
+
+func TestBuilder_ThreadIDJoinsChangedParticipants(t *testing.T) {
+	// Same thread_id, but the second message's address could not be resolved
+	// to the same participant set; thread_id keeps them together.
+	threads := build(t, `<smses>
+<mms date="1000" address="5551112222" msg_box="1" thread_id="3"><parts/><addrs><addr address="5551112222" type="137"/></addrs></mms>
+<mms date="2000" address="5559998888" msg_box="1" thread_id="3"><parts/><addrs><addr address="5559998888" type="137"/></addrs></mms>
+</smses>`)
+	if len(threads) != 1 || len(threads[0].Messages) != 2 {
+		t.Fatalf("expected one thread with 2 messages, got %d threads", len(threads))
+	}
+}
+
+func TestBuilder_SameFileTwice(t *testing.T) {
+	b := NewBuilder(nil)
+	for range 2 {
+		s := backup.NewScanner(strings.NewReader(groupDoc))
+		for s.Scan() {
+			b.Add(s.Record())
+		}
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n := 0
+	for _, th := range b.Threads() {
+		n += len(th.Messages)
+	}
+	if n != 4 {
+		t.Errorf("got %d messages, want 4", n)
+	}
+}
+
+func TestBuilder_Slides(t *testing.T) {
+	doc := `<smses><mms date="1000" address="5551112222" msg_box="1">
+  <parts>
+    <part seq="0" ct="application/smil" text="&lt;smil&gt;&lt;body&gt;&lt;par&gt;&lt;img src=&quot;b.jpg&quot;/&gt;&lt;text src=&quot;t.txt&quot;/&gt;&lt;/par&gt;&lt;par&gt;&lt;img src=&quot;a.jpg&quot;/&gt;&lt;/par&gt;&lt;/body&gt;&lt;/smil&gt;"/>
+    <part seq="1" ct="image/jpeg" cl="a.jpg" data="aGVsbG8="/>
+    <part seq="2" ct="image/jpeg" cl="b.jpg" data="aGVsbG8="/>
+    <part seq="3" ct="text/plain" cl="t.txt" text="caption"/>
+  </parts>
+</mms></smses>`
+	threads := build(t, doc)
+	if len(threads) != 1 || len(threads[0].Messages) != 1 {
+		t.Fatalf("unexpected threads %+v", threads)
+	}
+	slides := threads[0].Messages[0].Slides
+	if len(slides) != 2 {
+		t.Fatalf("got %d slides, want 2", len(slides))
+	}
+	if len(slides[0].Parts) != 1 || slides[0].Parts[0].Name != "b.jpg" || slides[0].Text != "caption" {
+		t.Errorf("slide 1 = %+v, want b.jpg with caption", slides[0])
+	}
+	if len(slides[1].Parts) != 1 || slides[1].Parts[0].Name != "a.jpg" || slides[1].Text != "" {
+		t.Errorf("slide 2 = %+v, want a.jpg only", slides[1])
+	}
+}
+
+func TestBuilder_BotMessageText(t *testing.T) {
+	card := base64.StdEncoding.EncodeToString([]byte(`{"message":{"generalPurposeCard":{"content":{"title":"Parcel delivered","description":"Left at front door"}}}}`))
+	threads := build(t, `<smses><mms date="1000" address="Courier" msg_box="1"><parts>
+<part seq="0" ct="application/vnd.gsma.botmessage.v1.0+json" text="null" data="`+card+`"/>
+</parts></mms></smses>`)
+	if len(threads) != 1 {
+		t.Fatalf("got %d threads, want 1", len(threads))
+	}
+	m := threads[0].Messages[0]
+	if m.Body != "Parcel delivered\nLeft at front door" {
+		t.Errorf("Body = %q", m.Body)
+	}
+	if len(m.Parts) != 0 {
+		t.Errorf("bot message listed as attachment: %+v", m.Parts)
+	}
+}
+
+func TestBuilder_CharsetTextAndNames(t *testing.T) {
+	// Shift_JIS: the text as base64 data, the name as one character per byte.
+	text := base64.StdEncoding.EncodeToString([]byte{0x93, 0xfa, 0x96, 0x7b})
+	threads := build(t, `<smses><mms date="1000" address="5551112222" msg_box="1"><parts>
+<part seq="0" ct="text/plain" chset="17" text="null" data="`+text+`"/>
+<part seq="1" ct="image/jpeg" chset="17" cl="`+"\u0093ú\u0096{.jpg"+`" data="aGk="/>
+</parts></mms></smses>`)
+	if len(threads) != 1 {
+		t.Fatalf("got %d threads, want 1", len(threads))
+	}
+	m := threads[0].Messages[0]
+	if m.Body != "日本" {
+		t.Errorf("Body = %q, want %q", m.Body, "日本")
+	}
+	if len(m.Parts) != 1 || m.Parts[0].Name != "日本.jpg" {
+		t.Errorf("Parts = %+v, want 日本.jpg", m.Parts)
+	}
+}
@@ -0,0 +1,19 @@
+package types
+
+import "testing"
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[int64]string{
+		0:           "0 B",
+		1023:        "1023 B",
+		1024:        "1.0 KiB",
+		1536:        "1.5 KiB",
+		5 << 20:     "5.0 MiB",
+		3 << 30 / 2: "1.5 GiB",
+	}
+	for n, want := range cases {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
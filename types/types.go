@@ -1,7 +1,9 @@
 package types
 
 import (
+	"encoding/base64"
 	"encoding/xml"
+	"strings"
 )
 
 type (
@@ -14,30 +16,84 @@ type (
 	CallType       int
 )
 
+// Usable reports whether a is a real address rather than empty, "null", or
+// the placeholder the framework stores for the owner's address in sent MMS
+// before the carrier fills it in.
+func (a PhoneNumber) Usable() bool {
+	s := strings.TrimSpace(string(a))
+	return s != "" && s != "null" && s != "insert-address-token"
+}
+
 type SMS struct {
-	XMLName xml.Name    `xml:"sms"`
-	Address PhoneNumber `xml:"address,attr"`
-	Body    string      `xml:"body,attr"`
-	Date    string      `xml:"date,attr"`
+	XMLName      xml.Name       `xml:"sms"`
+	Address      PhoneNumber    `xml:"address,attr"`
+	Body         string         `xml:"body,attr"`
+	Date         string         `xml:"date,attr"`
+	Type         SMSMessageType `xml:"type,attr"`
+	ThreadID     string         `xml:"thread_id,attr"`
+	ReadableDate string         `xml:"readable_date,attr"`
+	ContactName  string         `xml:"contact_name,attr"`
 }
 
+// SMS type values (Telephony.TextBasedSmsColumns in the Android framework).
+const (
+	SMSInbox  SMSMessageType = 1
+	SMSSent   SMSMessageType = 2
+	SMSDraft  SMSMessageType = 3
+	SMSOutbox SMSMessageType = 4
+	SMSFailed SMSMessageType = 5
+	SMSQueued SMSMessageType = 6
+)
+
 type MMS struct {
-	XMLName           xml.Name      `xml:"mms"`
-	TextOnly          BoolValue     `xml:"text_only,attr"`
-	Read              ReadStatus    `xml:"read,attr"`
-	Date              string        `xml:"date,attr"`
-	Locked            BoolValue     `xml:"locked,attr"`
-	DateSent          AndroidTS     `xml:"date_sent,attr"`
-	ReadableDate      string        `xml:"readable_date,attr"`
-	ContactName       string        `xml:"contact_name,attr"`
-	Seen              BoolValue     `xml:"seen,attr"`
-	FromAddress       PhoneNumber   `xml:"from_address,attr"`
-	Address           PhoneNumber   `xml:"address,attr"`
-	MessageClassifier string        `xml:"m_cls,attr"`
-	MessageSize       string        `xml:"m_size,attr"`
-	Parts             []MMSPart     `xml:"parts>part"`
-	Addresses         []PhoneNumber `xml:"addrs>addr"`
-	Body              string        `xml:"body"`
+	XMLName           xml.Name    `xml:"mms"`
+	TextOnly          BoolValue   `xml:"text_only,attr"`
+	Read              ReadStatus  `xml:"read,attr"`
+	Date              string      `xml:"date,attr"`
+	Locked            BoolValue   `xml:"locked,attr"`
+	DateSent          AndroidTS   `xml:"date_sent,attr"`
+	ReadableDate      string      `xml:"readable_date,attr"`
+	ContactName       string      `xml:"contact_name,attr"`
+	Seen              BoolValue   `xml:"seen,attr"`
+	FromAddress       PhoneNumber `xml:"from_address,attr"`
+	Address           PhoneNumber `xml:"address,attr"`
+	MessageClassifier string      `xml:"m_cls,attr"`
+	MessageSize       string      `xml:"m_size,attr"`
+	ThreadID          string      `xml:"thread_id,attr"`
+	MessageBox        MessageBox  `xml:"msg_box,attr"`
+	MessageID         string      `xml:"m_id,attr"`
+	Parts             []MMSPart   `xml:"parts>part"`
+	// Addresses was a []PhoneNumber before the role of each address was
+	// kept; see "Upgrading from earlier versions" in the README.
+	Addresses []MMSAddress `xml:"addrs>addr"`
+	Body      string       `xml:"body"`
+}
+
+// MessageBox is the msg_box attribute of an MMS: the folder it was stored in.
+type MessageBox int
+
+// MessageBox values (Telephony.BaseMmsColumns in the Android framework).
+const (
+	MessageBoxInbox  MessageBox = 1
+	MessageBoxSent   MessageBox = 2
+	MessageBoxDrafts MessageBox = 3
+	MessageBoxOutbox MessageBox = 4
+)
+
+// MMS <addr> type values (PduHeaders in the Android framework).
+const (
+	MMSAddrBCC  = 129
+	MMSAddrCC   = 130
+	MMSAddrFrom = 137
+	MMSAddrTo   = 151
+)
+
+// MMSAddress is one <addr> entry of an MMS: a participant and their role in
+// the message (MMSAddrFrom, MMSAddrTo, ...).
+type MMSAddress struct {
+	Address PhoneNumber `xml:"address,attr"`
+	Type    int         `xml:"type,attr"`
+	Charset string      `xml:"charset,attr"`
 }
 
 type MMSPart struct {
@@ -48,13 +104,63 @@ type MMSPart struct {
 	Filename       string   `xml:"cl,attr"`
 	Name           string   `xml:"name,attr"`
 	Text           string   `xml:"text,attr"`
+	ContentID      string   `xml:"cid,attr"`
+	Charset        string   `xml:"chset,attr"`
 	Type           string   `xml:"ct"`
 }
 
-// Call represents a call log entry
+// DecodedSize returns the size in bytes of the part's base64 payload once
+// decoded, without decoding it, or of its text when it has no data.
+func (p MMSPart) DecodedSize() int64 {
+	data := strings.TrimSpace(p.Data)
+	if data == "" || data == "null" {
+		if p.Text == "null" {
+			return 0
+		}
+		return int64(len(p.Text))
+	}
+	n := base64.StdEncoding.DecodedLen(len(data))
+	n -= strings.Count(data[max(0, len(data)-2):], "=")
+	return int64(max(n, 0))
+}
+
+// Call is one <call> entry of a call log backup. Its fields were retyped
+// when they were first decoded from attributes; see the README.
 type Call struct {
-	XMLName xml.Name `xml:"call"`
-	Number  string   `xml:"number"`
-	Date    string   `xml:"date"`
-	Type    int      `xml:"type"`
+	XMLName      xml.Name    `xml:"call"`
+	Number       PhoneNumber `xml:"number,attr"`
+	Duration     string      `xml:"duration,attr"` // seconds
+	Date         string      `xml:"date,attr"`
+	Type         CallType    `xml:"type,attr"`
+	Presentation int         `xml:"presentation,attr"`
+	ReadableDate string      `xml:"readable_date,attr"`
+	ContactName  string      `xml:"contact_name,attr"`
+}
+
+// CallType values (CallLog.Calls in the Android framework).
+const (
+	CallIncoming  CallType = 1
+	CallOutgoing  CallType = 2
+	CallMissed    CallType = 3
+	CallVoicemail CallType = 4
+	CallRejected  CallType = 5
+	CallBlocked   CallType = 6
+)
+
+func (t CallType) String() string {
+	switch t {
+	case CallIncoming:
+		return "incoming"
+	case CallOutgoing:
+		return "outgoing"
+	case CallMissed:
+		return "missed"
+	case CallVoicemail:
+		return "voicemail"
+	case CallRejected:
+		return "rejected"
+	case CallBlocked:
+		return "blocked"
+	}
+	return "unknown"
 }
@@ -0,0 +1,35 @@
+package types
+
+import "testing"
+
+func TestPhoneNumber_Usable(t *testing.T) {
+	for a, want := range map[PhoneNumber]bool{
+		"":                      false,
+		"null":                  false,
+		" insert-address-token": false,
+		"+15551112222":          true,
+	} {
+		if got := a.Usable(); got != want {
+			t.Errorf("PhoneNumber(%q).Usable() = %v, want %v", a, got, want)
+		}
+	}
+}
+
+func TestMMSPart_DecodedSize(t *testing.T) {
+	for _, tc := range []struct {
+		part MMSPart
+		want int64
+	}{
+		{MMSPart{}, 0},
+		{MMSPart{Data: "null", Text: "null"}, 0},
+		{MMSPart{Data: "aGVsbG8="}, 5},
+		{MMSPart{Data: "aGk="}, 2},
+		{MMSPart{Data: "aGV5"}, 3},
+		{MMSPart{Data: " aGk=\n"}, 2},
+		{MMSPart{Text: "hello"}, 5},
+	} {
+		if got := tc.part.DecodedSize(); got != tc.want {
+			t.Errorf("DecodedSize(%+v) = %d, want %d", tc.part, got, tc.want)
+		}
+	}
+}
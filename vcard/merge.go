@@ -0,0 +1,178 @@
+package vcard
+
+import (
+	"sort"
+	"strings"
+)
+
+// Merge folds cards describing the same person into one. Two cards are the
+// same person when they share a phone number (compared after phoneKey, which
+// may be nil to compare digits only), share an e-mail address
+// (case-insensitively), or, when neither has any number or address, have the
+// same display name.
+//
+// The first card of each group supplies single-valued properties that later
+// cards only fill in when missing; multi-valued properties are unioned. The
+// result is sorted by display name.
+func Merge(cards []*Card, phoneKey func(string) string) []*Card {
+	if phoneKey == nil {
+		phoneKey = digits
+	}
+
+	parent := make([]int, len(cards))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	firstByKey := make(map[string]int)
+	join := func(key string, i int) {
+		if j, ok := firstByKey[key]; ok {
+			a, b := find(i), find(j)
+			// Keep the earliest card as root so it leads the merged result.
+			if a < b {
+				parent[b] = a
+			} else {
+				parent[a] = b
+			}
+		} else {
+			firstByKey[key] = i
+		}
+	}
+
+	for i, c := range cards {
+		keyed := false
+		for _, t := range c.Phones {
+			if k := phoneKey(t.Value); k != "" {
+				join("tel:"+k, i)
+				keyed = true
+			}
+		}
+		for _, e := range c.Emails {
+			join("email:"+strings.ToLower(e.Value), i)
+			keyed = true
+		}
+		if !keyed {
+			if name := strings.ToLower(c.DisplayName()); name != "" {
+				join("name:"+name, i)
+			}
+		}
+	}
+
+	byRoot := make(map[int]*Card)
+	var out []*Card
+	for i, c := range cards {
+		root := find(i)
+		m, ok := byRoot[root]
+		if !ok {
+			m = &Card{Version: "3.0"}
+			byRoot[root] = m
+			out = append(out, m)
+		}
+		m.absorb(c, phoneKey)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return strings.ToLower(out[i].DisplayName()) < strings.ToLower(out[j].DisplayName())
+	})
+	return out
+}
+
+// absorb merges c into m.
+func (m *Card) absorb(c *Card, phoneKey func(string) string) {
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&m.FormattedName, c.FormattedName)
+	if m.Name.IsZero() {
+		m.Name = c.Name
+	}
+	fill(&m.Nickname, c.Nickname)
+	fill(&m.Org, c.Org)
+	fill(&m.Title, c.Title)
+	fill(&m.Birthday, c.Birthday)
+
+	m.Phones = mergeTyped(m.Phones, c.Phones, phoneKey)
+	m.Emails = mergeTyped(m.Emails, c.Emails, strings.ToLower)
+	for _, a := range c.Addresses {
+		if !containsAddress(m.Addresses, a) {
+			m.Addresses = append(m.Addresses, a)
+		}
+	}
+	for _, u := range c.URLs {
+		if !contains(m.URLs, u) {
+			m.URLs = append(m.URLs, u)
+		}
+	}
+	for _, n := range c.Notes {
+		if !contains(m.Notes, n) {
+			m.Notes = append(m.Notes, n)
+		}
+	}
+	for _, p := range c.Other {
+		if !containsProperty(m.Other, p) {
+			m.Other = append(m.Other, p)
+		}
+	}
+}
+
+// mergeTyped appends the values of src not already in dst (by key), merging
+// the TYPE lists of values present in both.
+func mergeTyped(dst, src []Typed, key func(string) string) []Typed {
+	for _, s := range src {
+		k := key(s.Value)
+		found := false
+		for i := range dst {
+			if key(dst[i].Value) == k {
+				for _, t := range s.Types {
+					if !contains(dst[i].Types, t) {
+						dst[i].Types = append(dst[i].Types, t)
+					}
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, Typed{Value: s.Value, Types: append([]string(nil), s.Types...)})
+		}
+	}
+	return dst
+}
+
+func containsAddress(list []Address, a Address) bool {
+	for _, x := range list {
+		if x.POBox == a.POBox && x.Extended == a.Extended && x.Street == a.Street &&
+			x.Locality == a.Locality && x.Region == a.Region && x.Postcode == a.Postcode && x.Country == a.Country {
+			return true
+		}
+	}
+	return false
+}
+
+func containsProperty(list []Property, p Property) bool {
+	for _, x := range list {
+		if x.Name == p.Name && x.Value == p.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// digits returns the digits of a phone number, keeping a leading '+'.
+func digits(s string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(s) {
+		if (r >= '0' && r <= '9') || (r == '+' && i == 0) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
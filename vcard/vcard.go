@@ -0,0 +1,467 @@
+// Package vcard reads the contact cards phones share as MMS attachments and
+// writes them back out. It understands vCard 2.1 (quoted-printable values,
+// CHARSET and bare TYPE parameters), 3.0 and 4.0 (tel: URIs), and normalises
+// all of them to one typed Card.
+package vcard
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/quotedprintable"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// IsContentType reports whether ct is one of the MIME types phones use for
+// vCard attachments.
+func IsContentType(ct string) bool {
+	switch strings.ToLower(ct) {
+	case "text/x-vcard", "text/v-card", "text/vcard", "text/directory":
+		return true
+	}
+	return false
+}
+
+// Name is the structured N property.
+type Name struct {
+	Family     string `json:"family,omitempty"`
+	Given      string `json:"given,omitempty"`
+	Additional string `json:"additional,omitempty"`
+	Prefix     string `json:"prefix,omitempty"`
+	Suffix     string `json:"suffix,omitempty"`
+}
+
+// IsZero reports whether every component of n is empty.
+func (n Name) IsZero() bool {
+	return n == Name{}
+}
+
+// Address is the structured ADR property.
+type Address struct {
+	Types    []string `json:"types,omitempty"`
+	POBox    string   `json:"po_box,omitempty"`
+	Extended string   `json:"extended,omitempty"`
+	Street   string   `json:"street,omitempty"`
+	Locality string   `json:"locality,omitempty"`
+	Region   string   `json:"region,omitempty"`
+	Postcode string   `json:"postcode,omitempty"`
+	Country  string   `json:"country,omitempty"`
+}
+
+// Typed is a value with TYPE parameters, such as a TEL or EMAIL. Types are
+// lowercased ("cell", "work", "pref").
+type Typed struct {
+	Value string   `json:"value"`
+	Types []string `json:"types,omitempty"`
+}
+
+// Property is a property Card does not model, kept so that it survives a round
+// trip through Write.
+type Property struct {
+	Name   string              `json:"name"`
+	Params map[string][]string `json:"params,omitempty"`
+	Value  string              `json:"value"`
+}
+
+// Card is one contact.
+type Card struct {
+	// Version is the vCard version the card was read from.
+	Version       string     `json:"version,omitempty"`
+	FormattedName string     `json:"fn,omitempty"`
+	Name          Name       `json:"n"`
+	Nickname      string     `json:"nickname,omitempty"`
+	Org           string     `json:"org,omitempty"`
+	Title         string     `json:"title,omitempty"`
+	Phones        []Typed    `json:"tel,omitempty"`
+	Emails        []Typed    `json:"email,omitempty"`
+	Addresses     []Address  `json:"adr,omitempty"`
+	URLs          []string   `json:"url,omitempty"`
+	Birthday      string     `json:"bday,omitempty"`
+	Notes         []string   `json:"note,omitempty"`
+	Other         []Property `json:"other,omitempty"`
+}
+
+// DisplayName returns FN, or a name assembled from N, or the first phone
+// number or e-mail address.
+func (c *Card) DisplayName() string {
+	if c.FormattedName != "" {
+		return c.FormattedName
+	}
+	if name := strings.Join(nonEmpty(c.Name.Prefix, c.Name.Given, c.Name.Additional, c.Name.Family, c.Name.Suffix), " "); name != "" {
+		return name
+	}
+	if len(c.Phones) > 0 {
+		return c.Phones[0].Value
+	}
+	if len(c.Emails) > 0 {
+		return c.Emails[0].Value
+	}
+	return c.Org
+}
+
+// MarshalJSON omits an empty N.
+func (n Name) MarshalJSON() ([]byte, error) {
+	if n.IsZero() {
+		return []byte("null"), nil
+	}
+	type plain Name
+	return json.Marshal(plain(n))
+}
+
+// Parse reads every card in data. data is expected to be UTF-8, but a UTF-16
+// or UTF-8 byte order mark is honoured. Cards that are syntactically damaged
+// are read as far as possible; an error is returned only when data contains no
+// card at all.
+func Parse(data []byte) ([]*Card, error) {
+	text := decodeBOM(data)
+
+	var (
+		cards []*Card
+		cur   *Card
+	)
+	for _, line := range unfold(text) {
+		p, ok := parseLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VCARD"):
+			cur = &Card{}
+		case p.name == "END" && strings.EqualFold(p.value, "VCARD"):
+			if cur != nil {
+				cards = append(cards, cur)
+			}
+			cur = nil
+		case cur != nil:
+			cur.apply(p)
+		}
+	}
+	if cur != nil {
+		// Missing END:VCARD; keep what was read.
+		cards = append(cards, cur)
+	}
+	if len(cards) == 0 {
+		return nil, fmt.Errorf("no vCard found")
+	}
+	return cards, nil
+}
+
+// rawProperty is one content line split into its parts. value is already
+// transfer-decoded but still vCard-escaped.
+type rawProperty struct {
+	name   string
+	params map[string][]string
+	value  string
+}
+
+// types returns the TYPE parameter values, lowercased. vCard 2.1 writes them
+// as bare parameters ("TEL;CELL;PREF:"), which parseLine files under TYPE.
+func (p rawProperty) types() []string {
+	var out []string
+	for _, t := range p.params["TYPE"] {
+		for _, v := range strings.Split(t, ",") {
+			if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+				out = append(out, v)
+			}
+		}
+	}
+	if pref := p.params["PREF"]; len(pref) > 0 && !contains(out, "pref") {
+		out = append(out, "pref")
+	}
+	return out
+}
+
+func (c *Card) apply(p rawProperty) {
+	switch p.name {
+	case "VERSION":
+		c.Version = p.value
+	case "FN":
+		c.FormattedName = unescape(p.value)
+	case "N":
+		f := splitStructured(p.value, 5)
+		c.Name = Name{Family: f[0], Given: f[1], Additional: f[2], Prefix: f[3], Suffix: f[4]}
+	case "NICKNAME":
+		c.Nickname = unescape(p.value)
+	case "ORG":
+		c.Org = strings.Join(nonEmpty(splitStructured(p.value, 0)...), ", ")
+	case "TITLE":
+		c.Title = unescape(p.value)
+	case "TEL":
+		value := unescape(p.value)
+		value = strings.TrimPrefix(strings.TrimPrefix(value, "tel:"), "TEL:")
+		// A tel: URI may carry parameters such as ";ext=12".
+		value, _, _ = strings.Cut(value, ";")
+		if value = strings.TrimSpace(value); value != "" {
+			c.Phones = append(c.Phones, Typed{Value: value, Types: p.types()})
+		}
+	case "EMAIL":
+		if value := strings.TrimSpace(unescape(p.value)); value != "" {
+			c.Emails = append(c.Emails, Typed{Value: value, Types: p.types()})
+		}
+	case "ADR":
+		f := splitStructured(p.value, 7)
+		c.Addresses = append(c.Addresses, Address{
+			Types: p.types(), POBox: f[0], Extended: f[1], Street: f[2],
+			Locality: f[3], Region: f[4], Postcode: f[5], Country: f[6],
+		})
+	case "URL":
+		c.URLs = append(c.URLs, unescape(p.value))
+	case "BDAY":
+		c.Birthday = unescape(p.value)
+	case "NOTE":
+		c.Notes = append(c.Notes, unescape(p.value))
+	case "PRODID", "REV", "UID", "LABEL", "X-ANDROID-CUSTOM":
+		// Client bookkeeping that is meaningless once merged.
+	case "PHOTO", "LOGO", "SOUND", "KEY":
+		// Binary payloads; dropped to keep the merged file small.
+	default:
+		c.Other = append(c.Other, Property{Name: p.name, Params: p.params, Value: p.value})
+	}
+}
+
+// unfold splits text into logical lines. A line starting with a space or tab
+// continues the previous one (RFC 2425 folding); a quoted-printable line ending
+// in "=" continues on the next line (vCard 2.1 soft line breaks).
+func unfold(text string) []string {
+	var lines []string
+	sc := bufio.NewScanner(strings.NewReader(text))
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	qpContinues := false
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		switch {
+		case qpContinues && len(lines) > 0:
+			lines[len(lines)-1] += "\n" + line
+		case (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0:
+			lines[len(lines)-1] += line[1:]
+		case strings.TrimSpace(line) == "":
+			qpContinues = false
+			continue
+		default:
+			lines = append(lines, line)
+		}
+		last := lines[len(lines)-1]
+		qpContinues = strings.HasSuffix(last, "=") && isQuotedPrintable(last)
+	}
+	return lines
+}
+
+func isQuotedPrintable(line string) bool {
+	head, _, _ := strings.Cut(strings.ToUpper(line), ":")
+	return strings.Contains(head, "QUOTED-PRINTABLE")
+}
+
+// parseLine splits "[group.]NAME[;param...]:value" and decodes the value's
+// transfer encoding and charset.
+func parseLine(line string) (rawProperty, bool) {
+	colon := -1
+	inQuote := false
+	for i, r := range line {
+		if r == '"' {
+			inQuote = !inQuote
+		} else if r == ':' && !inQuote {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return rawProperty{}, false
+	}
+	head, value := line[:colon], line[colon+1:]
+
+	fields := splitUnquoted(head, ';')
+	name := strings.ToUpper(strings.TrimSpace(fields[0]))
+	if _, after, ok := strings.Cut(name, "."); ok {
+		name = after // drop the group
+	}
+	p := rawProperty{name: name, params: make(map[string][]string)}
+	for _, f := range fields[1:] {
+		k, v, ok := strings.Cut(f, "=")
+		k = strings.ToUpper(strings.TrimSpace(k))
+		if !ok {
+			// vCard 2.1 bare parameter: an encoding or a type.
+			switch k {
+			case "QUOTED-PRINTABLE", "BASE64", "8BIT", "7BIT":
+				p.params["ENCODING"] = append(p.params["ENCODING"], k)
+			default:
+				p.params["TYPE"] = append(p.params["TYPE"], k)
+			}
+			continue
+		}
+		for _, v := range splitUnquoted(v, ',') {
+			p.params[k] = append(p.params[k], strings.Trim(v, `"`))
+		}
+	}
+
+	var raw []byte
+	switch enc := strings.ToUpper(first(p.params["ENCODING"])); enc {
+	case "QUOTED-PRINTABLE":
+		decoded, err := readAllQP(value)
+		if err != nil {
+			raw = []byte(value)
+		} else {
+			raw = decoded
+		}
+	default:
+		raw = []byte(value)
+	}
+	p.value = decodeCharset(raw, first(p.params["CHARSET"]))
+	delete(p.params, "ENCODING")
+	delete(p.params, "CHARSET")
+	return p, true
+}
+
+func readAllQP(s string) ([]byte, error) {
+	// Soft line breaks were joined with "\n" by unfold; quotedprintable wants
+	// "=\r\n".
+	s = strings.ReplaceAll(s, "=\n", "=\r\n")
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(quotedprintable.NewReader(strings.NewReader(s)))
+	return buf.Bytes(), err
+}
+
+// decodeCharset converts a vCard 2.1 CHARSET-tagged value to UTF-8. Unknown
+// charsets are assumed to be UTF-8, with invalid bytes replaced.
+func decodeCharset(raw []byte, charset string) string {
+	switch strings.ToUpper(charset) {
+	case "ISO-8859-1", "LATIN1", "WINDOWS-1252", "CP1252":
+		if !utf8.Valid(raw) {
+			runes := make([]rune, len(raw))
+			for i, b := range raw {
+				runes[i] = rune(b)
+			}
+			return string(runes)
+		}
+	}
+	return strings.ToValidUTF8(string(raw), string(utf8.RuneError))
+}
+
+// decodeBOM returns data as a string, decoding UTF-16 when it starts with a
+// byte order mark and stripping a UTF-8 one.
+func decodeBOM(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		return string(data[3:])
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}), bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		big := data[0] == 0xfe
+		data = data[2:]
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			hi, lo := data[2*i], data[2*i+1]
+			if !big {
+				hi, lo = lo, hi
+			}
+			units[i] = uint16(hi)<<8 | uint16(lo)
+		}
+		return string(utf16.Decode(units))
+	}
+	return string(data)
+}
+
+// splitUnquoted splits s on sep outside double quotes.
+func splitUnquoted(s string, sep rune) []string {
+	var out []string
+	start, inQuote := 0, false
+	for i, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case r == sep && !inQuote:
+			out = append(out, s[start:i])
+			start = i + len(string(sep))
+		}
+	}
+	return append(out, s[start:])
+}
+
+// splitStructured splits a structured value on unescaped ';' and unescapes
+// each component. When n > 0 the result has exactly n components.
+func splitStructured(value string, n int) []string {
+	var (
+		out []string
+		b   strings.Builder
+	)
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			b.WriteRune('\\')
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ';':
+			out = append(out, unescape(b.String()))
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	out = append(out, unescape(b.String()))
+	if n > 0 {
+		for len(out) < n {
+			out = append(out, "")
+		}
+		out = out[:n]
+	}
+	return out
+}
+
+// unescape resolves the backslash escapes of vCard 3.0 and 4.0 text values.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		if escaped {
+			switch r {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteRune(r)
+			}
+			escaped = false
+			continue
+		}
+		if r == '\\' {
+			escaped = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if escaped {
+		b.WriteByte('\\')
+	}
+	return b.String()
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package vcard
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+const card21 = "BEGIN:VCARD\r\n" +
+	"VERSION:2.1\r\n" +
+	"N;CHARSET=UTF-8;ENCODING=QUOTED-PRINTABLE:M=C3=BCller;J=C3=BCrgen;;;\r\n" +
+	"FN;CHARSET=UTF-8;ENCODING=QUOTED-PRINTABLE:J=C3=BCrgen M=C3=BC=\r\n" +
+	"ller\r\n" +
+	"TEL;CELL;PREF:+49 170 1234567\r\n" +
+	"TEL;WORK:030-123456\r\n" +
+	"NOTE;ENCODING=QUOTED-PRINTABLE;CHARSET=ISO-8859-1:Gr=FC=DFe\r\n" +
+	"PHOTO;ENCODING=BASE64;TYPE=JPEG:/9j/4AAQ\r\n" +
+	" SkZJRg==\r\n" +
+	"\r\n" +
+	"END:VCARD\r\n"
+
+const card30 = `BEGIN:VCARD
+VERSION:3.0
+FN:Ann Smith
+N:Smith;Ann;;Dr.;
+ORG:Acme\, Inc.;Research
+EMAIL;TYPE=INTERNET,WORK:ann@example.com
+ADR;TYPE=home:;;1 Main St\nApt 2;Springfield;IL;62701;USA
+NOTE:line one\nline two
+X-CUSTOM;X-PARAM=a:custom value
+item1.URL:https://example.com/ann
+END:VCARD`
+
+const card40 = `BEGIN:VCARD
+VERSION:4.0
+FN:Bob
+TEL;VALUE=uri;TYPE="voice,home";PREF=1:tel:+1-555-111-2222;ext=9
+EMAIL:Bob@Example.com
+END:VCARD`
+
+func TestParse_Versions(t *testing.T) {
+	cards, err := Parse([]byte(card21 + card30 + "\n" + card40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 3 {
+		t.Fatalf("got %d cards, want 3", len(cards))
+	}
+
+	c := cards[0]
+	if c.Version != "2.1" || c.FormattedName != "Jürgen Müller" || c.Name.Family != "Müller" || c.Name.Given != "Jürgen" {
+		t.Errorf("2.1 names = %+v", c)
+	}
+	if len(c.Phones) != 2 || c.Phones[0].Value != "+49 170 1234567" || strings.Join(c.Phones[0].Types, ",") != "cell,pref" {
+		t.Errorf("2.1 phones = %+v", c.Phones)
+	}
+	if len(c.Notes) != 1 || c.Notes[0] != "Grüße" {
+		t.Errorf("2.1 note = %q", c.Notes)
+	}
+	if len(c.Other) != 0 {
+		t.Errorf("PHOTO kept: %+v", c.Other)
+	}
+
+	c = cards[1]
+	if c.Org != "Acme, Inc., Research" || c.Name.Prefix != "Dr." {
+		t.Errorf("3.0 org/name = %q / %+v", c.Org, c.Name)
+	}
+	if len(c.Emails) != 1 || strings.Join(c.Emails[0].Types, ",") != "internet,work" {
+		t.Errorf("3.0 emails = %+v", c.Emails)
+	}
+	if len(c.Addresses) != 1 || c.Addresses[0].Street != "1 Main St\nApt 2" || c.Addresses[0].Postcode != "62701" {
+		t.Errorf("3.0 adr = %+v", c.Addresses)
+	}
+	if len(c.Notes) != 1 || c.Notes[0] != "line one\nline two" {
+		t.Errorf("3.0 note = %q", c.Notes)
+	}
+	if len(c.URLs) != 1 || c.URLs[0] != "https://example.com/ann" {
+		t.Errorf("grouped URL = %q", c.URLs)
+	}
+	if len(c.Other) != 1 || c.Other[0].Name != "X-CUSTOM" || c.Other[0].Params["X-PARAM"][0] != "a" {
+		t.Errorf("3.0 other = %+v", c.Other)
+	}
+
+	c = cards[2]
+	if len(c.Phones) != 1 || c.Phones[0].Value != "+1-555-111-2222" || strings.Join(c.Phones[0].Types, ",") != "voice,home,pref" {
+		t.Errorf("4.0 phones = %+v", c.Phones)
+	}
+}
+
+func TestParse_UTF16(t *testing.T) {
+	units := utf16.Encode([]rune("BEGIN:VCARD\r\nFN:Zoë\r\nEND:VCARD\r\n"))
+	data := []byte{0xff, 0xfe}
+	for _, u := range units {
+		data = append(data, byte(u), byte(u>>8))
+	}
+	cards, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cards[0].FormattedName != "Zoë" {
+		t.Errorf("FN = %q", cards[0].FormattedName)
+	}
+}
+
+func TestParse_NoCard(t *testing.T) {
+	if _, err := Parse([]byte("hello")); err == nil {
+		t.Error("Parse accepted a non-vCard")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := &Card{FormattedName: "Ann", Phones: []Typed{{Value: "(555) 111-2222", Types: []string{"cell"}}}, Notes: []string{"n1"}}
+	b := &Card{FormattedName: "Ann Smith", Org: "Acme", Phones: []Typed{{Value: "555.111.2222", Types: []string{"pref"}}}, Emails: []Typed{{Value: "ann@example.com"}}}
+	c := &Card{FormattedName: "Other", Emails: []Typed{{Value: "ANN@example.com"}}, Notes: []string{"n1", "n2"}}
+	d := &Card{FormattedName: "Zed"}
+	e := &Card{FormattedName: "zed"}
+
+	out := Merge([]*Card{d, a, b, c, e}, nil)
+	if len(out) != 2 {
+		t.Fatalf("got %d cards, want 2: %+v", len(out), out)
+	}
+	ann := out[0]
+	if ann.FormattedName != "Ann" || ann.Org != "Acme" {
+		t.Errorf("merged scalars = %q, %q", ann.FormattedName, ann.Org)
+	}
+	if len(ann.Phones) != 1 || strings.Join(ann.Phones[0].Types, ",") != "cell,pref" {
+		t.Errorf("merged phones = %+v", ann.Phones)
+	}
+	if len(ann.Emails) != 1 || strings.Join(ann.Notes, ",") != "n1,n2" {
+		t.Errorf("merged emails/notes = %+v / %q", ann.Emails, ann.Notes)
+	}
+	if out[1].FormattedName != "Zed" {
+		t.Errorf("second card = %q", out[1].FormattedName)
+	}
+}
+
+func TestWrite_RoundTrip(t *testing.T) {
+	cards, err := Parse([]byte(card30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cards[0].Notes = append(cards[0].Notes, strings.Repeat("é", 60))
+	var buf bytes.Buffer
+	if err = Write(&buf, cards); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+	again, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, want := again[0], cards[0]
+	if got.FormattedName != want.FormattedName || got.Org != want.Org || got.Addresses[0].Street != want.Addresses[0].Street ||
+		strings.Join(got.Notes, "|") != strings.Join(want.Notes, "|") || len(got.Other) != 1 {
+		t.Errorf("round trip changed card:\n got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,113 @@
+package vcard
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Write writes cards as vCard 3.0, the version most address books import.
+// Lines are folded at 75 octets without splitting UTF-8 sequences.
+func Write(w io.Writer, cards []*Card) error {
+	ew := &errWriter{w: w}
+	for _, c := range cards {
+		ew.line("BEGIN:VCARD")
+		ew.line("VERSION:3.0")
+		ew.line("FN:" + escape(c.DisplayName()))
+		n := c.Name
+		ew.line("N:" + strings.Join([]string{escape(n.Family), escape(n.Given), escape(n.Additional), escape(n.Prefix), escape(n.Suffix)}, ";"))
+		if c.Nickname != "" {
+			ew.line("NICKNAME:" + escape(c.Nickname))
+		}
+		if c.Org != "" {
+			ew.line("ORG:" + escape(c.Org))
+		}
+		if c.Title != "" {
+			ew.line("TITLE:" + escape(c.Title))
+		}
+		for _, t := range c.Phones {
+			ew.line("TEL" + typeParam(t.Types) + ":" + escape(t.Value))
+		}
+		for _, e := range c.Emails {
+			ew.line("EMAIL" + typeParam(e.Types) + ":" + escape(e.Value))
+		}
+		for _, a := range c.Addresses {
+			ew.line("ADR" + typeParam(a.Types) + ":" + strings.Join([]string{
+				escape(a.POBox), escape(a.Extended), escape(a.Street), escape(a.Locality),
+				escape(a.Region), escape(a.Postcode), escape(a.Country),
+			}, ";"))
+		}
+		for _, u := range c.URLs {
+			ew.line("URL:" + u)
+		}
+		if c.Birthday != "" {
+			ew.line("BDAY:" + c.Birthday)
+		}
+		for _, p := range c.Other {
+			ew.line(p.Name + otherParams(p.Params) + ":" + p.Value)
+		}
+		for _, note := range c.Notes {
+			ew.line("NOTE:" + escape(note))
+		}
+		ew.line("END:VCARD")
+	}
+	return ew.err
+}
+
+func typeParam(types []string) string {
+	if len(types) == 0 {
+		return ""
+	}
+	return ";TYPE=" + strings.Join(types, ",")
+}
+
+func otherParams(params map[string][]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		vals := make([]string, len(params[k]))
+		for i, v := range params[k] {
+			if strings.ContainsAny(v, ",;:") {
+				v = `"` + v + `"`
+			}
+			vals[i] = v
+		}
+		fmt.Fprintf(&b, ";%s=%s", k, strings.Join(vals, ","))
+	}
+	return b.String()
+}
+
+// escape applies the vCard 3.0 text escapes.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\r\n", `\n`, "\n", `\n`, ",", `\,`, ";", `\;`).Replace(s)
+}
+
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+// line writes one content line, folded at 75 octets (RFC 2425 section 5.8.1).
+// Continuation lines lose one octet to their leading space.
+func (ew *errWriter) line(s string) {
+	limit := 75
+	for ew.err == nil {
+		if len(s) <= limit {
+			_, ew.err = io.WriteString(ew.w, s+"\r\n")
+			return
+		}
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		_, ew.err = io.WriteString(ew.w, s[:cut]+"\r\n ")
+		s = s[cut:]
+		limit = 74
+	}
+}
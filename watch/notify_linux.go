@@ -0,0 +1,86 @@
+//go:build linux
+
+package watch
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask selects the events that can mean a file is ready: written and
+// closed, or created or renamed in place.
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE
+
+// notify returns a channel that receives a value whenever a file under dir is
+// written, created or moved in, and a function that stops watching. Events
+// are coalesced: a receive only means "something changed, rescan".
+func notify(dir string) (<-chan struct{}, func() error, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, os.NewSyscallError("inotify_init1", err)
+	}
+	// A non-blocking descriptor is handled by the runtime poller, so Close
+	// interrupts a pending Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	// inotify is not recursive: every directory gets its own watch, and the
+	// watch descriptors map back to directories so that subdirectories
+	// created later are watched too.
+	dirs := make(map[int32]string)
+	watchTree := func(root string) error {
+		return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || !entry.IsDir() {
+				return nil
+			}
+			wd, err := syscall.InotifyAddWatch(fd, path, inotifyMask)
+			if err != nil {
+				return os.NewSyscallError("inotify_add_watch "+path, err)
+			}
+			dirs[int32(wd)] = path
+			return nil
+		})
+	}
+	if err = watchTree(dir); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	c := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				name := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+				off += syscall.SizeofInotifyEvent + int(ev.Len)
+				if ev.Mask&syscall.IN_ISDIR != 0 {
+					if parent, ok := dirs[ev.Wd]; ok {
+						_ = watchTree(filepath.Join(parent, cString(name)))
+					}
+				}
+			}
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return c, f.Close, nil
+}
+
+// cString returns the NUL-padded name of an inotify event as a string.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
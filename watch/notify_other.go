@@ -0,0 +1,10 @@
+//go:build !linux
+
+package watch
+
+import "errors"
+
+// notify is only implemented on Linux; elsewhere the Watcher polls.
+func notify(dir string) (<-chan struct{}, func() error, error) {
+	return nil, nil, errors.New("not supported on this platform")
+}
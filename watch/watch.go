@@ -0,0 +1,216 @@
+// Package watch processes backup files as they appear in a directory. The
+// directory tree is rescanned periodically and, where the platform supports
+// it (inotify on Linux), as soon as anything in it changes. A new file is only
+// processed once its size and modification time have stopped changing, so a
+// backup still being written or synced is never read half-finished.
+package watch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"time"
+)
+
+// Default timings; see Options.
+const (
+	DefaultInterval = 10 * time.Second
+	DefaultSettle   = 5 * time.Second
+	// maxRetryDelay caps the back-off between attempts at a file that keeps
+	// failing.
+	maxRetryDelay = time.Hour
+)
+
+// Options tune a Watcher. Zero values select the defaults.
+type Options struct {
+	// Match selects the files to process by base name.
+	Match func(name string) bool
+	// Interval is how often the directory is rescanned when no change
+	// notification arrives.
+	Interval time.Duration
+	// Settle is how long a file's size and modification time must stay the
+	// same before it is processed.
+	Settle time.Duration
+	// Poll disables change notifications: the directory is only rescanned
+	// every Interval.
+	Poll bool
+	// Logger receives warnings about the directory and files that could not
+	// be processed; nil means slog.Default().
+	Logger *slog.Logger
+}
+
+// fileState identifies one version of a file.
+type fileState struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// pending is a file seen but not yet processed.
+type pending struct {
+	fileState
+	since time.Time // when the file was first seen in this state
+}
+
+// retry is a file whose processing failed, to be tried again at a time.
+type retry struct {
+	fileState
+	at    time.Time
+	delay time.Duration // since the previous attempt
+}
+
+// Watcher processes the files of one directory tree.
+type Watcher struct {
+	dir     string
+	opts    Options
+	process func(path string) error
+
+	done    map[string]fileState
+	pending map[string]pending
+	retries map[string]retry
+}
+
+// New returns a Watcher calling process for every file under dir that
+// opts.Match accepts, once per version of the file seen while it runs. Files
+// already present are reported too: process should skip those an earlier run
+// handled (see processor.Ledger). A version process fails on is tried again
+// after Interval, then after twice as long each time, up to an hour; a
+// change to the file is processed as usual.
+func New(dir string, opts Options, process func(path string) error) (*Watcher, error) {
+	if opts.Match == nil {
+		return nil, errors.New("watch: Options.Match is required")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Settle <= 0 {
+		opts.Settle = DefaultSettle
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	w := &Watcher{
+		dir:     dir,
+		opts:    opts,
+		process: process,
+		done:    make(map[string]fileState),
+		pending: make(map[string]pending),
+		retries: make(map[string]retry),
+	}
+	return w, nil
+}
+
+// Run watches until ctx is cancelled, which is not an error.
+func (w *Watcher) Run(ctx context.Context) error {
+	var changes <-chan struct{}
+	if !w.opts.Poll {
+		c, stop, err := notify(w.dir)
+		if err != nil {
+			w.opts.Logger.Warn("change notification unavailable, polling", "interval", w.opts.Interval, "err", err)
+		} else {
+			defer stop()
+			changes = c
+		}
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+		case <-timer.C:
+		}
+		w.Scan(time.Now())
+
+		next := w.opts.Interval
+		if len(w.pending) > 0 {
+			next = min(next, w.opts.Settle)
+		}
+		for _, r := range w.retries {
+			next = min(next, max(time.Until(r.at), 0))
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(next)
+	}
+}
+
+// Scan looks for new or changed files once, processing those that have been
+// stable for the settle time as of now.
+func (w *Watcher) Scan(now time.Time) {
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(w.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// A file removed mid-walk, an unreadable directory: try again
+			// next time.
+			return nil
+		}
+		if entry.IsDir() || !w.opts.Match(entry.Name()) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		seen[path] = true
+		state := fileState{info.Size(), info.ModTime()}
+		if d, ok := w.done[path]; ok && d.same(state) {
+			return nil
+		}
+		r, failed := w.retries[path]
+		if failed && r.same(state) {
+			if now.Before(r.at) {
+				return nil
+			}
+			// The version has already settled: try it again now.
+			w.pending[path] = pending{state, now.Add(-w.opts.Settle)}
+		}
+		p, ok := w.pending[path]
+		if !ok || !p.same(state) {
+			w.pending[path] = pending{state, now}
+			return nil
+		}
+		if now.Sub(p.since) < w.opts.Settle {
+			return nil
+		}
+
+		delete(w.pending, path)
+		if err := w.process(path); err != nil {
+			delay := w.opts.Interval
+			if failed && r.same(state) {
+				delay = min(2*r.delay, maxRetryDelay)
+			}
+			w.retries[path] = retry{state, now.Add(delay), delay}
+			w.opts.Logger.Warn("processing failed, will retry", "file", path, "in", delay, "err", err)
+			return nil
+		}
+		delete(w.retries, path)
+		w.done[path] = state
+		return nil
+	})
+	if err != nil {
+		w.opts.Logger.Warn("scanning directory", "dir", w.dir, "err", err)
+	}
+	for path := range w.pending {
+		if !seen[path] {
+			delete(w.pending, path)
+		}
+	}
+	for path := range w.retries {
+		if !seen[path] {
+			delete(w.retries, path)
+		}
+	}
+}
+
+// same reports whether s and t are the same version of a file.
+func (s fileState) same(t fileState) bool {
+	return s.Size == t.Size && s.ModTime.Equal(t.ModTime)
+}
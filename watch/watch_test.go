@@ -0,0 +1,212 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func isBackup(name string) bool {
+	return strings.HasPrefix(name, "sms-") && strings.HasSuffix(name, ".xml")
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "sms-1.xml")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("<smses>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var processed []string
+	opts := Options{Match: isBackup, Settle: time.Minute}
+	w, err := New(dir, opts, func(p string) error {
+		processed = append(processed, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Now()
+	w.Scan(t0)
+	w.Scan(t0.Add(30 * time.Second))
+	if len(processed) != 0 {
+		t.Fatalf("processed %q before the file settled", processed)
+	}
+	w.Scan(t0.Add(time.Minute))
+	if len(processed) != 1 || processed[0] != path {
+		t.Fatalf("processed = %q, want [%s]", processed, path)
+	}
+	w.Scan(t0.Add(2 * time.Minute))
+	if len(processed) != 1 {
+		t.Errorf("processed the same file twice")
+	}
+
+	// A changed file is processed again; growing restarts the settle time.
+	processed = nil
+	if err = os.WriteFile(path, []byte("<smses></smses>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w.Scan(t0.Add(2 * time.Minute))
+	if err = os.WriteFile(path, []byte("<smses> </smses>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w.Scan(t0.Add(3 * time.Minute))
+	if len(processed) != 0 {
+		t.Errorf("processed %q while it was still changing", processed)
+	}
+	w.Scan(t0.Add(4 * time.Minute))
+	if len(processed) != 1 {
+		t.Errorf("changed file was not processed again")
+	}
+}
+
+func TestScan_Retry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sms-1.xml")
+	if err := os.WriteFile(path, []byte("<smses>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		attempts int
+		fail     = true
+		logs     bytes.Buffer
+	)
+	opts := Options{
+		Match:    isBackup,
+		Settle:   time.Second,
+		Interval: time.Minute,
+		Logger:   slog.New(slog.NewTextHandler(&logs, nil)),
+	}
+	w, err := New(dir, opts, func(string) error {
+		attempts++
+		if fail {
+			return errors.New("half-written")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Now()
+	w.Scan(t0)
+	w.Scan(t0.Add(time.Second))
+	if attempts != 1 || !strings.Contains(logs.String(), "level=WARN") || !strings.Contains(logs.String(), "half-written") {
+		t.Fatalf("%d attempts, logged %q", attempts, logs.String())
+	}
+
+	// The failed version is retried after Interval, then twice as long.
+	w.Scan(t0.Add(30 * time.Second))
+	if attempts != 1 {
+		t.Errorf("retried after 30s")
+	}
+	w.Scan(t0.Add(62 * time.Second))
+	if attempts != 2 {
+		t.Errorf("not retried after Interval: %d attempts", attempts)
+	}
+	w.Scan(t0.Add(150 * time.Second))
+	if attempts != 2 {
+		t.Errorf("retried before twice the Interval")
+	}
+	fail = false
+	w.Scan(t0.Add(183 * time.Second))
+	if attempts != 3 {
+		t.Errorf("not retried after twice the Interval: %d attempts", attempts)
+	}
+
+	// Once it succeeds it is done.
+	w.Scan(t0.Add(time.Hour))
+	if attempts != 3 {
+		t.Errorf("processed again after success")
+	}
+}
+
+func TestRun(t *testing.T) {
+	modes := []struct {
+		name string
+		opts Options
+	}{
+		{"poll", Options{Poll: true, Interval: 10 * time.Millisecond}},
+	}
+	if runtime.GOOS == "linux" {
+		// With a long interval only a change notification can trigger the
+		// first scan after the file appears.
+		modes = append(modes, struct {
+			name string
+			opts Options
+		}{"notify", Options{Interval: time.Hour}})
+	}
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := mode.opts
+			opts.Match = isBackup
+			opts.Settle = 20 * time.Millisecond
+
+			var (
+				mu        sync.Mutex
+				processed []string
+			)
+			got := make(chan struct{}, 1)
+			w, err := New(dir, opts, func(p string) error {
+				mu.Lock()
+				processed = append(processed, p)
+				mu.Unlock()
+				got <- struct{}{}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() { done <- w.Run(ctx) }()
+
+			// Give Run time to set up its watches, then drop a backup into
+			// a new subdirectory the way a sync client would: write under
+			// another name, then rename.
+			time.Sleep(50 * time.Millisecond)
+			sub := filepath.Join(dir, "2024")
+			if err = os.Mkdir(sub, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(50 * time.Millisecond)
+			tmp := filepath.Join(sub, ".sms-1.xml.part")
+			if err = os.WriteFile(tmp, []byte("<smses/>"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err = os.Rename(tmp, filepath.Join(sub, "sms-1.xml")); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case <-got:
+			case <-time.After(5 * time.Second):
+				t.Fatal("file was not processed")
+			}
+			cancel()
+			if err = <-done; err != nil {
+				t.Errorf("Run = %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(processed) != 1 || processed[0] != filepath.Join(sub, "sms-1.xml") {
+				t.Errorf("processed = %q", processed)
+			}
+		})
+	}
+}